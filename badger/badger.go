@@ -0,0 +1,1064 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"time"
+
+	badgerdb "github.com/dgraph-io/badger/v2"
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+)
+
+const (
+	// bucketTag starts the key marking that a bucket exists, followed by
+	// the bucket name.
+	bucketTag = 'b'
+	// itemTag starts the key of an item, followed by the length of the
+	// bucket name as a uvarint, the bucket name and the item key.
+	itemTag = 'i'
+
+	// deleteChunk is the number of items DeleteBucket removes per
+	// transaction, which Badger limits in size.
+	deleteChunk = 1000
+)
+
+type Options struct {
+	// Path is the directory holding the database. It is ignored with
+	// InMemory set.
+	Path     string
+	InMemory bool
+	Codec    encoding.Codec
+}
+
+var DefaultOptions = Options{
+	Path:  "gokv.badger",
+	Codec: encoding.JSON,
+}
+
+// Store keeps all buckets in a single Badger database, each under its
+// own key prefix, so that writes go to the LSM tree without contending
+// for a single writer.
+//
+// Items expire through Badger's own TTL, which counts in whole seconds:
+// an item lives at least its TTL and less than a second longer. Expired
+// items are dropped by compaction.
+type Store struct {
+	db    *badgerdb.DB
+	path  string
+	codec encoding.Codec
+	feed  *util.Feed
+	// txn is the read transaction shared by the reads of a View.
+	txn *badgerdb.Txn
+}
+
+var _ gokv.StoreWithContext = (*Store)(nil)
+
+func NewStore(options Options) (*Store, error) {
+	if options.Path == "" {
+		options.Path = DefaultOptions.Path
+	}
+	if options.Codec == nil {
+		options.Codec = DefaultOptions.Codec
+	}
+
+	opts := badgerdb.DefaultOptions(options.Path).WithLogger(nil)
+	if options.InMemory {
+		opts = badgerdb.DefaultOptions("").WithInMemory(true).WithLogger(nil)
+	}
+	db, err := badgerdb.Open(opts)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	return &Store{
+		db:    db,
+		path:  options.Path,
+		codec: options.Codec,
+		feed:  &util.Feed{},
+	}, nil
+}
+
+func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		return w.put(input.BucketName, input.Key, data, input.TTL)
+	})
+}
+
+// BatchSet writes all pairs atomically in a single transaction, which
+// fails with gokv.ErrTooLarge beyond the batch size Badger allows.
+func (s Store) BatchSet(input types.BatchSetItemInput) error {
+	return s.BatchSetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := reflect.ValueOf(input.Values)
+	datas := make([][]byte, len(input.Keys))
+	for i := range input.Keys {
+		data, err := s.codec.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		datas[i] = data
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		for i, key := range input.Keys {
+			if err := w.put(input.BucketName, key, datas[i], input.TTL); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var data []byte
+	err = s.view(func(txn *badgerdb.Txn) error {
+		var err error
+		data, found, err = get(txn, input.BucketName, input.Key)
+		return err
+	})
+	if err != nil || !found {
+		return false, wrapErr(err)
+	}
+
+	return true, s.codec.Unmarshal(data, input.Value)
+}
+
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+// BatchGetWithContext reads every key from the same snapshot.
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	data := make([][]byte, len(input.Keys))
+	found := make([]bool, len(input.Keys))
+	err := s.view(func(txn *badgerdb.Txn) error {
+		for i, key := range input.Keys {
+			var err error
+			if data[i], found[i], err = get(txn, input.BucketName, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.BatchGetItemOutput{}, wrapErr(err)
+	}
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
+func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
+	if err := util.CheckKey(input.Key); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		deleted, err := w.delete(input.BucketName, input.Key)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return gokv.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+// BatchDeleteWithContext deletes every key within a single transaction.
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	var missing []string
+	err := s.update(ctx, func(w *writer) error {
+		missing = nil
+		for _, key := range input.Keys {
+			deleted, err := w.delete(input.BucketName, key)
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				missing = append(missing, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
+}
+
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		_, found, err := get(w.txn, input.BucketName, input.Key)
+		if err != nil {
+			return err
+		}
+		if found {
+			return gokv.ErrConflict
+		}
+		return w.put(input.BucketName, input.Key, data, input.TTL)
+	})
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	oldData, err := s.codec.Marshal(input.OldValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		current, found, err := get(w.txn, input.BucketName, input.Key)
+		if err != nil {
+			return err
+		}
+		if !found || !bytes.Equal(current, oldData) {
+			return gokv.ErrConflict
+		}
+		return w.put(input.BucketName, input.Key, newData, input.TTL)
+	})
+}
+
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		current, found, err := get(w.txn, input.BucketName, input.Key)
+		if err != nil {
+			return err
+		}
+		if !found || !bytes.Equal(current, data) {
+			return gokv.ErrConflict
+		}
+		_, err = w.delete(input.BucketName, input.Key)
+		return err
+	})
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext evaluates the conditions and applies the ops in order
+// within a single transaction.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	for _, op := range input.Ops {
+		if err := util.CheckBucketName(op.BucketName); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(input.Ops))
+	matches := make([][]byte, len(input.Ops))
+	for i, op := range input.Ops {
+		var err error
+		if op.Type == types.TxnSet {
+			if values[i], err = s.codec.Marshal(op.Value); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if matches[i], err = s.codec.Marshal(op.Match); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.update(ctx, func(w *writer) error {
+		for i, op := range input.Ops {
+			if op.Condition == types.TxnAlways {
+				continue
+			}
+			current, found, err := get(w.txn, op.BucketName, op.Key)
+			if err != nil {
+				return err
+			}
+			if !txnConditionHolds(op, current, found, matches[i]) {
+				return &gokv.TxnConflictError{Index: i, BucketName: op.BucketName, Key: op.Key}
+			}
+		}
+
+		for i, op := range input.Ops {
+			var err error
+			switch op.Type {
+			case types.TxnSet:
+				err = w.put(op.BucketName, op.Key, values[i], op.TTL)
+			case types.TxnDelete:
+				_, err = w.delete(op.BucketName, op.Key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// txnConditionHolds evaluates the condition of op against the live value
+// of its item, matching it against match for TxnMatches.
+func txnConditionHolds(op types.TxnOp, current []byte, found bool, match []byte) bool {
+	switch op.Condition {
+	case types.TxnAlways:
+		return true
+	case types.TxnExists:
+		return found
+	case types.TxnNotExists:
+		return !found
+	case types.TxnMatches:
+		return found && bytes.Equal(current, match)
+	}
+	return false
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext runs fn within a single read-only Badger transaction,
+// so every read of tx sees the same snapshot.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.view(func(txn *badgerdb.Txn) error {
+		s.txn = txn
+		return fn(readTx{ctx: ctx, s: s})
+	})
+}
+
+// view runs fn within the transaction of a View, or a new read-only one.
+func (s Store) view(fn func(txn *badgerdb.Txn) error) error {
+	if s.txn != nil {
+		return fn(s.txn)
+	}
+	return s.db.View(fn)
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+// DeleteBucketWithContext removes the bucket and its items in
+// transactions of deleteChunk items each, so a bucket holding more items
+// is not removed atomically, and items written to it meanwhile may be
+// removed as well.
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	marker := bucketKey(input.BucketName)
+	for first := true; ; first = false {
+		var n int
+		err := s.update(ctx, func(w *writer) error {
+			if first {
+				if _, err := w.txn.Get(marker); err == badgerdb.ErrKeyNotFound {
+					return gokv.ErrBucketNotFound
+				} else if err != nil {
+					return err
+				}
+				if err := w.txn.Delete(marker); err != nil {
+					return err
+				}
+			}
+
+			keys, err := bucketKeys(w.txn, input.BucketName, deleteChunk)
+			if err != nil {
+				return err
+			}
+			n = len(keys)
+			for _, key := range keys {
+				if err := w.txn.Delete(itemKey(input.BucketName, key)); err != nil {
+					return err
+				}
+				w.record(types.EventDelete, input.BucketName, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if n < deleteChunk {
+			return nil
+		}
+	}
+}
+
+func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext seeks an iterator over the prefix of the bucket to the
+// first candidate key, and stops it at EndKey or at the end of the keys
+// starting with Prefix.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	var start string
+	if input.StartToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(input.StartToken)
+		if err != nil || len(b) == 0 {
+			return types.ScanOutput{}, util.ErrInvalidToken
+		}
+		start = string(b)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	// seek straight to the first candidate
+	seek := start
+	for _, bound := range []string{input.Prefix, input.StartKey} {
+		if bound > seek {
+			seek = bound
+		}
+	}
+
+	var out types.ScanOutput
+	err := s.view(func(txn *badgerdb.Txn) error {
+		prefix := itemPrefix(input.BucketName)
+		opts := badgerdb.DefaultIteratorOptions
+		opts.Prefix = append(prefix, input.Prefix...)
+		opts.PrefetchSize = 16
+		if input.Limit > 0 && input.Limit < opts.PrefetchSize {
+			opts.PrefetchSize = input.Limit + 1
+		}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(itemKey(input.BucketName, seek)); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			item := it.Item()
+			key := string(item.Key()[len(prefix):])
+			if input.EndKey != "" && key >= input.EndKey {
+				break
+			}
+
+			if input.Limit > 0 && len(out.Keys) == input.Limit {
+				out.NextToken = base64.RawURLEncoding.EncodeToString([]byte(key))
+				break
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			out.Keys = append(out.Keys, key)
+			out.Values = append(out.Values, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return types.ScanOutput{}, wrapErr(err)
+	}
+	return out, nil
+}
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext reports the changes committed through this Store and
+// its copies. Compaction drops expired items silently, so they are never
+// reported. StartToken is not supported.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.feed.Subscribe(ctx, input)
+}
+
+// Close closes the database.
+func (s Store) Close() error {
+	return s.db.Close()
+}
+
+func (s Store) Info() (types.StoreInfo, error) {
+	return s.InfoWithContext(context.Background())
+}
+
+// InfoWithContext reports the size of the LSM tree and value log as
+// Size, as last computed by Badger, which does so once a minute.
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return types.StoreInfo{}, err
+	}
+
+	lsm, vlog := s.db.Size()
+	info := types.StoreInfo{
+		Name:      s.path,
+		Size:      lsm + vlog,
+		UsedBytes: lsm + vlog,
+	}
+
+	var err error
+	if info.Buckets, err = s.ListBucketsWithContext(ctx); err != nil {
+		return types.StoreInfo{}, err
+	}
+	for _, bi := range info.Buckets {
+		info.Items += bi.Items
+	}
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext describes every bucket, sorted by name, from
+// the same snapshot.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buckets []types.BucketInfo
+	err := s.view(func(txn *badgerdb.Txn) error {
+		opts := badgerdb.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte{bucketTag}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			info, err := bucketInfo(txn, string(it.Item().Key()[1:]))
+			if err != nil {
+				return err
+			}
+			buckets = append(buckets, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return buckets, nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+// BucketInfoWithContext counts the items of the bucket. Their size is
+// estimated from the size Badger records for their values, without
+// reading those from the value log.
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	var info types.BucketInfo
+	err := s.view(func(txn *badgerdb.Txn) error {
+		if _, err := txn.Get(bucketKey(input.BucketName)); err == badgerdb.ErrKeyNotFound {
+			return gokv.ErrBucketNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var err error
+		info, err = bucketInfo(txn, input.BucketName)
+		return err
+	})
+	if err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+	return info, nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err := s.view(func(txn *badgerdb.Txn) error {
+		_, err := txn.Get(itemKey(input.BucketName, input.Key))
+		if err == badgerdb.ErrKeyNotFound {
+			return nil
+		}
+		exists = err == nil
+		return err
+	})
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return exists, nil
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+// CountWithContext iterates over the keys of the bucket, without reading
+// the values.
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err := s.view(func(txn *badgerdb.Txn) error {
+		info, err := bucketInfo(txn, input.BucketName)
+		n = info.Items
+		return err
+	})
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext reads, updates and writes back the counter within
+// a single transaction, which is retried if another one changed the
+// counter meanwhile. The counter keeps its expiration time.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err := s.update(ctx, func(w *writer) error {
+		var data []byte
+		var expires uint64
+		item, err := w.txn.Get(itemKey(input.BucketName, input.Key))
+		if err == nil {
+			if data, err = item.ValueCopy(nil); err != nil {
+				return err
+			}
+			expires = item.ExpiresAt()
+		} else if err != badgerdb.ErrKeyNotFound {
+			return err
+		}
+
+		if n, data, err = util.Increment(data, input.Delta); err != nil {
+			return err
+		}
+		return w.putAt(input.BucketName, input.Key, data, expires)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+// update runs fn within a read-write transaction. Badger fails the commit
+// if another transaction changed a key fn read, in which case fn runs
+// again on a fresh snapshot. The events recorded by the run that commits
+// are published.
+func (s Store) update(ctx context.Context, fn func(w *writer) error) error {
+	for {
+		w := &writer{}
+		err := s.db.Update(func(txn *badgerdb.Txn) error {
+			w.txn = txn
+			return fn(w)
+		})
+		if err == badgerdb.ErrConflict {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return wrapErr(err)
+		}
+
+		for _, ev := range w.events {
+			s.feed.Publish(ev)
+		}
+		return nil
+	}
+}
+
+// writer is the state of a transaction run by update.
+type writer struct {
+	txn    *badgerdb.Txn
+	events []types.Event
+}
+
+func (w *writer) record(typ types.EventType, bucketName, key string) {
+	w.events = append(w.events, types.Event{Type: typ, BucketName: bucketName, Key: key})
+}
+
+// put writes the item, creating its bucket if needed.
+func (w *writer) put(bucketName, key string, data []byte, ttl time.Duration) error {
+	return w.putAt(bucketName, key, data, expiresAt(time.Now(), ttl))
+}
+
+// putAt writes the item expiring at the Unix time expires, which is zero
+// for an item that never expires, creating its bucket if needed.
+func (w *writer) putAt(bucketName, key string, data []byte, expires uint64) error {
+	marker := bucketKey(bucketName)
+	if _, err := w.txn.Get(marker); err == badgerdb.ErrKeyNotFound {
+		if err := w.txn.Set(marker, nil); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	e := badgerdb.NewEntry(itemKey(bucketName, key), data)
+	e.ExpiresAt = expires
+	if err := w.txn.SetEntry(e); err != nil {
+		return err
+	}
+	w.record(types.EventPut, bucketName, key)
+	return nil
+}
+
+// delete deletes the item, reporting whether it was live.
+func (w *writer) delete(bucketName, key string) (bool, error) {
+	k := itemKey(bucketName, key)
+	if _, err := w.txn.Get(k); err == badgerdb.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := w.txn.Delete(k); err != nil {
+		return false, err
+	}
+	w.record(types.EventDelete, bucketName, key)
+	return true, nil
+}
+
+// get reads the live value of key within txn, reporting whether it was
+// found.
+func get(txn *badgerdb.Txn, bucketName, key string) ([]byte, bool, error) {
+	item, err := txn.Get(itemKey(bucketName, key))
+	if err == badgerdb.ErrKeyNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// bucketInfo counts the live items of the bucket and estimates their size.
+func bucketInfo(txn *badgerdb.Txn, bucketName string) (types.BucketInfo, error) {
+	info := types.BucketInfo{Name: bucketName}
+
+	prefix := itemPrefix(bucketName)
+	opts := badgerdb.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		info.Items++
+		info.Size += item.KeySize() - int64(len(prefix)) + item.ValueSize()
+	}
+	return info, nil
+}
+
+// bucketKeys returns up to n keys of the live items of the bucket.
+func bucketKeys(txn *badgerdb.Txn, bucketName string, n int) ([]string, error) {
+	prefix := itemPrefix(bucketName)
+	opts := badgerdb.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var keys []string
+	for it.Rewind(); it.Valid() && len(keys) < n; it.Next() {
+		keys = append(keys, string(it.Item().Key()[len(prefix):]))
+	}
+	return keys, nil
+}
+
+func bucketKey(bucketName string) []byte {
+	return append([]byte{bucketTag}, bucketName...)
+}
+
+// itemPrefix returns the prefix shared by the keys of the items of the
+// bucket. The length of the bucket name keeps it from being a prefix of
+// the keys of any other bucket.
+func itemPrefix(bucketName string) []byte {
+	prefix := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(bucketName))
+	prefix[0] = itemTag
+	n := binary.PutUvarint(prefix[1:], uint64(len(bucketName)))
+	return append(prefix[:1+n], bucketName...)
+}
+
+func itemKey(bucketName, key string) []byte {
+	return append(itemPrefix(bucketName), key...)
+}
+
+// expiresAt returns the expiration time Badger records for an item
+// written at now with ttl, rounded up to the second so that the item
+// never expires early. It is 0 for a ttl <= 0.
+func expiresAt(now time.Time, ttl time.Duration) uint64 {
+	if ttl <= 0 {
+		return 0
+	}
+	t := now.Add(ttl)
+	sec := t.Unix()
+	if t.Nanosecond() > 0 {
+		sec++
+	}
+	return uint64(sec)
+}
+
+// wrapErr maps errors returned by Badger onto their gokv equivalents.
+func wrapErr(err error) error {
+	switch {
+	case errors.Is(err, badgerdb.ErrTxnTooBig):
+		return gokv.Wrap(gokv.ErrTooLarge, err)
+	case errors.Is(err, badgerdb.ErrDBClosed):
+		return gokv.Wrap(gokv.ErrUnavailable, err)
+	}
+	return err
+}
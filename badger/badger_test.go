@@ -0,0 +1,214 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStoreWithCodec(codec encoding.Codec) (*Store, string, error) {
+	dir, err := ioutil.TempDir("", "Badger_TestStore-*")
+	if err != nil {
+		return nil, "", err
+	}
+
+	s, err := NewStore(Options{Path: dir, Codec: codec})
+	return s, dir, err
+}
+
+func setupStore(t *testing.T) (*Store, func()) {
+	s, dir, err := setupStoreWithCodec(encoding.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		_ = s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Close())
+
+	// items survive a restart
+	s, err := NewStore(Options{Path: s.path})
+	assert.NoError(t, err)
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "val", v)
+}
+
+func TestItemKey(t *testing.T) {
+	assert.Equal(t, []byte("i\x03fooa"), itemKey("foo", "a"))
+	assert.Equal(t, []byte("bfoo"), bucketKey("foo"))
+
+	// no bucket's prefix is a prefix of another's
+	assert.NotEqual(t, itemKey("fo", "oa")[:4], itemPrefix("foo")[:4])
+}
+
+func TestStore_BucketPrefixes(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "fo", Key: "oa", Value: "val"}))
+
+	out, err := s.Scan(types.ScanInput{BucketName: "fo"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"oa"}, out.Keys)
+
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestStore_Scan(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	keys := []string{"d", "a", "c", "b", "e", "b\xff"}
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: keys, Values: []string{"1", "2", "3", "4", "5", "6"}}))
+
+	out, err := s.Scan(types.ScanInput{BucketName: "foo", Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "b\xff"}, out.Keys)
+	assert.Equal(t, [][]byte{[]byte(`"2"`), []byte(`"4"`), []byte(`"6"`)}, out.Values)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: out.NextToken})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d", "e"}, out.Keys)
+	assert.Empty(t, out.NextToken)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", Prefix: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "b\xff"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartKey: "b\x00", EndKey: "d"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b\xff", "c"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "missing"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Keys)
+
+	_, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: "!"})
+	assert.Equal(t, util.ErrInvalidToken, err)
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Unix(100, 0)
+	assert.Equal(t, uint64(0), expiresAt(now, 0))
+	assert.Equal(t, uint64(101), expiresAt(now, time.Second))
+	// partial seconds are rounded up
+	assert.Equal(t, uint64(101), expiresAt(now, time.Nanosecond))
+	assert.Equal(t, uint64(102), expiresAt(now.Add(500*time.Millisecond), time.Second))
+}
+
+func TestStore_TTL(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Nanosecond}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "c", Value: "val"}))
+	time.Sleep(time.Second)
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	exists, err := s.Exists(types.ExistsInput{BucketName: "foo", Key: "a"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	out, err := s.Scan(types.ScanInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, out.Keys)
+
+	// an expired item does not block SetIfNotExists
+	assert.NoError(t, s.SetIfNotExists(types.SetItemInput{BucketName: "foo", Key: "a", Value: "new"}))
+}
+
+func TestStore_Info(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "a", Value: "value"}))
+
+	info, err := s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, s.path, info.Name)
+	assert.Equal(t, int64(3), info.Items)
+	assert.Equal(t, []types.BucketInfo{
+		{Name: "bar", Items: 1, Size: 8},
+		{Name: "foo", Items: 2, Size: 12},
+	}, info.Buckets)
+
+	_, err = s.BucketInfo(types.BucketInfoInput{BucketName: "missing"})
+	assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+}
+
+func TestStore_DeleteBucket(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	// more items than fit in a single deletion
+	keys := make([]string, deleteChunk+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%04d", i)
+	}
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: keys, Values: keys}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "a", Value: "val"}))
+
+	assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"}))
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	buckets, err := s.ListBuckets()
+	assert.NoError(t, err)
+	assert.Equal(t, []types.BucketInfo{{Name: "bar", Items: 1, Size: 6}}, buckets)
+
+	err = s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"})
+	assert.Equal(t, gokv.ErrBucketNotFound, err)
+}
+
+func TestStore_TxnTooBig(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	keys := make([]string, s.db.MaxBatchCount())
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%07d", i)
+	}
+	err := s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: keys, Values: keys})
+	assert.True(t, errors.Is(err, gokv.ErrTooLarge))
+
+	// nothing is written
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
@@ -2,10 +2,14 @@ package bbolt
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
 	"os"
+	"reflect"
 	"time"
 
+	"github.com/simar7/gokv"
 	"github.com/simar7/gokv/types"
 
 	"github.com/simar7/gokv/encoding"
@@ -14,17 +18,34 @@ import (
 )
 
 var (
+	// Deprecated: BatchSet accepts multiple keys, this error is no longer returned.
 	ErrMultipleKVNotSupported = errors.New("multiple kv pair not supported")
-	ErrBucketNotFound         = errors.New("bucket not found")
+	ErrBucketNotFound         = gokv.ErrBucketNotFound
 	ErrBucketCreationFailed   = errors.New("bucket creation failed")
 )
 
+// ctxCheckInterval is the number of cursor steps taken between
+// checks of the context during long running iterations.
+const ctxCheckInterval = 1000
+
+const (
+	// ttlBucketSuffix names the sibling bucket indexing insertion times
+	// of items when a store wide ItemTTL is configured.
+	ttlBucketSuffix = "_ttlBucket"
+	// expiryBucketSuffix names the sibling bucket holding the
+	// expiration time of every item set with a per-item TTL.
+	expiryBucketSuffix = "_expiryBucket"
+)
+
 type Options struct {
 	DB             *bolt.DB
 	RootBucketName string
 	Path           string
 	Codec          encoding.Codec
 	ItemTTL        time.Duration
+	// ChangeLogSize is the number of changes kept on disk for Watch to
+	// resume from. Zero disables the change log.
+	ChangeLogSize int
 }
 
 var DefaultOptions = Options{
@@ -46,8 +67,14 @@ type Store struct {
 	bucketName string
 	codec      encoding.Codec
 	ttl        time.Duration
+	// tx is the read-only transaction shared by the reads of a View.
+	tx            *bolt.Tx
+	feed          *util.Feed
+	changeLogSize int
 }
 
+var _ gokv.StoreWithContext = (*Store)(nil)
+
 func NewStore(options Options) (*Store, error) {
 	result := Store{}
 
@@ -90,6 +117,8 @@ func NewStore(options Options) (*Store, error) {
 	result.dbPath = options.Path
 	result.codec = options.Codec
 	result.ttl = options.ItemTTL
+	result.feed = &util.Feed{}
+	result.changeLogSize = options.ChangeLogSize
 	return &result, nil
 }
 
@@ -99,6 +128,7 @@ func (s *Store) GetStoreOptions() Options {
 		RootBucketName: s.rbc.Name,
 		Path:           s.dbPath,
 		Codec:          s.codec,
+		ChangeLogSize:  s.changeLogSize,
 	}
 }
 
@@ -115,7 +145,7 @@ func (s *Store) createBucketIfNotExists(bucketName string) error {
 		}
 
 		if s.ttl > 0 {
-			_, err = root.CreateBucketIfNotExists([]byte(bucketName + "_ttlBucket"))
+			_, err = root.CreateBucketIfNotExists([]byte(bucketName + ttlBucketSuffix))
 			if err != nil {
 				return err
 			}
@@ -123,16 +153,24 @@ func (s *Store) createBucketIfNotExists(bucketName string) error {
 		return nil
 	})
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 	return nil
 }
 
 func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
 	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
 		return err
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	err := s.createBucketIfNotExists(input.BucketName) // TODO: Can we move this inside s.db.Update()?
 	if err != nil {
 		return err
@@ -144,74 +182,119 @@ func (s Store) Set(input types.SetItemInput) error {
 	}
 
 	err = s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
 		var b *bolt.Bucket
-		if b = tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(input.BucketName)); b == nil { // Untested
+		if b = root.Bucket([]byte(input.BucketName)); b == nil { // Untested
 			return ErrBucketNotFound
 		}
-		return b.Put([]byte(input.Key), data)
+		if err := b.Put([]byte(input.Key), data); err != nil {
+			return err
+		}
+		if err := setExpiry(root, input.BucketName, []byte(input.Key), input.TTL); err != nil {
+			return err
+		}
+		return s.recordChange(tx, types.EventPut, input.BucketName, []byte(input.Key))
 	})
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
 	// set TTL on items if exists
 	if s.ttl > 0 {
 		err = s.db.Update(func(tx *bolt.Tx) error {
 			var b *bolt.Bucket
-			if b = tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(input.BucketName + "_ttlBucket")); b == nil { // Untested
+			if b = tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(input.BucketName + ttlBucketSuffix)); b == nil { // Untested
 				return ErrBucketNotFound
 			}
 			return b.Put([]byte(time.Now().UTC().Format(time.RFC3339Nano)), []byte(input.Key))
 		})
 		if err != nil {
-			return err
+			return wrapErr(err)
 		}
 	}
 	return nil
 }
 
-// boltdb batch operations work on single kv pair
-// but across multiple go routines. As a result, in this case
-// we cannot accept multiple keys.
+// BatchSet writes all pairs atomically in a single transaction. Concurrent
+// calls are coalesced by boltdb into fewer transactions via db.Batch.
 func (s Store) BatchSet(input types.BatchSetItemInput) error {
-	if len(input.Keys) > 1 {
-		return ErrMultipleKVNotSupported
+	return s.BatchSetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
 	}
 
-	data, err := s.codec.Marshal(input.Values)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	err = s.db.Batch(func(tx *bolt.Tx) error {
+	values := reflect.ValueOf(input.Values)
+	datas := make([][]byte, len(input.Keys))
+	for i := range input.Keys {
+		data, err := s.codec.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		datas[i] = data
+	}
+
+	err := s.db.Batch(func(tx *bolt.Tx) error {
 		var b, b2 *bolt.Bucket
 		if b = tx.Bucket([]byte(s.rbc.Name)); b == nil { // Untested
 			return ErrBucketNotFound
 		}
 
+		var err error
 		if b2, err = b.CreateBucketIfNotExists([]byte(input.BucketName)); err != nil { // Untested
-			return ErrBucketCreationFailed
+			return &bucketCreationError{err: err}
 		}
 
-		return b2.Put([]byte(input.Keys[0]), data)
+		for i, key := range input.Keys {
+			if err := b2.Put([]byte(key), datas[i]); err != nil {
+				return err
+			}
+			if err := setExpiry(b, input.BucketName, []byte(key), input.TTL); err != nil {
+				return err
+			}
+			if err := s.recordChange(tx, types.EventPut, input.BucketName, []byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 	return nil
 }
 
 func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
 	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
 		return false, err
 	}
 
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
 	var data []byte
-	err = s.db.View(func(tx *bolt.Tx) error {
+	err = s.view(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
 		var b *bolt.Bucket
-		if b = tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(input.BucketName)); b == nil {
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
 			return ErrBucketNotFound
 		}
+		if isExpired(root.Bucket([]byte(input.BucketName+expiryBucketSuffix)), []byte(input.Key), time.Now()) {
+			return nil
+		}
 		txData := b.Get([]byte(input.Key))
 		if txData != nil {
 			data = append([]byte{}, txData...)
@@ -219,7 +302,7 @@ func (s Store) Get(input types.GetItemInput) (found bool, err error) {
 		return nil
 	})
 	if err != nil {
-		return false, err
+		return false, wrapErr(err)
 	}
 
 	if data == nil {
@@ -229,63 +312,549 @@ func (s Store) Get(input types.GetItemInput) (found bool, err error) {
 	return true, s.codec.Unmarshal(data, input.Value)
 }
 
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+// BatchGetWithContext reads every key within a single read transaction.
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	data := make([][]byte, len(input.Keys))
+	found := make([]bool, len(input.Keys))
+	err := s.view(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		var b *bolt.Bucket
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
+			return ErrBucketNotFound
+		}
+		expiryB := root.Bucket([]byte(input.BucketName + expiryBucketSuffix))
+		now := time.Now()
+
+		for i, key := range input.Keys {
+			if isExpired(expiryB, []byte(key), now) {
+				continue
+			}
+			if txData := b.Get([]byte(key)); txData != nil {
+				data[i] = append([]byte{}, txData...)
+				found[i] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.BatchGetItemOutput{}, wrapErr(err)
+	}
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
 func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
 	if err := util.CheckKey(input.Key); err != nil {
 		return err
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		var b *bolt.Bucket
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
+			return ErrBucketNotFound
+		}
+		expiryB := root.Bucket([]byte(input.BucketName + expiryBucketSuffix))
+		if b.Get([]byte(input.Key)) == nil || isExpired(expiryB, []byte(input.Key), time.Now()) {
+			return gokv.ErrNotFound
+		}
+		if expiryB != nil {
+			if err := expiryB.Delete([]byte(input.Key)); err != nil {
+				return err
+			}
+		}
+		if err := b.Delete([]byte(input.Key)); err != nil {
+			return err
+		}
+		return s.recordChange(tx, types.EventDelete, input.BucketName, []byte(input.Key))
+	}))
+}
+
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+// BatchDeleteWithContext deletes every key within a single write transaction.
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	var missing []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
 		var b *bolt.Bucket
-		if b = tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(input.BucketName)); b == nil {
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
 			return ErrBucketNotFound
 		}
-		return b.Delete([]byte(input.Key))
+		expiryB := root.Bucket([]byte(input.BucketName + expiryBucketSuffix))
+		now := time.Now()
+
+		missing = nil // Update may be retried
+		for _, key := range input.Keys {
+			if b.Get([]byte(key)) == nil || isExpired(expiryB, []byte(key), now) {
+				missing = append(missing, key)
+			} else if err := s.recordChange(tx, types.EventDelete, input.BucketName, []byte(key)); err != nil {
+				return err
+			}
+			if expiryB != nil {
+				if err := expiryB.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	if err != nil {
+		return types.BatchDeleteItemOutput{}, wrapErr(err)
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
+}
+
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		b, err := root.CreateBucketIfNotExists([]byte(input.BucketName))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(input.Key)) != nil && !isExpired(root.Bucket([]byte(input.BucketName+expiryBucketSuffix)), []byte(input.Key), time.Now()) {
+			return gokv.ErrConflict
+		}
+		if err := b.Put([]byte(input.Key), data); err != nil {
+			return err
+		}
+		if err := setExpiry(root, input.BucketName, []byte(input.Key), input.TTL); err != nil {
+			return err
+		}
+		return s.recordChange(tx, types.EventPut, input.BucketName, []byte(input.Key))
+	}))
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	oldData, err := s.codec.Marshal(input.OldValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
+	}
+
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+		b, err := checkValue(root, input.BucketName, input.Key, oldData)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(input.Key), newData); err != nil {
+			return err
+		}
+		if err := setExpiry(root, input.BucketName, []byte(input.Key), input.TTL); err != nil {
+			return err
+		}
+		return s.recordChange(tx, types.EventPut, input.BucketName, []byte(input.Key))
+	}))
+}
+
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+		b, err := checkValue(root, input.BucketName, input.Key, data)
+		if err != nil {
+			return err
+		}
+		if err := setExpiry(root, input.BucketName, []byte(input.Key), 0); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte(input.Key)); err != nil {
+			return err
+		}
+		return s.recordChange(tx, types.EventDelete, input.BucketName, []byte(input.Key))
+	}))
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext evaluates the conditions and applies the ops in order
+// within a single read-write transaction.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(input.Ops))
+	matches := make([][]byte, len(input.Ops))
+	for i, op := range input.Ops {
+		var err error
+		if op.Type == types.TxnSet {
+			if values[i], err = s.codec.Marshal(op.Value); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if matches[i], err = s.codec.Marshal(op.Match); err != nil {
+				return err
+			}
+		}
+	}
+
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+		now := time.Now()
+
+		for i, op := range input.Ops {
+			if !txnConditionHolds(root, op, matches[i], now) {
+				return &gokv.TxnConflictError{Index: i, BucketName: op.BucketName, Key: op.Key}
+			}
+		}
+
+		for i, op := range input.Ops {
+			key := []byte(op.Key)
+			switch op.Type {
+			case types.TxnSet:
+				b, err := root.CreateBucketIfNotExists([]byte(op.BucketName))
+				if err != nil {
+					return &bucketCreationError{err: err}
+				}
+				if err := b.Put(key, values[i]); err != nil {
+					return err
+				}
+				if err := setExpiry(root, op.BucketName, key, op.TTL); err != nil {
+					return err
+				}
+				if err := s.recordChange(tx, types.EventPut, op.BucketName, key); err != nil {
+					return err
+				}
+			case types.TxnDelete:
+				b := root.Bucket([]byte(op.BucketName))
+				if b == nil || b.Get(key) == nil {
+					continue
+				}
+				live := !isExpired(root.Bucket([]byte(op.BucketName+expiryBucketSuffix)), key, now)
+				if err := setExpiry(root, op.BucketName, key, 0); err != nil {
+					return err
+				}
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+				if live {
+					if err := s.recordChange(tx, types.EventDelete, op.BucketName, key); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}))
+}
+
+// txnConditionHolds evaluates the condition of op, matching the live
+// value of its item against match for TxnMatches.
+func txnConditionHolds(root *bolt.Bucket, op types.TxnOp, match []byte, now time.Time) bool {
+	if op.Condition == types.TxnAlways {
+		return true
+	}
+
+	var current []byte
+	if b := root.Bucket([]byte(op.BucketName)); b != nil {
+		current = b.Get([]byte(op.Key))
+		if current != nil && isExpired(root.Bucket([]byte(op.BucketName+expiryBucketSuffix)), []byte(op.Key), now) {
+			current = nil
+		}
+	}
+
+	switch op.Condition {
+	case types.TxnExists:
+		return current != nil
+	case types.TxnNotExists:
+		return current == nil
+	case types.TxnMatches:
+		return current != nil && bytes.Equal(current, match)
+	}
+	return false
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext runs fn within a single read-only transaction, so every
+// read of tx sees the same snapshot of the database. fn must not write to
+// the store, as bbolt can deadlock when a goroutine holding a read-only
+// transaction starts a write that grows the database file.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		s.tx = tx
+		return fn(readTx{ctx: ctx, s: s})
+	})
+}
+
+// view runs fn within the transaction of a View, or a new read-only one.
+func (s Store) view(fn func(tx *bolt.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	return s.db.View(fn)
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+// checkValue returns the bucket holding key if its live value equals data,
+// and ErrConflict otherwise.
+func checkValue(root *bolt.Bucket, bucketName, key string, data []byte) (*bolt.Bucket, error) {
+	var b *bolt.Bucket
+	if b = root.Bucket([]byte(bucketName)); b == nil {
+		return nil, ErrBucketNotFound
+	}
+
+	current := b.Get([]byte(key))
+	if current == nil || !bytes.Equal(current, data) ||
+		isExpired(root.Bucket([]byte(bucketName+expiryBucketSuffix)), []byte(key), time.Now()) {
+		return nil, gokv.ErrConflict
+	}
+	return b, nil
 }
 
 func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
 	if err := util.CheckBucketName(input.BucketName); err != nil {
 		return err
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
 		var b *bolt.Bucket
 		if b = tx.Bucket([]byte(s.rbc.Name)); b == nil {
 			return ErrBucketNotFound
 		}
-		return b.DeleteBucket([]byte(input.BucketName))
-	})
+		if items := b.Bucket([]byte(input.BucketName)); items != nil {
+			expiryB := b.Bucket([]byte(input.BucketName + expiryBucketSuffix))
+			now := time.Now()
+			if err := items.ForEach(func(k, _ []byte) error {
+				if isExpired(expiryB, k, now) {
+					return nil
+				}
+				return s.recordChange(tx, types.EventDelete, input.BucketName, k)
+			}); err != nil {
+				return err
+			}
+		}
+		if err := b.DeleteBucket([]byte(input.BucketName)); err != nil {
+			return err
+		}
+
+		// drop the bookkeeping buckets along with the items
+		for _, suffix := range []string{ttlBucketSuffix, expiryBucketSuffix} {
+			if err := b.DeleteBucket([]byte(input.BucketName + suffix)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	}))
 }
 
 func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext periodically checks ctx while walking the bucket
+// and aborts the read transaction once ctx is done.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
 	if err := util.CheckBucketName(input.BucketName); err != nil {
 		return types.ScanOutput{}, err
 	}
 
+	var start []byte
+	if input.StartToken != "" {
+		var err error
+		if start, err = base64.RawURLEncoding.DecodeString(input.StartToken); err != nil || len(start) == 0 {
+			return types.ScanOutput{}, util.ErrInvalidToken
+		}
+	}
+
 	var keys []string
 	var values [][]byte
+	var nextToken string
+
+	if err := s.view(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
 
-	if err := s.db.View(func(tx *bolt.Tx) error {
 		var b *bolt.Bucket
-		if b = tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(input.BucketName)); b == nil {
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
 			return ErrBucketNotFound
 		}
+		expiryB := root.Bucket([]byte(input.BucketName + expiryBucketSuffix))
+		now := time.Now()
+
+		// keys are sorted, so seek straight to the first candidate
+		seek := start
+		for _, bound := range [][]byte{[]byte(input.Prefix), []byte(input.StartKey)} {
+			if bytes.Compare(bound, seek) > 0 {
+				seek = bound
+			}
+		}
+
+		c := b.Cursor()
+		k, v := c.First()
+		if seek != nil {
+			k, v = c.Seek(seek)
+		}
+
+		n := 0
+		for ; k != nil; k, v = c.Next() {
+			if n%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			n++
+
+			if !bytes.HasPrefix(k, []byte(input.Prefix)) ||
+				(input.EndKey != "" && bytes.Compare(k, []byte(input.EndKey)) >= 0) {
+				break
+			}
+
+			if isExpired(expiryB, k, now) {
+				continue
+			}
+
+			if input.Limit > 0 && len(keys) == input.Limit {
+				nextToken = base64.RawURLEncoding.EncodeToString(k)
+				break
+			}
 
-		if err := b.ForEach(func(k, v []byte) error {
 			keys = append(keys, string(k))
-			values = append(values, v)
-			return nil
-		}); err != nil {
-			return err
+			values = append(values, append([]byte{}, v...))
 		}
 		return nil
 	}); err != nil {
-		return types.ScanOutput{}, err
+		return types.ScanOutput{}, wrapErr(err)
 	}
 
 	return types.ScanOutput{
-		Keys:   keys,
-		Values: values,
+		Keys:      keys,
+		Values:    values,
+		NextToken: nextToken,
 	}, nil
 }
 
@@ -294,25 +863,272 @@ func (s Store) Close() error {
 }
 
 func (s Store) Info() (types.StoreInfo, error) {
+	return s.InfoWithContext(context.Background())
+}
+
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return types.StoreInfo{}, err
+	}
+
 	f, err := os.Stat(s.dbPath)
 	if err != nil {
 		return types.StoreInfo{}, err
 	}
 
-	return types.StoreInfo{
+	info := types.StoreInfo{
 		Name: s.rbc.Name,
 		Size: f.Size(),
-	}, nil
+	}
+
+	if info.Buckets, err = s.ListBucketsWithContext(ctx); err != nil {
+		return types.StoreInfo{}, err
+	}
+	for _, bi := range info.Buckets {
+		info.Items += bi.Items
+	}
+
+	// pages freed by past transactions stay in the file for reuse
+	stats := s.db.Stats()
+	info.FreeBytes = int64(stats.FreePageN+stats.PendingPageN) * int64(s.db.Info().PageSize)
+	info.UsedBytes = info.Size - info.FreeBytes
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext walks the root bucket, skipping
+// the bookkeeping buckets kept next to the item buckets.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var buckets []types.BucketInfo
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+		if root == nil {
+			return ErrBucketNotFound
+		}
+		return root.ForEach(func(k, v []byte) error {
+			// nested buckets have a nil value
+			if v != nil || isInternalBucket(k) {
+				return nil
+			}
+			buckets = append(buckets, bucketInfo(root.Bucket(k), string(k)))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return buckets, nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	var info types.BucketInfo
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+		if root == nil || isInternalBucket([]byte(input.BucketName)) {
+			return ErrBucketNotFound
+		}
+
+		var b *bolt.Bucket
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
+			return ErrBucketNotFound
+		}
+		info = bucketInfo(b, input.BucketName)
+		return nil
+	})
+	if err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+	return info, nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		var b *bolt.Bucket
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
+			return nil
+		}
+		exists = b.Get([]byte(input.Key)) != nil &&
+			!isExpired(root.Bucket([]byte(input.BucketName+expiryBucketSuffix)), []byte(input.Key), time.Now())
+		return nil
+	})
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return exists, nil
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+// CountWithContext takes the number of keys from the bucket statistics and
+// subtracts the expired items, which are found in the expiry bucket.
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		var b *bolt.Bucket
+		if b = root.Bucket([]byte(input.BucketName)); b == nil {
+			return nil
+		}
+		n = int64(b.Stats().KeyN)
+
+		expiryB := root.Bucket([]byte(input.BucketName + expiryBucketSuffix))
+		if expiryB == nil {
+			return nil
+		}
+		now := time.Now()
+		return expiryB.ForEach(func(k, _ []byte) error {
+			if b.Get(k) != nil && isExpired(expiryB, k, now) {
+				n--
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext reads, updates and writes back the counter
+// within a single read-write transaction. The expiration time of a
+// live counter is kept, while that of an expired one is dropped.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		b, err := root.CreateBucketIfNotExists([]byte(input.BucketName))
+		if err != nil {
+			return &bucketCreationError{err: err}
+		}
+
+		key := []byte(input.Key)
+		data := b.Get(key)
+		if data != nil && isExpired(root.Bucket([]byte(input.BucketName+expiryBucketSuffix)), key, time.Now()) {
+			if err := setExpiry(root, input.BucketName, key, 0); err != nil {
+				return err
+			}
+			data = nil
+		}
+
+		if n, data, err = util.Increment(data, input.Delta); err != nil {
+			return err
+		}
+		if err := b.Put(key, data); err != nil {
+			return err
+		}
+		return s.recordChange(tx, types.EventPut, input.BucketName, key)
+	})
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, nil
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+// isInternalBucket reports whether name is one of the
+// bookkeeping buckets kept next to the item buckets.
+func isInternalBucket(name []byte) bool {
+	return bytes.HasSuffix(name, []byte(ttlBucketSuffix)) ||
+		bytes.HasSuffix(name, []byte(expiryBucketSuffix))
+}
+
+// bucketInfo describes the item bucket b. Items that expired but have
+// not been reaped yet are still counted.
+func bucketInfo(b *bolt.Bucket, name string) types.BucketInfo {
+	stats := b.Stats()
+	return types.BucketInfo{
+		Name:  name,
+		Items: int64(stats.KeyN),
+		Size:  int64(stats.LeafInuse + stats.BranchInuse + stats.InlineBucketInuse),
+	}
 }
 
 // BoltDB does not support builtin item expiration
 // Reap takes care of handling TTL for items in BoltDB
 func (s Store) Reap(itemBucket string) error {
+	if err := s.reapExpired(itemBucket); err != nil {
+		return err
+	}
+
 	if s.ttl <= 0 {
 		return nil
 	}
 
-	keys, err := s.getExpired(s.ttl, itemBucket+"_ttlBucket")
+	keys, err := s.getExpired(s.ttl, itemBucket+ttlBucketSuffix)
 	if err != nil || len(keys) == 0 {
 		return err
 	}
@@ -321,9 +1137,15 @@ func (s Store) Reap(itemBucket string) error {
 		itemB := tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte(itemBucket))
 
 		for _, key := range keys {
+			if itemB.Get(key) == nil {
+				continue
+			}
 			if err = itemB.Delete(key); err != nil {
 				return
 			}
+			if err = s.recordChange(tx, types.EventExpire, itemBucket, key); err != nil {
+				return
+			}
 		}
 		return
 	})
@@ -356,3 +1178,108 @@ func (s Store) getExpired(maxAge time.Duration, ttlBucket string) ([][]byte, err
 
 	return keys, err
 }
+
+// reapExpired deletes the items of itemBucket whose per-item TTL has elapsed.
+func (s Store) reapExpired(itemBucket string) error {
+	return wrapErr(s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+
+		expiryB := root.Bucket([]byte(itemBucket + expiryBucketSuffix))
+		itemB := root.Bucket([]byte(itemBucket))
+		if expiryB == nil || itemB == nil {
+			return nil
+		}
+
+		var keys [][]byte
+		now := time.Now()
+		if err := expiryB.ForEach(func(k, _ []byte) error {
+			if isExpired(expiryB, k, now) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if itemB.Get(key) != nil {
+				if err := s.recordChange(tx, types.EventExpire, itemBucket, key); err != nil {
+					return err
+				}
+			}
+			if err := itemB.Delete(key); err != nil {
+				return err
+			}
+			if err := expiryB.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// setExpiry records when key expires in the expiry bucket of bucketName.
+// A ttl <= 0 clears any expiration previously set on key.
+func setExpiry(root *bolt.Bucket, bucketName string, key []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		if b := root.Bucket([]byte(bucketName + expiryBucketSuffix)); b != nil {
+			return b.Delete(key)
+		}
+		return nil
+	}
+
+	b, err := root.CreateBucketIfNotExists([]byte(bucketName + expiryBucketSuffix))
+	if err != nil {
+		return err
+	}
+	return b.Put(key, []byte(time.Now().Add(ttl).UTC().Format(time.RFC3339Nano)))
+}
+
+// isExpired reports whether key has an expiration in expiryB that is not after now.
+func isExpired(expiryB *bolt.Bucket, key []byte, now time.Time) bool {
+	if expiryB == nil {
+		return false
+	}
+
+	v := expiryB.Get(key)
+	if v == nil {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, string(v))
+	if err != nil {
+		return false
+	}
+	return !expiresAt.After(now)
+}
+
+// bucketCreationError carries the reason bbolt could not create a bucket.
+// It matches ErrBucketCreationFailed as well as that reason.
+type bucketCreationError struct {
+	err error
+}
+
+func (e *bucketCreationError) Error() string {
+	return ErrBucketCreationFailed.Error() + ": " + e.err.Error()
+}
+
+func (e *bucketCreationError) Unwrap() error {
+	return e.err
+}
+
+func (e *bucketCreationError) Is(target error) bool {
+	return target == ErrBucketCreationFailed
+}
+
+// wrapErr maps errors returned by bbolt onto their gokv equivalents.
+func wrapErr(err error) error {
+	switch {
+	case errors.Is(err, bolt.ErrBucketNotFound):
+		return gokv.ErrBucketNotFound
+	case errors.Is(err, bolt.ErrKeyTooLarge), errors.Is(err, bolt.ErrValueTooLarge):
+		return gokv.Wrap(gokv.ErrTooLarge, err)
+	case errors.Is(err, bolt.ErrDatabaseNotOpen), errors.Is(err, bolt.ErrTimeout):
+		return gokv.Wrap(gokv.ErrUnavailable, err)
+	}
+	return err
+}
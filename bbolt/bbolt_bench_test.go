@@ -63,7 +63,7 @@ func benchmarkBatchSet(j int, b *testing.B) {
 			go func(i int) {
 				assert.NoError(b, s.BatchSet(types.BatchSetItemInput{
 					Keys:       []string{fmt.Sprintf("foo%d", i)},
-					Values:     "bar",
+					Values:     []string{"bar"},
 					BucketName: "testing",
 				}))
 				wg.Done()
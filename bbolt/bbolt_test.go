@@ -1,8 +1,11 @@
 package bbolt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"sync"
 	"testing"
@@ -10,6 +13,7 @@ import (
 
 	h "github.com/dustin/go-humanize"
 
+	"github.com/simar7/gokv"
 	"github.com/simar7/gokv/encoding"
 	"github.com/simar7/gokv/types"
 	"github.com/simar7/gokv/util"
@@ -136,7 +140,7 @@ func TestStore_BatchSet(t *testing.T) {
 			go func(i int) {
 				assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
 					Keys:       []string{fmt.Sprintf("foo%d", i)},
-					Values:     "bar",
+					Values:     []string{"bar"},
 					BucketName: "batchsetbucket",
 				}))
 				wg.Done()
@@ -161,6 +165,31 @@ func TestStore_BatchSet(t *testing.T) {
 		assert.NoError(t, s.Close())
 	})
 
+	t.Run("happy path, multiple keys", func(t *testing.T) {
+		s, f, err := setupStore()
+		defer func() {
+			_ = f.Close()
+			_ = os.RemoveAll(f.Name())
+		}()
+		assert.NoError(t, err)
+
+		assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
+			Keys:       []string{"key1", "key2", "key3"},
+			Values:     []string{"val1", "val2", "val3"},
+			BucketName: "batchsetbucket",
+		}))
+
+		scanOut, err := s.Scan(types.ScanInput{BucketName: "batchsetbucket"})
+		assert.NoError(t, err)
+		assert.Equal(t, types.ScanOutput{
+			Keys:   []string{"key1", "key2", "key3"},
+			Values: [][]byte{[]byte(`"val1"`), []byte(`"val2"`), []byte(`"val3"`)},
+		}, scanOut)
+
+		// close
+		assert.NoError(t, s.Close())
+	})
+
 	t.Run("sad paths", func(t *testing.T) {
 		testCases := []struct {
 			name          string
@@ -169,11 +198,28 @@ func TestStore_BatchSet(t *testing.T) {
 			expectedError error
 		}{
 			{
-				name:          "multiple keys",
+				name:          "more keys than values",
 				inputKeys:     []string{"key1", "key2"},
-				expectedError: ErrMultipleKVNotSupported,
+				inputValues:   []string{"val1"},
+				expectedError: util.ErrLengthMismatch,
+			},
+			{
+				name:          "values not a slice",
+				inputKeys:     []string{"key1"},
+				inputValues:   "val1",
+				expectedError: util.ErrLengthMismatch,
+			},
+			{
+				name:          "empty key",
+				inputKeys:     []string{""},
+				inputValues:   []string{"val1"},
+				expectedError: util.ErrEmptyKey,
+			},
+			{
+				name:          "missing values",
+				inputKeys:     []string{"key1"},
+				expectedError: util.ErrEmptyValue,
 			},
-			// TODO: Add more sad paths
 		}
 
 		for _, tc := range testCases {
@@ -183,7 +229,7 @@ func TestStore_BatchSet(t *testing.T) {
 				_ = os.RemoveAll(f.Name())
 			}()
 			assert.NoError(t, err)
-			assert.Equal(t, ErrMultipleKVNotSupported, s.BatchSet(types.BatchSetItemInput{
+			assert.Equal(t, tc.expectedError, s.BatchSet(types.BatchSetItemInput{
 				BucketName: "batchbucket",
 				Keys:       tc.inputKeys,
 				Values:     tc.inputValues,
@@ -282,9 +328,10 @@ func TestStore_Delete(t *testing.T) {
 			expectedError: ErrBucketNotFound,
 		},
 		{
-			name:        "sad path: input key not found",
-			inputBucket: "deletebucket",
-			inputKey:    "badkey",
+			name:          "sad path: input key not found",
+			inputBucket:   "deletebucket",
+			inputKey:      "badkey",
+			expectedError: gokv.ErrNotFound,
 		},
 		{
 			name:          "sad path: input key empty",
@@ -382,6 +429,34 @@ func TestStore_Info(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "gokvbbolt", actualInfo.Name)
 	assert.Equal(t, "32 KiB", h.IBytes(uint64(actualInfo.Size)))
+	assert.Equal(t, int64(0), actualInfo.Items)
+	assert.Empty(t, actualInfo.Buckets)
+
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
+		BucketName: "foo",
+		Keys:       []string{"a", "b"},
+		Values:     []string{"val", "val"},
+		TTL:        time.Hour,
+	}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "a", Value: "val"}))
+
+	actualInfo, err = s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), actualInfo.Items)
+	assert.Equal(t, actualInfo.Size, actualInfo.UsedBytes+actualInfo.FreeBytes)
+	// the expiry bookkeeping of foo is not reported as a bucket
+	assert.Len(t, actualInfo.Buckets, 2)
+	for _, bi := range actualInfo.Buckets {
+		switch bi.Name {
+		case "foo":
+			assert.Equal(t, int64(2), bi.Items)
+		case "bar":
+			assert.Equal(t, int64(1), bi.Items)
+		default:
+			t.Errorf("unexpected bucket %q", bi.Name)
+		}
+		assert.True(t, bi.Size > 0)
+	}
 }
 
 func TestStore_DeleteBucket(t *testing.T) {
@@ -490,3 +565,503 @@ func TestStore_Reap(t *testing.T) {
 		assert.Equal(t, tc.expectedValue, actualOutput, tc.name)
 	}
 }
+
+func TestStore_ScanWithContext(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{
+		Key:        "foo",
+		Value:      "bar",
+		BucketName: "scanbucket",
+	}))
+
+	t.Run("happy path", func(t *testing.T) {
+		scanOut, err := s.ScanWithContext(context.Background(), types.ScanInput{BucketName: "scanbucket"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"foo"}, scanOut.Keys)
+	})
+
+	t.Run("sad path: context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		scanOut, err := s.ScanWithContext(ctx, types.ScanInput{BucketName: "scanbucket"})
+		assert.Equal(t, context.Canceled, err)
+		assert.Empty(t, scanOut)
+
+		var actualValue string
+		found, err := s.GetWithContext(ctx, types.GetItemInput{BucketName: "scanbucket", Key: "foo", Value: &actualValue})
+		assert.Equal(t, context.Canceled, err)
+		assert.False(t, found)
+	})
+}
+
+func TestStore_ItemTTL(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{
+		Key:        "expired",
+		Value:      "bar",
+		BucketName: "ttlbucket",
+		TTL:        time.Nanosecond,
+	}))
+	assert.NoError(t, s.Set(types.SetItemInput{
+		Key:        "alive",
+		Value:      "bar",
+		BucketName: "ttlbucket",
+		TTL:        time.Hour,
+	}))
+	assert.NoError(t, s.Set(types.SetItemInput{
+		Key:        "forever",
+		Value:      "bar",
+		BucketName: "ttlbucket",
+	}))
+
+	// expired items are hidden before reaping
+	var actualValue string
+	found, err := s.Get(types.GetItemInput{Key: "expired", Value: &actualValue, BucketName: "ttlbucket"})
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, actualValue)
+
+	found, err = s.Get(types.GetItemInput{Key: "alive", Value: &actualValue, BucketName: "ttlbucket"})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "bar", actualValue)
+
+	scanOut, err := s.Scan(types.ScanInput{BucketName: "ttlbucket"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alive", "forever"}, scanOut.Keys)
+
+	assert.Equal(t, gokv.ErrNotFound, s.Delete(types.DeleteItemInput{Key: "expired", BucketName: "ttlbucket"}))
+
+	// reaping removes the expired item and its expiry record
+	assert.NoError(t, s.Reap("ttlbucket"))
+	assert.NoError(t, s.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(s.rbc.Name))
+		assert.Nil(t, root.Bucket([]byte("ttlbucket")).Get([]byte("expired")))
+		assert.Nil(t, root.Bucket([]byte("ttlbucket"+expiryBucketSuffix)).Get([]byte("expired")))
+		assert.NotNil(t, root.Bucket([]byte("ttlbucket"+expiryBucketSuffix)).Get([]byte("alive")))
+		return nil
+	}))
+
+	// overwriting without a TTL clears the expiration
+	assert.NoError(t, s.Set(types.SetItemInput{
+		Key:        "alive",
+		Value:      "baz",
+		BucketName: "ttlbucket",
+	}))
+	assert.NoError(t, s.db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte("ttlbucket"+expiryBucketSuffix)).Get([]byte("alive")))
+		return nil
+	}))
+}
+
+func TestStore_ConditionalWrites(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	// set if not exists
+	assert.NoError(t, s.SetIfNotExists(types.SetItemInput{Key: "foo", Value: "bar", BucketName: "condbucket"}))
+	assert.Equal(t, gokv.ErrConflict, s.SetIfNotExists(types.SetItemInput{Key: "foo", Value: "baz", BucketName: "condbucket"}))
+
+	// compare and swap
+	assert.Equal(t, gokv.ErrConflict, s.CompareAndSwap(types.CompareAndSwapInput{
+		Key: "foo", OldValue: "baz", NewValue: "qux", BucketName: "condbucket"}))
+	assert.NoError(t, s.CompareAndSwap(types.CompareAndSwapInput{
+		Key: "foo", OldValue: "bar", NewValue: "qux", BucketName: "condbucket"}))
+	assert.Equal(t, gokv.ErrConflict, s.CompareAndSwap(types.CompareAndSwapInput{
+		Key: "missing", OldValue: "bar", NewValue: "qux", BucketName: "condbucket"}))
+	assert.Equal(t, ErrBucketNotFound, s.CompareAndSwap(types.CompareAndSwapInput{
+		Key: "foo", OldValue: "bar", NewValue: "qux", BucketName: "badbucket"}))
+
+	var actualValue string
+	found, err := s.Get(types.GetItemInput{Key: "foo", Value: &actualValue, BucketName: "condbucket"})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "qux", actualValue)
+
+	// delete if
+	assert.Equal(t, gokv.ErrConflict, s.DeleteIf(types.DeleteIfInput{Key: "foo", Value: "bar", BucketName: "condbucket"}))
+	assert.NoError(t, s.DeleteIf(types.DeleteIfInput{Key: "foo", Value: "qux", BucketName: "condbucket"}))
+
+	found, err = s.Get(types.GetItemInput{Key: "foo", Value: &actualValue, BucketName: "condbucket"})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// expired items count as absent
+	assert.NoError(t, s.Set(types.SetItemInput{Key: "foo", Value: "bar", BucketName: "condbucket", TTL: time.Nanosecond}))
+	assert.NoError(t, s.SetIfNotExists(types.SetItemInput{Key: "foo", Value: "baz", BucketName: "condbucket"}))
+}
+
+func TestStore_Scan_Paginated(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, s.Set(types.SetItemInput{
+			Key:        fmt.Sprintf("foo%d", i),
+			Value:      "bar",
+			BucketName: "scanbucket",
+		}))
+	}
+
+	var pages [][]string
+	input := types.ScanInput{BucketName: "scanbucket", Limit: 2}
+	for {
+		scanOut, err := s.Scan(input)
+		assert.NoError(t, err)
+		pages = append(pages, scanOut.Keys)
+		if scanOut.NextToken == "" {
+			break
+		}
+		input.StartToken = scanOut.NextToken
+	}
+	assert.Equal(t, [][]string{{"foo0", "foo1"}, {"foo2", "foo3"}, {"foo4"}}, pages)
+
+	var keys []string
+	it := gokv.NewScanIterator(s, types.ScanInput{BucketName: "scanbucket", Limit: 2})
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"foo0", "foo1", "foo2", "foo3", "foo4"}, keys)
+
+	scanOut, err := s.Scan(types.ScanInput{BucketName: "scanbucket", StartToken: "!!"})
+	assert.Equal(t, util.ErrInvalidToken, err)
+	assert.Empty(t, scanOut)
+}
+
+func TestStore_Scan_Range(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	for _, k := range []string{"tenant/1/obj/a", "tenant/1/obj/b", "tenant/1/obj/c", "tenant/2/obj/a", "zzz"} {
+		assert.NoError(t, s.Set(types.SetItemInput{Key: k, Value: "bar", BucketName: "rangebucket"}))
+	}
+
+	testCases := []struct {
+		name         string
+		input        types.ScanInput
+		expectedKeys []string
+	}{
+		{
+			name:         "prefix",
+			input:        types.ScanInput{Prefix: "tenant/1/"},
+			expectedKeys: []string{"tenant/1/obj/a", "tenant/1/obj/b", "tenant/1/obj/c"},
+		},
+		{
+			name:         "start and end key",
+			input:        types.ScanInput{StartKey: "tenant/1/obj/b", EndKey: "tenant/2/obj/a"},
+			expectedKeys: []string{"tenant/1/obj/b", "tenant/1/obj/c"},
+		},
+		{
+			name:         "prefix and start key",
+			input:        types.ScanInput{Prefix: "tenant/", StartKey: "tenant/1/obj/c"},
+			expectedKeys: []string{"tenant/1/obj/c", "tenant/2/obj/a"},
+		},
+		{
+			name:  "prefix without matches",
+			input: types.ScanInput{Prefix: "tenant/3/"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc.input.BucketName = "rangebucket"
+		scanOut, err := s.Scan(tc.input)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expectedKeys, scanOut.Keys, tc.name)
+	}
+}
+
+func TestStore_BatchGet(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{Key: "foo", Value: "bar", BucketName: "batchgetbucket"}))
+	assert.NoError(t, s.Set(types.SetItemInput{Key: "faz", Value: "baz", BucketName: "batchgetbucket"}))
+	assert.NoError(t, s.Set(types.SetItemInput{Key: "old", Value: "qux", BucketName: "batchgetbucket", TTL: time.Nanosecond}))
+
+	t.Run("happy path, slice", func(t *testing.T) {
+		var values []string
+		out, err := s.BatchGet(types.BatchGetItemInput{
+			BucketName: "batchgetbucket",
+			Keys:       []string{"foo", "missing", "faz", "old"},
+			Values:     &values,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, false, true, false}, out.Found)
+		assert.Equal(t, []string{"bar", "", "baz", ""}, values)
+	})
+
+	t.Run("happy path, map", func(t *testing.T) {
+		values := map[string]string{}
+		out, err := s.BatchGet(types.BatchGetItemInput{
+			BucketName: "batchgetbucket",
+			Keys:       []string{"foo", "missing"},
+			Values:     values,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, false}, out.Found)
+		assert.Equal(t, map[string]string{"foo": "bar"}, values)
+	})
+
+	t.Run("sad paths", func(t *testing.T) {
+		var values []string
+		_, err := s.BatchGet(types.BatchGetItemInput{BucketName: "badbucket", Keys: []string{"foo"}, Values: &values})
+		assert.Equal(t, ErrBucketNotFound, err)
+
+		_, err = s.BatchGet(types.BatchGetItemInput{BucketName: "batchgetbucket", Keys: []string{"foo", ""}, Values: &values})
+		assert.Equal(t, util.ErrEmptyKey, err)
+
+		_, err = s.BatchGet(types.BatchGetItemInput{BucketName: "batchgetbucket", Keys: []string{"foo"}, Values: values})
+		assert.Equal(t, util.ErrInvalidValues, err)
+	})
+}
+
+func TestStore_BatchDelete(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{Key: "foo", Value: "bar", BucketName: "batchdeletebucket"}))
+	assert.NoError(t, s.Set(types.SetItemInput{Key: "faz", Value: "baz", BucketName: "batchdeletebucket", TTL: time.Hour}))
+
+	out, err := s.BatchDelete(types.BatchDeleteItemInput{
+		BucketName: "batchdeletebucket",
+		Keys:       []string{"foo", "missing", "faz"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing"}, out.Missing)
+
+	scanOut, err := s.Scan(types.ScanInput{BucketName: "batchdeletebucket"})
+	assert.NoError(t, err)
+	assert.Empty(t, scanOut.Keys)
+
+	_, err = s.BatchDelete(types.BatchDeleteItemInput{BucketName: "badbucket", Keys: []string{"foo"}})
+	assert.Equal(t, ErrBucketNotFound, err)
+
+	_, err = s.BatchDelete(types.BatchDeleteItemInput{BucketName: "batchdeletebucket"})
+	assert.Equal(t, util.ErrEmptyKey, err)
+}
+
+func TestStore_ListBuckets(t *testing.T) {
+	f, err := ioutil.TempFile(".", "Bolt_TestStore_ListBuckets-*")
+	assert.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+
+	// an item TTL makes the store keep a _ttlBucket next to each bucket
+	s, err := NewStore(Options{Path: f.Name(), ItemTTL: time.Hour})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Hour}))
+
+	buckets, err := s.ListBuckets()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(buckets))
+	assert.Equal(t, "foo", buckets[0].Name)
+	assert.Equal(t, int64(1), buckets[0].Items)
+
+	for _, name := range []string{"foo" + ttlBucketSuffix, "foo" + expiryBucketSuffix} {
+		_, err := s.BucketInfo(types.BucketInfoInput{BucketName: name})
+		assert.Equal(t, ErrBucketNotFound, err, name)
+	}
+}
+
+func TestStore_ExistsAndCount_Expired(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "expired", Value: "val", TTL: time.Nanosecond}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "live", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "forever", Value: "val"}))
+	time.Sleep(time.Millisecond)
+
+	exists, err := s.Exists(types.ExistsInput{BucketName: "foo", Key: "expired"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = s.Exists(types.ExistsInput{BucketName: "foo", Key: "live"})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = s.Count(types.CountInput{BucketName: "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestStore_Increment(t *testing.T) {
+	s, f, err := setupStoreWithCodec(encoding.Gob)
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	raw := func(key string) (data, expiry []byte) {
+		assert.NoError(t, s.db.View(func(tx *bolt.Tx) error {
+			root := tx.Bucket([]byte(s.rbc.Name))
+			data = root.Bucket([]byte("foo")).Get([]byte(key))
+			if b := root.Bucket([]byte("foo" + expiryBucketSuffix)); b != nil {
+				expiry = b.Get([]byte(key))
+			}
+			return nil
+		}))
+		return data, expiry
+	}
+
+	t.Run("decimal whatever the codec", func(t *testing.T) {
+		n, err := s.Increment(types.IncrementInput{BucketName: "foo", Key: "counter", Delta: 5})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), n)
+
+		data, _ := raw("counter")
+		assert.Equal(t, "5", string(data))
+	})
+
+	t.Run("keeps the ttl", func(t *testing.T) {
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "ttl", Value: "val", TTL: time.Hour}))
+		assert.NoError(t, s.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(s.rbc.Name)).Bucket([]byte("foo")).Put([]byte("ttl"), []byte("5"))
+		}))
+		_, before := raw("ttl")
+
+		n, err := s.Increment(types.IncrementInput{BucketName: "foo", Key: "ttl", Delta: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), n)
+
+		_, after := raw("ttl")
+		assert.NotNil(t, after)
+		assert.Equal(t, before, after)
+	})
+
+	t.Run("sad path, not a counter", func(t *testing.T) {
+		// the gob encoding of an integer is not decimal text
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "gob", Value: 5}))
+		_, err := s.Increment(types.IncrementInput{BucketName: "foo", Key: "gob", Delta: 1})
+		assert.Equal(t, util.ErrNotCounter, err)
+	})
+
+	t.Run("sad path, overflow", func(t *testing.T) {
+		_, err := s.Increment(types.IncrementInput{BucketName: "foo", Key: "counter", Delta: math.MaxInt64})
+		assert.Equal(t, util.ErrCounterOverflow, err)
+
+		// the counter is left unchanged
+		data, _ := raw("counter")
+		assert.Equal(t, "5", string(data))
+	})
+}
+
+func TestStore_BucketCreationFailed(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	// a plain key in the root bucket keeps a bucket of that name from being created
+	assert.NoError(t, s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(s.rbc.Name)).Put([]byte("foo"), []byte("bar"))
+	}))
+
+	_, err = s.Increment(types.IncrementInput{BucketName: "foo", Key: "counter", Delta: 1})
+	assert.True(t, errors.Is(err, ErrBucketCreationFailed))
+	assert.True(t, errors.Is(err, bolt.ErrIncompatibleValue))
+
+	err = s.Txn(types.TxnInput{Ops: []types.TxnOp{{Type: types.TxnSet, BucketName: "foo", Key: "a", Value: "val"}}})
+	assert.True(t, errors.Is(err, ErrBucketCreationFailed))
+	assert.True(t, errors.Is(err, bolt.ErrIncompatibleValue))
+
+	err = s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: []string{"a"}, Values: []string{"val"}})
+	assert.True(t, errors.Is(err, ErrBucketCreationFailed))
+	assert.True(t, errors.Is(err, bolt.ErrIncompatibleValue))
+
+	// the reason still maps onto its gokv error
+	err = wrapErr(&bucketCreationError{err: bolt.ErrDatabaseNotOpen})
+	assert.True(t, errors.Is(err, gokv.ErrUnavailable))
+	assert.True(t, errors.Is(err, ErrBucketCreationFailed))
+}
+
+func TestStore_View(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "old"}))
+
+	written := make(chan error, 1)
+	err = s.View(func(tx gokv.ReadTx) error {
+		var v string
+		found, err := tx.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		go func() {
+			written <- s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "new"})
+		}()
+		// the write may have to wait for the view to end if it grows the file
+		select {
+		case err := <-written:
+			assert.NoError(t, err)
+			written <- nil
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		out, err := tx.Scan(types.ScanInput{BucketName: "foo"})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte(`"old"`)}, out.Values)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, <-written)
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "new", v)
+}
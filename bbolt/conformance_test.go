@@ -0,0 +1,37 @@
+package bbolt
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir(".", "Bolt_TestConformance-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	newStore := func(t *testing.T) gokv.Store {
+		f, err := ioutil.TempFile(dir, "store-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+
+		s, err := NewStore(Options{Path: f.Name()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	storetest.Run(t, newStore)
+	storetest.RunWatch(t, newStore)
+}
@@ -0,0 +1,127 @@
+package bbolt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+// changeLogSuffix names the top level bucket holding the change log
+// of a store, next to its root bucket.
+const changeLogSuffix = "_changeLog"
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext reports the changes committed through this store. Items
+// expiring by TTL are reported when Reap removes them. With a ChangeLogSize
+// set, events carry a Token and a watch can resume from the last
+// ChangeLogSize changes, including those made before a restart.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return nil, nil, err
+	}
+
+	var start uint64
+	if input.StartToken != "" {
+		if s.changeLogSize <= 0 {
+			return nil, nil, gokv.ErrNotSupported
+		}
+		var err error
+		if start, err = strconv.ParseUint(input.StartToken, 10, 64); err != nil {
+			return nil, nil, util.ErrInvalidToken
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// register before replaying, so that no change falls in between
+	w := s.feed.Watch(input)
+	if input.StartToken != "" {
+		var replayed []types.Event
+		err := s.db.View(func(tx *bolt.Tx) error {
+			log := tx.Bucket(s.changeLogName())
+			if log == nil {
+				return nil
+			}
+			c := log.Cursor()
+			for k, v := c.Seek(seqKey(start + 1)); k != nil; k, v = c.Next() {
+				var ev types.Event
+				if err := json.Unmarshal(v, &ev); err != nil {
+					return err
+				}
+				if w.Matches(ev) {
+					replayed = append(replayed, ev)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			w.Cancel()
+			return nil, nil, wrapErr(err)
+		}
+		w.Replay(replayed)
+	}
+
+	events, cancel := w.Start(ctx)
+	return events, cancel, nil
+}
+
+// recordChange appends a change to the change log, if enabled, and has
+// it published to the watchers of the store once tx commits.
+func (s Store) recordChange(tx *bolt.Tx, typ types.EventType, bucketName string, key []byte) error {
+	ev := types.Event{Type: typ, BucketName: bucketName, Key: string(key)}
+
+	if s.changeLogSize > 0 {
+		log, err := tx.CreateBucketIfNotExists(s.changeLogName())
+		if err != nil {
+			return err
+		}
+		seq, err := log.NextSequence()
+		if err != nil {
+			return err
+		}
+		ev.Token = strconv.FormatUint(seq, 10)
+
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if err := log.Put(seqKey(seq), data); err != nil {
+			return err
+		}
+		// keep the log at ChangeLogSize entries
+		if seq > uint64(s.changeLogSize) {
+			if err := log.Delete(seqKey(seq - uint64(s.changeLogSize))); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.feed.Active() {
+		tx.OnCommit(func() {
+			s.feed.Publish(ev)
+		})
+	}
+	return nil
+}
+
+func (s Store) changeLogName() []byte {
+	return []byte(s.rbc.Name + changeLogSuffix)
+}
+
+// seqKey encodes seq so that the keys of the change log sort by sequence.
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,70 @@
+package bbolt
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/storetest"
+	"github.com/simar7/gokv/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Watch_NoChangeLog(t *testing.T) {
+	s, f, err := setupStore()
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+	assert.NoError(t, err)
+
+	// without a change log there is nothing to resume from
+	_, _, err = s.Watch(types.WatchInput{BucketName: "foo", StartToken: "1"})
+	assert.Equal(t, gokv.ErrNotSupported, err)
+}
+
+func TestStore_Watch_Resume(t *testing.T) {
+	f, err := ioutil.TempFile(".", "Bolt_TestStore_Watch-*")
+	assert.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+		_ = os.RemoveAll(f.Name())
+	}()
+
+	s, err := NewStore(Options{Path: f.Name(), ChangeLogSize: 3})
+	assert.NoError(t, err)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: k, Value: "val"}))
+	}
+	assert.NoError(t, s.Close())
+
+	// the log survives a restart and holds the last 3 changes
+	s, err = NewStore(Options{Path: f.Name(), ChangeLogSize: 3})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: "foo", StartToken: "1"})
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.NoError(t, s.Delete(types.DeleteItemInput{BucketName: "foo", Key: "a"}))
+
+	var got []types.Event
+	for i := 0; i < 4; i++ {
+		got = append(got, storetest.Receive(t, events))
+	}
+	assert.Equal(t, []types.Event{
+		{Type: types.EventPut, BucketName: "foo", Key: "c", Token: "3"},
+		{Type: types.EventPut, BucketName: "foo", Key: "d", Token: "4"},
+		{Type: types.EventPut, BucketName: "foo", Key: "e", Token: "5"},
+		{Type: types.EventDelete, BucketName: "foo", Key: "a", Token: "6"},
+	}, got)
+
+	buckets, err := s.ListBuckets()
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 1)
+
+	_, _, err = s.Watch(types.WatchInput{BucketName: "foo", StartToken: "x"})
+	assert.Error(t, err)
+}
@@ -1,19 +1,32 @@
 package dynamodb
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math/rand"
 	"reflect"
-
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/simar7/gokv/types"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/simar7/gokv"
 	"github.com/simar7/gokv/encoding"
 	"github.com/simar7/gokv/util"
 )
@@ -21,13 +34,50 @@ import (
 var (
 	KeyAttrName = "k"
 	ValAttrName = "v"
+	// BucketAttrName holds the bucket name of an item in single-table mode.
+	BucketAttrName = "b"
+	// TTLAttrName holds the expiration time of an item in epoch seconds.
+	// Enable DynamoDB TTL on this attribute to have expired items removed.
+	TTLAttrName = "ttl"
+)
+
+const (
+	// batchGetLimit is the maximum number of keys DynamoDB accepts in one BatchGetItem call.
+	batchGetLimit = 100
+	// batchWriteLimit is the maximum number of requests DynamoDB accepts in one BatchWriteItem call.
+	batchWriteLimit = 25
+	// txnLimit is the maximum number of items DynamoDB accepts in one TransactWriteItems call.
+	txnLimit = 100
+	// maxBatchRetries bounds how often unprocessed keys of a batch are retried.
+	maxBatchRetries = 8
+	// retryBaseDelay is the backoff before the first retry of unprocessed keys.
+	retryBaseDelay = 50 * time.Millisecond
 )
 
 var (
 	ErrMissingTableName = errors.New("table name is required")
 	ErrNotImplemented   = errors.New("function not implemented")
+	ErrUnprocessedKeys  = errors.New("keys left unprocessed after retries")
+	ErrTooManyTxnOps    = errors.New("transaction exceeds 100 items")
 )
 
+// PartialFailureError is returned by batch writes when some items could
+// not be written. Keys lists the items that never landed; every other item
+// of the batch was written. Err is the cause, so errors.Is(err,
+// gokv.ErrThrottled) holds when the retries were exhausted.
+type PartialFailureError struct {
+	Keys []string
+	Err  error
+}
+
+func (e *PartialFailureError) Error() string {
+	return fmt.Sprintf("batch write failed for %d keys: %v", len(e.Keys), e.Err)
+}
+
+func (e *PartialFailureError) Unwrap() error {
+	return e.Err
+}
+
 type Options struct {
 	Region             string
 	TableName          string
@@ -37,20 +87,62 @@ type Options struct {
 	CustomEndpoint     string
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
+	// BatchConcurrency is the number of 25-item chunks a batch write sends
+	// in parallel. Values below 1 write chunks one after another.
+	BatchConcurrency int
+	// BillingMode of the tables created for buckets, either
+	// dynamodb.BillingModeProvisioned (the default), which uses the
+	// read and write capacity units, or dynamodb.BillingModePayPerRequest.
+	BillingMode string
+	// PointInTimeRecovery enables continuous backups on created tables.
+	PointInTimeRecovery bool
+	// EnableTTL turns on DynamoDB TTL for TTLAttrName on created
+	// tables, so that expired items are eventually removed.
+	EnableTTL bool
+	// SkipTableCreation stops the store from creating the table of a
+	// bucket on the first write to it. Writes to a missing table then
+	// fail with gokv.ErrBucketNotFound.
+	SkipTableCreation bool
+	// SingleTable stores every bucket in the TableName table, with the
+	// bucket name as the partition key (BucketAttrName) and the item key
+	// as the sort key. Otherwise each bucket gets a table of its own.
+	SingleTable bool
+	// TablePrefix is prepended to the name of a bucket to name its table
+	// when each bucket gets a table of its own. Only tables carrying it
+	// are reported as buckets.
+	TablePrefix string
+	// EnableStreams turns on a KEYS_ONLY stream on created tables,
+	// which Watch reads changes from.
+	EnableStreams bool
+	// StreamPollInterval is how often Watch polls the shards of a stream.
+	StreamPollInterval time.Duration
 }
 
 var DefaultOptions = Options{
 	ReadCapacityUnits:  5,
 	WriteCapacityUnits: 5,
 	Codec:              encoding.JSON,
+	BillingMode:        awsdynamodb.BillingModeProvisioned,
+	TablePrefix:        "gokv_",
+	StreamPollInterval: time.Second,
 }
 
 type Store struct {
-	c         dynamodbiface.DynamoDBAPI
-	tableName string
-	codec     encoding.Codec
+	c                dynamodbiface.DynamoDBAPI
+	streams          dynamodbstreamsiface.DynamoDBStreamsAPI
+	tableName        string
+	codec            encoding.Codec
+	batchConcurrency int
+	options          Options
+	// tables caches the names of tables known to be ACTIVE.
+	// It is nil when tables are not created on demand.
+	tables *sync.Map
+	// consistentRead is set for the reads of a View.
+	consistentRead *bool
 }
 
+var _ gokv.StoreWithContext = Store{}
+
 func NewStore(options Options) (Store, error) {
 	result := Store{}
 
@@ -70,6 +162,18 @@ func NewStore(options Options) (Store, error) {
 		options.Codec = DefaultOptions.Codec
 	}
 
+	if options.BillingMode == "" {
+		options.BillingMode = DefaultOptions.BillingMode
+	}
+
+	if options.StreamPollInterval == 0 {
+		options.StreamPollInterval = DefaultOptions.StreamPollInterval
+	}
+
+	if options.TablePrefix == "" {
+		options.TablePrefix = DefaultOptions.TablePrefix
+	}
+
 	creds := credentials.NewStaticCredentials(options.AWSAccessKeyID, options.AWSSecretAccessKey, "")
 
 	config := aws.NewConfig()
@@ -92,13 +196,23 @@ func NewStore(options Options) (Store, error) {
 	}
 
 	result.c = awsdynamodb.New(awsSession)
+	result.streams = dynamodbstreams.New(awsSession)
 	result.tableName = options.TableName
 	result.codec = options.Codec
+	result.batchConcurrency = options.BatchConcurrency
+	result.options = options
+	if !options.SkipTableCreation {
+		result.tables = &sync.Map{}
+	}
 
 	return result, nil
 }
 
 func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
 	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
 		return err
 	}
@@ -108,144 +222,1536 @@ func (s Store) Set(input types.SetItemInput) error {
 		return err
 	}
 
-	item := make(map[string]*awsdynamodb.AttributeValue)
-	item[KeyAttrName] = &awsdynamodb.AttributeValue{
-		S: &input.Key,
-	}
-	item[ValAttrName] = &awsdynamodb.AttributeValue{
-		B: data,
+	if err := s.ensureTable(ctx, input.BucketName); err != nil {
+		return err
 	}
+
 	putItemInput := awsdynamodb.PutItemInput{
-		TableName: aws.String(input.BucketName),
-		Item:      item,
+		TableName: aws.String(s.table(input.BucketName)),
+		Item:      newItem(s.itemKey(input.BucketName, input.Key), data, input.TTL),
 	}
-	_, err = s.c.PutItem(&putItemInput)
+	_, err = s.c.PutItemWithContext(ctx, &putItemInput)
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 	return nil
 }
 
 func (s Store) BatchSet(input types.BatchSetItemInput) error {
-	var datas [][]byte
-	var writeRequests []*awsdynamodb.WriteRequest
+	return s.BatchSetWithContext(context.Background(), input)
+}
 
-	for i := 0; i < len(input.Keys); i++ {
-		if err := util.CheckKeyAndValue(input.Keys[i], input.Values); err != nil {
-			return err
-		}
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
+	}
 
-		data, err := s.codec.Marshal(reflect.ValueOf(input.Values).Index(i).Interface())
+	values := reflect.ValueOf(input.Values)
+	writeRequests := make([]*awsdynamodb.WriteRequest, 0, len(input.Keys))
+	for i, k := range input.Keys {
+		data, err := s.codec.Marshal(values.Index(i).Interface())
 		if err != nil {
 			return err
 		}
-		datas = append(datas, data)
 
 		writeRequests = append(writeRequests, &awsdynamodb.WriteRequest{
 			PutRequest: &awsdynamodb.PutRequest{
-				Item: map[string]*awsdynamodb.AttributeValue{
-					KeyAttrName: {
-						S: aws.String(input.Keys[i]),
-					},
-					ValAttrName: {
-						B: datas[i],
-					},
-				},
+				Item: newItem(s.itemKey(input.BucketName, k), data, input.TTL),
 			},
 		})
 	}
 
-	batchItemInput := &awsdynamodb.BatchWriteItemInput{
-		RequestItems: map[string][]*awsdynamodb.WriteRequest{
-			input.BucketName: writeRequests,
-		},
-	}
-
-	_, err := s.c.BatchWriteItem(batchItemInput)
-	if err != nil {
+	if err := s.ensureTable(ctx, input.BucketName); err != nil {
 		return err
 	}
 
-	return nil
+	return s.batchWrite(ctx, s.table(input.BucketName), writeRequests)
 }
 
 func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
 	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
 		return false, err
 	}
 
-	key := make(map[string]*awsdynamodb.AttributeValue)
-	key[KeyAttrName] = &awsdynamodb.AttributeValue{
-		S: &input.Key,
-	}
 	getItemInput := awsdynamodb.GetItemInput{
-		TableName: aws.String(input.BucketName),
-		Key:       key,
+		TableName:      aws.String(s.table(input.BucketName)),
+		Key:            s.itemKey(input.BucketName, input.Key),
+		ConsistentRead: s.consistentRead,
 	}
-	getItemOutput, err := s.c.GetItem(&getItemInput)
+	getItemOutput, err := s.c.GetItemWithContext(ctx, &getItemInput)
 	if err != nil {
-		return false, err
-	} else if getItemOutput.Item == nil {
+		return false, wrapErr(err)
+	} else if getItemOutput.Item == nil || isExpired(getItemOutput.Item, time.Now()) {
 		return false, nil
 	}
-	attributeVal := getItemOutput.Item[ValAttrName]
-	if attributeVal == nil {
+	data := itemValue(getItemOutput.Item)
+	if data == nil {
 		return false, nil
 	}
-	data := attributeVal.B
 
 	return true, s.codec.Unmarshal(data, input.Value)
 }
 
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+// BatchGetWithContext reads the keys in chunks of 100 with BatchGetItem,
+// retrying unprocessed keys with exponential backoff.
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	items, err := s.batchGetItems(ctx, input.BucketName, input.Keys, false)
+	if err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	data := make([][]byte, len(input.Keys))
+	found := make([]bool, len(input.Keys))
+	for i, k := range input.Keys {
+		if item, ok := items[k]; ok {
+			data[i] = itemValue(item)
+			found[i] = data[i] != nil
+		}
+	}
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
+// batchGetItems reads keys from bucketName in chunks of 100 with BatchGetItem,
+// retrying unprocessed keys with exponential backoff. The unexpired items
+// found are returned by key. With keysOnly, the item values are not fetched.
+func (s Store) batchGetItems(ctx context.Context, bucketName string, keys []string, keysOnly bool) (map[string]map[string]*awsdynamodb.AttributeValue, error) {
+	// BatchGetItem rejects duplicate keys within a request
+	var uniqueKeys []string
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			uniqueKeys = append(uniqueKeys, k)
+		}
+	}
+
+	if s.consistentRead != nil {
+		return s.transactGetItems(ctx, bucketName, uniqueKeys)
+	}
+
+	tableName := s.table(bucketName)
+	items := make(map[string]map[string]*awsdynamodb.AttributeValue)
+	now := time.Now()
+	for start := 0; start < len(uniqueKeys); start += batchGetLimit {
+		end := start + batchGetLimit
+		if end > len(uniqueKeys) {
+			end = len(uniqueKeys)
+		}
+
+		keysAndAttributes := &awsdynamodb.KeysAndAttributes{}
+		for _, k := range uniqueKeys[start:end] {
+			keysAndAttributes.Keys = append(keysAndAttributes.Keys, s.itemKey(bucketName, k))
+		}
+		if keysOnly {
+			keysAndAttributes.ProjectionExpression = aws.String("#k, #ttl")
+			keysAndAttributes.ExpressionAttributeNames = map[string]*string{
+				"#k":   aws.String(KeyAttrName),
+				"#ttl": aws.String(TTLAttrName),
+			}
+		}
+
+		requestItems := map[string]*awsdynamodb.KeysAndAttributes{
+			tableName: keysAndAttributes,
+		}
+		for attempt := 0; len(requestItems) > 0; attempt++ {
+			if attempt > 0 {
+				if attempt > maxBatchRetries {
+					return nil, gokv.Wrap(gokv.ErrThrottled, ErrUnprocessedKeys)
+				}
+				if err := sleepWithContext(ctx, retryDelay(attempt)); err != nil {
+					return nil, err
+				}
+			}
+
+			out, err := s.c.BatchGetItemWithContext(ctx, &awsdynamodb.BatchGetItemInput{RequestItems: requestItems})
+			if err != nil {
+				return nil, wrapErr(err)
+			}
+
+			for _, item := range out.Responses[tableName] {
+				if item[KeyAttrName] == nil || item[KeyAttrName].S == nil || isExpired(item, now) {
+					continue
+				}
+				items[*item[KeyAttrName].S] = item
+			}
+			requestItems = out.UnprocessedKeys
+		}
+	}
+
+	return items, nil
+}
+
+// transactGetItems reads the keys with a single TransactGetItems call,
+// which returns them all as of the same point in time.
+func (s Store) transactGetItems(ctx context.Context, bucketName string, keys []string) (map[string]map[string]*awsdynamodb.AttributeValue, error) {
+	if len(keys) > txnLimit {
+		return nil, gokv.Wrap(gokv.ErrTooLarge, ErrTooManyTxnOps)
+	}
+
+	var transactItems []*awsdynamodb.TransactGetItem
+	for _, k := range keys {
+		transactItems = append(transactItems, &awsdynamodb.TransactGetItem{
+			Get: &awsdynamodb.Get{
+				TableName: aws.String(s.table(bucketName)),
+				Key:       s.itemKey(bucketName, k),
+			},
+		})
+	}
+
+	out, err := s.c.TransactGetItemsWithContext(ctx, &awsdynamodb.TransactGetItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	items := make(map[string]map[string]*awsdynamodb.AttributeValue)
+	now := time.Now()
+	for _, resp := range out.Responses {
+		item := resp.Item
+		if item[KeyAttrName] == nil || item[KeyAttrName].S == nil || isExpired(item, now) {
+			continue
+		}
+		items[*item[KeyAttrName].S] = item
+	}
+	return items, nil
+}
+
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+// BatchDeleteWithContext deletes the keys in chunks of 25 with BatchWriteItem.
+// As BatchWriteItem does not report whether an item existed, the missing keys
+// are looked up beforehand and may be stale under concurrent writes.
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	items, err := s.batchGetItems(ctx, input.BucketName, input.Keys, true)
+	if err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	var missing []string
+	var writeRequests []*awsdynamodb.WriteRequest
+	seen := make(map[string]bool)
+	for _, k := range input.Keys {
+		if _, ok := items[k]; !ok || seen[k] {
+			missing = append(missing, k)
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		writeRequests = append(writeRequests, &awsdynamodb.WriteRequest{
+			DeleteRequest: &awsdynamodb.DeleteRequest{
+				Key: s.itemKey(input.BucketName, k),
+			},
+		})
+	}
+
+	if err := s.batchWrite(ctx, s.table(input.BucketName), writeRequests); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+// batchWrite sends writeRequests to tableName in chunks of 25 with
+// BatchWriteItem, retrying unprocessed items with exponential backoff.
+// Up to s.batchConcurrency chunks are in flight at once. Chunks that
+// still fail are reported together in a *PartialFailureError.
+func (s Store) batchWrite(ctx context.Context, tableName string, writeRequests []*awsdynamodb.WriteRequest) error {
+	var chunks [][]*awsdynamodb.WriteRequest
+	for start := 0; start < len(writeRequests); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(writeRequests) {
+			end = len(writeRequests)
+		}
+		chunks = append(chunks, writeRequests[start:end])
+	}
+
+	concurrency := s.batchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failure PartialFailureError
+	sem := make(chan struct{}, concurrency)
+	for _, chunk := range chunks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(chunk []*awsdynamodb.WriteRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			unprocessed, err := s.writeChunk(ctx, tableName, chunk)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range unprocessed {
+				failure.Keys = append(failure.Keys, writeRequestKey(r))
+			}
+			if failure.Err == nil {
+				failure.Err = err
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	if failure.Err != nil {
+		sort.Strings(failure.Keys)
+		return &failure
+	}
+	return nil
+}
+
+// writeChunk writes a single chunk of at most 25 requests. On failure it
+// returns the requests that were not written along with the cause.
+func (s Store) writeChunk(ctx context.Context, tableName string, chunk []*awsdynamodb.WriteRequest) ([]*awsdynamodb.WriteRequest, error) {
+	pending := chunk
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > maxBatchRetries {
+				return pending, gokv.Wrap(gokv.ErrThrottled, ErrUnprocessedKeys)
+			}
+			if err := sleepWithContext(ctx, retryDelay(attempt)); err != nil {
+				return pending, err
+			}
+		}
+
+		out, err := s.c.BatchWriteItemWithContext(ctx, &awsdynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*awsdynamodb.WriteRequest{
+				tableName: pending,
+			},
+		})
+		if err != nil {
+			return pending, wrapErr(err)
+		}
+		pending = out.UnprocessedItems[tableName]
+	}
+
+	return nil, nil
+}
+
+// writeRequestKey returns the item key a put or delete request targets.
+func writeRequestKey(r *awsdynamodb.WriteRequest) string {
+	var attrs map[string]*awsdynamodb.AttributeValue
+	switch {
+	case r.PutRequest != nil:
+		attrs = r.PutRequest.Item
+	case r.DeleteRequest != nil:
+		attrs = r.DeleteRequest.Key
+	}
+	if attr, ok := attrs[KeyAttrName]; ok {
+		return aws.StringValue(attr.S)
+	}
+	return ""
+}
+
 func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
 	if err := util.CheckKey(input.Key); err != nil {
 		return err
 	}
 
-	key := make(map[string]*awsdynamodb.AttributeValue)
-	key[KeyAttrName] = &awsdynamodb.AttributeValue{
-		S: &input.Key,
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
 	}
 
+	// an expired item that DynamoDB has not deleted yet counts as absent
 	deleteItemInput := awsdynamodb.DeleteItemInput{
-		TableName: aws.String(input.BucketName),
-		Key:       key,
+		TableName:           aws.String(s.table(input.BucketName)),
+		Key:                 s.itemKey(input.BucketName, input.Key),
+		ConditionExpression: aws.String("attribute_exists(#k) AND (attribute_not_exists(#ttl) OR #ttl > :now)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#k":   aws.String(KeyAttrName),
+			"#ttl": aws.String(TTLAttrName),
+		},
+		ExpressionAttributeValues: map[string]*awsdynamodb.AttributeValue{
+			":now": nowAttr(),
+		},
 	}
-	_, err := s.c.DeleteItem(&deleteItemInput)
-	return err
+	_, err := s.c.DeleteItemWithContext(ctx, &deleteItemInput)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsdynamodb.ErrCodeConditionalCheckFailedException {
+		return gokv.ErrNotFound
+	}
+	return wrapErr(err)
 }
 
-func (s Store) Close() error {
-	return nil
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
 }
 
-func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
-	if err := util.CheckBucketName(input.BucketName); err != nil {
-		return types.ScanOutput{}, err
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ensureTable(ctx, input.BucketName); err != nil {
+		return err
+	}
+
+	// an expired item that DynamoDB has not deleted yet counts as absent
+	putItemInput := awsdynamodb.PutItemInput{
+		TableName:           aws.String(s.table(input.BucketName)),
+		Item:                newItem(s.itemKey(input.BucketName, input.Key), data, input.TTL),
+		ConditionExpression: aws.String("attribute_not_exists(#k) OR #ttl <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#k":   aws.String(KeyAttrName),
+			"#ttl": aws.String(TTLAttrName),
+		},
+		ExpressionAttributeValues: map[string]*awsdynamodb.AttributeValue{
+			":now": nowAttr(),
+		},
+	}
+	_, err = s.c.PutItemWithContext(ctx, &putItemInput)
+	return wrapErr(err)
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
 	}
 
-	awsScanInput := &awsdynamodb.ScanInput{
-		TableName: aws.String(input.BucketName),
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
 	}
-	awsScanOutput, err := s.c.Scan(awsScanInput)
+
+	oldData, err := s.codec.Marshal(input.OldValue)
 	if err != nil {
-		return types.ScanOutput{}, err
+		return err
 	}
 
-	var items []types.ScanOutput
-	if err = dynamodbattribute.UnmarshalListOfMaps(awsScanOutput.Items, &items); err != nil {
-		return types.ScanOutput{}, err
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
 	}
 
-	var scanOuput types.ScanOutput
-	for _, item := range items {
-		scanOuput.Keys = append(scanOuput.Keys, item.Keys...)
-		scanOuput.Values = append(scanOuput.Values, item.Values...)
+	putItemInput := awsdynamodb.PutItemInput{
+		TableName:                 aws.String(s.table(input.BucketName)),
+		Item:                      newItem(s.itemKey(input.BucketName, input.Key), newData, input.TTL),
+		ConditionExpression:       aws.String(valueMatchesCondition),
+		ExpressionAttributeNames:  valueMatchesNames(),
+		ExpressionAttributeValues: valueMatchesValues(oldData),
 	}
+	_, err = s.c.PutItemWithContext(ctx, &putItemInput)
+	return wrapErr(err)
+}
 
-	return scanOuput, nil
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
 }
 
-func (s Store) Info() (types.StoreInfo, error) {
-	return types.StoreInfo{}, ErrNotImplemented
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	deleteItemInput := awsdynamodb.DeleteItemInput{
+		TableName:                 aws.String(s.table(input.BucketName)),
+		Key:                       s.itemKey(input.BucketName, input.Key),
+		ConditionExpression:       aws.String(valueMatchesCondition),
+		ExpressionAttributeNames:  valueMatchesNames(),
+		ExpressionAttributeValues: valueMatchesValues(data),
+	}
+	_, err = s.c.DeleteItemWithContext(ctx, &deleteItemInput)
+	return wrapErr(err)
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext commits the ops with a single TransactWriteItems call,
+// which takes at most 100 items. TxnCheck ops without a condition are
+// dropped rather than sent.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	if len(input.Ops) > txnLimit {
+		return gokv.Wrap(gokv.ErrTooLarge, ErrTooManyTxnOps)
+	}
+
+	var items []*awsdynamodb.TransactWriteItem
+	// opIndex maps the position of an item in items onto its op
+	var opIndex []int
+	for i, op := range input.Ops {
+		cond, names, values, err := s.txnCondition(op)
+		if err != nil {
+			return err
+		}
+
+		item := &awsdynamodb.TransactWriteItem{}
+		switch op.Type {
+		case types.TxnSet:
+			data, err := s.codec.Marshal(op.Value)
+			if err != nil {
+				return err
+			}
+			if err := s.ensureTable(ctx, op.BucketName); err != nil {
+				return err
+			}
+			item.Put = &awsdynamodb.Put{
+				TableName:                 aws.String(s.table(op.BucketName)),
+				Item:                      newItem(s.itemKey(op.BucketName, op.Key), data, op.TTL),
+				ConditionExpression:       cond,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			}
+		case types.TxnDelete:
+			item.Delete = &awsdynamodb.Delete{
+				TableName:                 aws.String(s.table(op.BucketName)),
+				Key:                       s.itemKey(op.BucketName, op.Key),
+				ConditionExpression:       cond,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			}
+		case types.TxnCheck:
+			if cond == nil {
+				continue
+			}
+			item.ConditionCheck = &awsdynamodb.ConditionCheck{
+				TableName:                 aws.String(s.table(op.BucketName)),
+				Key:                       s.itemKey(op.BucketName, op.Key),
+				ConditionExpression:       cond,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			}
+		}
+		items = append(items, item)
+		opIndex = append(opIndex, i)
+	}
+
+	if len(items) == 0 {
+		return nil
+	}
+
+	_, err := s.c.TransactWriteItemsWithContext(ctx, &awsdynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err == nil {
+		return nil
+	}
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsdynamodb.ErrCodeTransactionCanceledException {
+		for j, reason := range cancellationReasons(aerr.Message()) {
+			if reason == "ConditionalCheckFailed" && j < len(opIndex) {
+				op := input.Ops[opIndex[j]]
+				return &gokv.TxnConflictError{Index: opIndex[j], BucketName: op.BucketName, Key: op.Key}
+			}
+		}
+		return gokv.Wrap(gokv.ErrConflict, err)
+	}
+	if err = wrapErr(err); errors.Is(err, gokv.ErrConflict) {
+		return &gokv.TxnConflictError{Index: -1}
+	}
+	return err
+}
+
+// txnCondition returns the condition expression of op, or nil if it has none.
+func (s Store) txnCondition(op types.TxnOp) (*string, map[string]*string, map[string]*awsdynamodb.AttributeValue, error) {
+	existsNames := map[string]*string{
+		"#k":   aws.String(KeyAttrName),
+		"#ttl": aws.String(TTLAttrName),
+	}
+	nowValues := map[string]*awsdynamodb.AttributeValue{
+		":now": nowAttr(),
+	}
+
+	switch op.Condition {
+	case types.TxnExists:
+		return aws.String("attribute_exists(#k) AND (attribute_not_exists(#ttl) OR #ttl > :now)"), existsNames, nowValues, nil
+	case types.TxnNotExists:
+		return aws.String("attribute_not_exists(#k) OR #ttl <= :now"), existsNames, nowValues, nil
+	case types.TxnMatches:
+		data, err := s.codec.Marshal(op.Match)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return aws.String(valueMatchesCondition), valueMatchesNames(), valueMatchesValues(data), nil
+	}
+	return nil, nil, nil, nil
+}
+
+// cancellationReasons parses the per item reasons DynamoDB lists at the
+// end of the message of a TransactionCanceledException, such as
+// "Transaction cancelled, ... [None, ConditionalCheckFailed]".
+func cancellationReasons(message string) []string {
+	start, end := strings.LastIndex(message, "["), strings.LastIndex(message, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	reasons := strings.Split(message[start+1:end], ",")
+	for i := range reasons {
+		reasons[i] = strings.TrimSpace(reasons[i])
+	}
+	return reasons
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext gives fn a ReadTx that reads with strong consistency.
+// A BatchGet reads its keys with TransactGetItems, so they reflect the
+// same point in time, and is limited to 100 keys. DynamoDB keeps no
+// snapshots, so separate reads, including the pages of a Scan, may see
+// writes made between them.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.consistentRead = aws.Bool(true)
+	return fn(readTx{ctx: ctx, s: s})
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+// DeleteBucketWithContext deletes the table backing the bucket and waits
+// until DynamoDB has finished removing it. In single-table mode the items
+// of the bucket are queried and deleted page by page instead.
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if s.options.SingleTable {
+		return s.deleteBucketItems(ctx, input.BucketName)
+	}
+
+	tableName := s.table(input.BucketName)
+	if s.tables != nil {
+		s.tables.Delete(tableName)
+	}
+
+	_, err := s.c.DeleteTableWithContext(ctx, &awsdynamodb.DeleteTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	err = s.c.WaitUntilTableNotExistsWithContext(ctx, &awsdynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	return wrapErr(err)
+}
+
+// deleteBucketItems deletes every item of bucketName from the single table.
+// It returns gokv.ErrBucketNotFound if the bucket holds no items.
+func (s Store) deleteBucketItems(ctx context.Context, bucketName string) error {
+	queryInput := &awsdynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		KeyConditionExpression: aws.String("#b = :b"),
+		ProjectionExpression:   aws.String("#b, #k"),
+		ExpressionAttributeNames: map[string]*string{
+			"#b": aws.String(BucketAttrName),
+			"#k": aws.String(KeyAttrName),
+		},
+		ExpressionAttributeValues: map[string]*awsdynamodb.AttributeValue{
+			":b": {S: aws.String(bucketName)},
+		},
+	}
+
+	deleted := 0
+	for {
+		out, err := s.c.QueryWithContext(ctx, queryInput)
+		if err != nil {
+			return wrapErr(err)
+		}
+
+		writeRequests := make([]*awsdynamodb.WriteRequest, 0, len(out.Items))
+		for _, item := range out.Items {
+			writeRequests = append(writeRequests, &awsdynamodb.WriteRequest{
+				DeleteRequest: &awsdynamodb.DeleteRequest{Key: item},
+			})
+		}
+		if err := s.batchWrite(ctx, s.tableName, writeRequests); err != nil {
+			return err
+		}
+		deleted += len(writeRequests)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		queryInput.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	if deleted == 0 {
+		return gokv.ErrBucketNotFound
+	}
+	return nil
+}
+
+// ensureTable makes sure the table of bucketName exists and is ACTIVE,
+// creating it if needed. Tables are only looked up once per store.
+func (s Store) ensureTable(ctx context.Context, bucketName string) error {
+	if s.tables == nil {
+		return nil
+	}
+	tableName := s.table(bucketName)
+	if _, ok := s.tables.Load(tableName); ok {
+		return nil
+	}
+
+	describeTableInput := &awsdynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	}
+	out, err := s.c.DescribeTableWithContext(ctx, describeTableInput)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsdynamodb.ErrCodeResourceNotFoundException {
+		if err := s.createTable(ctx, tableName); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return wrapErr(err)
+	} else if aws.StringValue(out.Table.TableStatus) != awsdynamodb.TableStatusActive {
+		if err := s.c.WaitUntilTableExistsWithContext(ctx, describeTableInput); err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	s.tables.Store(tableName, struct{}{})
+	return nil
+}
+
+// createTable creates tableName with KeyAttrName as its hash key, or in
+// single-table mode with BucketAttrName as hash and KeyAttrName as range
+// key. It waits for the table to become ACTIVE and then applies the PITR
+// and TTL settings, which DynamoDB only accepts on active tables.
+func (s Store) createTable(ctx context.Context, tableName string) error {
+	createTableInput := &awsdynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []*awsdynamodb.AttributeDefinition{{
+			AttributeName: aws.String(KeyAttrName),
+			AttributeType: aws.String(awsdynamodb.ScalarAttributeTypeS),
+		}},
+		KeySchema: []*awsdynamodb.KeySchemaElement{{
+			AttributeName: aws.String(KeyAttrName),
+			KeyType:       aws.String(awsdynamodb.KeyTypeHash),
+		}},
+		BillingMode: aws.String(s.options.BillingMode),
+	}
+	if s.options.SingleTable {
+		createTableInput.AttributeDefinitions = append(createTableInput.AttributeDefinitions, &awsdynamodb.AttributeDefinition{
+			AttributeName: aws.String(BucketAttrName),
+			AttributeType: aws.String(awsdynamodb.ScalarAttributeTypeS),
+		})
+		createTableInput.KeySchema = []*awsdynamodb.KeySchemaElement{{
+			AttributeName: aws.String(BucketAttrName),
+			KeyType:       aws.String(awsdynamodb.KeyTypeHash),
+		}, {
+			AttributeName: aws.String(KeyAttrName),
+			KeyType:       aws.String(awsdynamodb.KeyTypeRange),
+		}}
+	}
+	if s.options.EnableStreams {
+		createTableInput.StreamSpecification = &awsdynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(awsdynamodb.StreamViewTypeKeysOnly),
+		}
+	}
+	if s.options.BillingMode == awsdynamodb.BillingModeProvisioned {
+		createTableInput.ProvisionedThroughput = &awsdynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(s.options.ReadCapacityUnits),
+			WriteCapacityUnits: aws.Int64(s.options.WriteCapacityUnits),
+		}
+	}
+
+	// another writer may be creating the same table, so just wait for it
+	_, err := s.c.CreateTableWithContext(ctx, createTableInput)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == awsdynamodb.ErrCodeResourceInUseException {
+		err = nil
+	}
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	err = s.c.WaitUntilTableExistsWithContext(ctx, &awsdynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if s.options.PointInTimeRecovery {
+		_, err := s.c.UpdateContinuousBackupsWithContext(ctx, &awsdynamodb.UpdateContinuousBackupsInput{
+			TableName: aws.String(tableName),
+			PointInTimeRecoverySpecification: &awsdynamodb.PointInTimeRecoverySpecification{
+				PointInTimeRecoveryEnabled: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	if s.options.EnableTTL {
+		_, err := s.c.UpdateTimeToLiveWithContext(ctx, &awsdynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(tableName),
+			TimeToLiveSpecification: &awsdynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String(TTLAttrName),
+				Enabled:       aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	return nil
+}
+
+func (s Store) Close() error {
+	return nil
+}
+
+func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext scans the table of the bucket. In single-table mode it
+// queries the partition of the bucket instead, returning keys in order.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	// DynamoDB deletes expired items lazily, so filter them out explicitly
+	filters := []string{"(attribute_not_exists(#ttl) OR #ttl > :now)"}
+	names := map[string]*string{
+		"#ttl": aws.String(TTLAttrName),
+	}
+	values := map[string]*awsdynamodb.AttributeValue{
+		":now": nowAttr(),
+	}
+
+	var keyCondition string
+	if s.options.SingleTable {
+		// a query accepts a single condition on the sort key and no filter
+		// on key attributes, so the other bounds are checked on the results
+		keyCondition = "#b = :b"
+		names["#b"] = aws.String(BucketAttrName)
+		values[":b"] = &awsdynamodb.AttributeValue{S: aws.String(input.BucketName)}
+		switch {
+		case input.Prefix != "":
+			keyCondition += " AND begins_with(#k, :prefix)"
+			values[":prefix"] = &awsdynamodb.AttributeValue{S: aws.String(input.Prefix)}
+		case input.StartKey != "":
+			keyCondition += " AND #k >= :start"
+			values[":start"] = &awsdynamodb.AttributeValue{S: aws.String(input.StartKey)}
+		case input.EndKey != "":
+			keyCondition += " AND #k < :end"
+			values[":end"] = &awsdynamodb.AttributeValue{S: aws.String(input.EndKey)}
+		}
+		if keyCondition != "#b = :b" {
+			names["#k"] = aws.String(KeyAttrName)
+		}
+	} else {
+		if input.Prefix != "" {
+			filters = append(filters, "begins_with(#k, :prefix)")
+			values[":prefix"] = &awsdynamodb.AttributeValue{S: aws.String(input.Prefix)}
+		}
+		if input.StartKey != "" {
+			filters = append(filters, "#k >= :start")
+			values[":start"] = &awsdynamodb.AttributeValue{S: aws.String(input.StartKey)}
+		}
+		if input.EndKey != "" {
+			filters = append(filters, "#k < :end")
+			values[":end"] = &awsdynamodb.AttributeValue{S: aws.String(input.EndKey)}
+		}
+		if len(filters) > 1 {
+			names["#k"] = aws.String(KeyAttrName)
+		}
+	}
+
+	var limit *int64
+	if input.Limit > 0 {
+		limit = aws.Int64(int64(input.Limit))
+	}
+
+	var exclusiveStartKey map[string]*awsdynamodb.AttributeValue
+	if input.StartToken != "" {
+		var err error
+		if exclusiveStartKey, err = decodeToken(input.StartToken); err != nil {
+			return types.ScanOutput{}, err
+		}
+	}
+
+	// without a limit keep following LastEvaluatedKey, as a single
+	// scan or query call stops after reading 1 MB of data
+	var scanOutput types.ScanOutput
+	for {
+		var items []map[string]*awsdynamodb.AttributeValue
+		var lastEvaluatedKey map[string]*awsdynamodb.AttributeValue
+		if s.options.SingleTable {
+			out, err := s.c.QueryWithContext(ctx, &awsdynamodb.QueryInput{
+				TableName:                 aws.String(s.tableName),
+				KeyConditionExpression:    aws.String(keyCondition),
+				FilterExpression:          aws.String(strings.Join(filters, " AND ")),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+				Limit:                     limit,
+				ExclusiveStartKey:         exclusiveStartKey,
+				ConsistentRead:            s.consistentRead,
+			})
+			if err != nil {
+				return types.ScanOutput{}, wrapErr(err)
+			}
+			items, lastEvaluatedKey = out.Items, out.LastEvaluatedKey
+		} else {
+			out, err := s.c.ScanWithContext(ctx, &awsdynamodb.ScanInput{
+				TableName:                 aws.String(s.table(input.BucketName)),
+				FilterExpression:          aws.String(strings.Join(filters, " AND ")),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+				Limit:                     limit,
+				ExclusiveStartKey:         exclusiveStartKey,
+				ConsistentRead:            s.consistentRead,
+			})
+			if err != nil {
+				return types.ScanOutput{}, wrapErr(err)
+			}
+			items, lastEvaluatedKey = out.Items, out.LastEvaluatedKey
+		}
+
+		for _, item := range items {
+			data := itemValue(item)
+			if item[KeyAttrName] == nil || item[KeyAttrName].S == nil || data == nil {
+				continue
+			}
+			k := *item[KeyAttrName].S
+			if !util.InScanRange(k, input.Prefix, input.StartKey, input.EndKey) {
+				continue
+			}
+			scanOutput.Keys = append(scanOutput.Keys, k)
+			scanOutput.Values = append(scanOutput.Values, data)
+		}
+
+		if len(lastEvaluatedKey) == 0 {
+			break
+		}
+
+		if input.Limit > 0 {
+			var err error
+			if scanOutput.NextToken, err = encodeToken(lastEvaluatedKey); err != nil {
+				return types.ScanOutput{}, err
+			}
+			break
+		}
+		exclusiveStartKey = lastEvaluatedKey
+	}
+
+	return scanOutput, nil
+}
+
+func (s Store) Info() (types.StoreInfo, error) {
+	return s.InfoWithContext(context.Background())
+}
+
+// InfoWithContext describes the tables of the store with DescribeTable.
+// Without single-table mode every table named with TablePrefix counts as
+// a bucket. DynamoDB refreshes the item counts and sizes about every six
+// hours.
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	tableNames := []string{s.tableName}
+	var bucketNames []string
+	if !s.options.SingleTable {
+		var err error
+		if bucketNames, err = s.listTables(ctx); err != nil {
+			return types.StoreInfo{}, err
+		}
+		tableNames = make([]string, len(bucketNames))
+		for i, bucketName := range bucketNames {
+			tableNames[i] = s.table(bucketName)
+		}
+	}
+
+	info := types.StoreInfo{Name: s.tableName}
+	for i, tableName := range tableNames {
+		out, err := s.c.DescribeTableWithContext(ctx, &awsdynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		})
+		if err != nil {
+			return types.StoreInfo{}, wrapErr(err)
+		}
+
+		table := out.Table
+		items, size := aws.Int64Value(table.ItemCount), aws.Int64Value(table.TableSizeBytes)
+		info.Items += items
+		info.Size += size
+		if table.ProvisionedThroughput != nil {
+			info.ReadCapacityUnits += aws.Int64Value(table.ProvisionedThroughput.ReadCapacityUnits)
+			info.WriteCapacityUnits += aws.Int64Value(table.ProvisionedThroughput.WriteCapacityUnits)
+		}
+		if !s.options.SingleTable {
+			info.Buckets = append(info.Buckets, types.BucketInfo{Name: bucketNames[i], Items: items, Size: size})
+		}
+	}
+	info.UsedBytes = info.Size
+
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext describes every table named with TablePrefix as a
+// bucket. In single-table mode it scans the keys of the table instead, counting
+// the items of each distinct partition, and cannot report sizes.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	if s.options.SingleTable {
+		return s.listPartitions(ctx)
+	}
+
+	bucketNames, err := s.listTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]types.BucketInfo, 0, len(bucketNames))
+	for _, bucketName := range bucketNames {
+		bi, err := s.BucketInfoWithContext(ctx, types.BucketInfoInput{BucketName: bucketName})
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bi)
+	}
+	return buckets, nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+// BucketInfoWithContext describes the table of the bucket. In single-table
+// mode it counts the items of the bucket partition with a query instead.
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	info := types.BucketInfo{Name: input.BucketName}
+	if !s.options.SingleTable {
+		out, err := s.c.DescribeTableWithContext(ctx, &awsdynamodb.DescribeTableInput{
+			TableName: aws.String(s.table(input.BucketName)),
+		})
+		if err != nil {
+			return types.BucketInfo{}, wrapErr(err)
+		}
+		info.Items = aws.Int64Value(out.Table.ItemCount)
+		info.Size = aws.Int64Value(out.Table.TableSizeBytes)
+		return info, nil
+	}
+
+	queryInput := &awsdynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		KeyConditionExpression: aws.String("#b = :b"),
+		Select:                 aws.String(awsdynamodb.SelectCount),
+		ExpressionAttributeNames: map[string]*string{
+			"#b": aws.String(BucketAttrName),
+		},
+		ExpressionAttributeValues: map[string]*awsdynamodb.AttributeValue{
+			":b": {S: aws.String(input.BucketName)},
+		},
+	}
+	for {
+		out, err := s.c.QueryWithContext(ctx, queryInput)
+		if err != nil {
+			return types.BucketInfo{}, wrapErr(err)
+		}
+		info.Items += aws.Int64Value(out.Count)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		queryInput.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	if info.Items == 0 {
+		return types.BucketInfo{}, gokv.ErrBucketNotFound
+	}
+	return info, nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+// ExistsWithContext reads only the key and expiry of the item.
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	out, err := s.c.GetItemWithContext(ctx, &awsdynamodb.GetItemInput{
+		TableName:            aws.String(s.table(input.BucketName)),
+		Key:                  s.itemKey(input.BucketName, input.Key),
+		ProjectionExpression: aws.String("#k, #ttl"),
+		ExpressionAttributeNames: map[string]*string{
+			"#k":   aws.String(KeyAttrName),
+			"#ttl": aws.String(TTLAttrName),
+		},
+	})
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return out.Item != nil && !isExpired(out.Item, time.Now()), nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext reads the counter and writes its new value back
+// under the condition that it still holds the value read, starting over
+// when another writer got there first. Counters are kept as decimal text
+// like the values Set writes, so CompareAndSwap and DeleteIf match them,
+// and a counter that would overflow is never written. An expired counter
+// that DynamoDB has not deleted yet is replaced by a new one holding Delta.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := s.ensureTable(ctx, input.BucketName); err != nil {
+		return 0, err
+	}
+
+	tableName := s.table(input.BucketName)
+	key := s.itemKey(input.BucketName, input.Key)
+	for {
+		out, err := s.c.GetItemWithContext(ctx, &awsdynamodb.GetItemInput{
+			TableName:      aws.String(tableName),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return 0, wrapErr(err)
+		}
+
+		var data []byte
+		found := out.Item != nil && !isExpired(out.Item, time.Now())
+		if found {
+			if data = itemValue(out.Item); data == nil {
+				return 0, util.ErrNotCounter
+			}
+		}
+		n, newData, err := util.Increment(data, input.Delta)
+		if err != nil {
+			return 0, err
+		}
+
+		if found {
+			values := valueMatchesValues(data)
+			values[":n"] = &awsdynamodb.AttributeValue{B: newData}
+			_, err = s.c.UpdateItemWithContext(ctx, &awsdynamodb.UpdateItemInput{
+				TableName:                 aws.String(tableName),
+				Key:                       key,
+				UpdateExpression:          aws.String("SET #v = :n"),
+				ConditionExpression:       aws.String(valueMatchesCondition),
+				ExpressionAttributeNames:  valueMatchesNames(),
+				ExpressionAttributeValues: values,
+			})
+		} else {
+			_, err = s.c.PutItemWithContext(ctx, &awsdynamodb.PutItemInput{
+				TableName:           aws.String(tableName),
+				Item:                newItem(key, newData, 0),
+				ConditionExpression: aws.String("attribute_not_exists(#v) OR #ttl <= :now"),
+				ExpressionAttributeNames: map[string]*string{
+					"#v":   aws.String(ValAttrName),
+					"#ttl": aws.String(TTLAttrName),
+				},
+				ExpressionAttributeValues: map[string]*awsdynamodb.AttributeValue{
+					":now": nowAttr(),
+				},
+			})
+		}
+		if err == nil {
+			return n, nil
+		}
+		// another writer changed the counter since it was read; start over
+		if err = wrapErr(err); !errors.Is(err, gokv.ErrConflict) {
+			return 0, err
+		}
+	}
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+// CountWithContext counts the unexpired items of the bucket with a scan of
+// its table, or a query of its partition in single-table mode, that only
+// returns the number of matching items.
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	filter := aws.String("attribute_not_exists(#ttl) OR #ttl > :now")
+	names := map[string]*string{
+		"#ttl": aws.String(TTLAttrName),
+	}
+	values := map[string]*awsdynamodb.AttributeValue{
+		":now": nowAttr(),
+	}
+
+	var n int64
+	var exclusiveStartKey map[string]*awsdynamodb.AttributeValue
+	for {
+		var count *int64
+		var lastEvaluatedKey map[string]*awsdynamodb.AttributeValue
+		if s.options.SingleTable {
+			names["#b"] = aws.String(BucketAttrName)
+			values[":b"] = &awsdynamodb.AttributeValue{S: aws.String(input.BucketName)}
+			out, err := s.c.QueryWithContext(ctx, &awsdynamodb.QueryInput{
+				TableName:                 aws.String(s.tableName),
+				KeyConditionExpression:    aws.String("#b = :b"),
+				FilterExpression:          filter,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+				Select:                    aws.String(awsdynamodb.SelectCount),
+				ExclusiveStartKey:         exclusiveStartKey,
+			})
+			if err != nil {
+				return 0, wrapErr(err)
+			}
+			count, lastEvaluatedKey = out.Count, out.LastEvaluatedKey
+		} else {
+			out, err := s.c.ScanWithContext(ctx, &awsdynamodb.ScanInput{
+				TableName:                 aws.String(s.table(input.BucketName)),
+				FilterExpression:          filter,
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+				Select:                    aws.String(awsdynamodb.SelectCount),
+				ExclusiveStartKey:         exclusiveStartKey,
+			})
+			if err != nil {
+				return 0, wrapErr(err)
+			}
+			count, lastEvaluatedKey = out.Count, out.LastEvaluatedKey
+		}
+		n += aws.Int64Value(count)
+
+		if len(lastEvaluatedKey) == 0 {
+			break
+		}
+		exclusiveStartKey = lastEvaluatedKey
+	}
+
+	return n, nil
+}
+
+// listPartitions scans the bucket attribute of the single table
+// and counts the items of every bucket.
+func (s Store) listPartitions(ctx context.Context) ([]types.BucketInfo, error) {
+	scanInput := &awsdynamodb.ScanInput{
+		TableName:            aws.String(s.tableName),
+		ProjectionExpression: aws.String("#b"),
+		ExpressionAttributeNames: map[string]*string{
+			"#b": aws.String(BucketAttrName),
+		},
+	}
+
+	counts := make(map[string]int64)
+	for {
+		out, err := s.c.ScanWithContext(ctx, scanInput)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		for _, item := range out.Items {
+			if item[BucketAttrName] != nil && item[BucketAttrName].S != nil {
+				counts[*item[BucketAttrName].S]++
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		scanInput.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	buckets := make([]types.BucketInfo, 0, len(counts))
+	for name, n := range counts {
+		buckets = append(buckets, types.BucketInfo{Name: name, Items: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets, nil
+}
+
+// listTables returns the names of the buckets whose tables carry
+// TablePrefix, following ListTables pages.
+func (s Store) listTables(ctx context.Context) ([]string, error) {
+	var bucketNames []string
+	input := &awsdynamodb.ListTablesInput{}
+	for {
+		out, err := s.c.ListTablesWithContext(ctx, input)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		for _, tableName := range aws.StringValueSlice(out.TableNames) {
+			if strings.HasPrefix(tableName, s.options.TablePrefix) && len(tableName) > len(s.options.TablePrefix) {
+				bucketNames = append(bucketNames, strings.TrimPrefix(tableName, s.options.TablePrefix))
+			}
+		}
+
+		if out.LastEvaluatedTableName == nil {
+			break
+		}
+		input.ExclusiveStartTableName = out.LastEvaluatedTableName
+	}
+	return bucketNames, nil
+}
+
+// table returns the name of the table holding bucketName.
+func (s Store) table(bucketName string) string {
+	if s.options.SingleTable {
+		return s.tableName
+	}
+	return s.options.TablePrefix + bucketName
+}
+
+// itemKey returns the primary key of key in bucketName.
+func (s Store) itemKey(bucketName, key string) map[string]*awsdynamodb.AttributeValue {
+	itemKey := map[string]*awsdynamodb.AttributeValue{
+		KeyAttrName: {S: aws.String(key)},
+	}
+	if s.options.SingleTable {
+		itemKey[BucketAttrName] = &awsdynamodb.AttributeValue{S: aws.String(bucketName)}
+	}
+	return itemKey
+}
+
+// retryDelay returns the exponential backoff before the given retry attempt,
+// with full jitter to spread out concurrent retries.
+func retryDelay(attempt int) time.Duration {
+	d := retryBaseDelay << uint(attempt-1)
+	return time.Duration(rand.Int63n(int64(d))) + time.Millisecond
+}
+
+// sleepWithContext waits for d or until ctx is done.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// encodeToken turns the last evaluated key of a scan into an opaque token.
+func encodeToken(key map[string]*awsdynamodb.AttributeValue) (string, error) {
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeToken reverses encodeToken.
+func decodeToken(token string) (map[string]*awsdynamodb.AttributeValue, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, util.ErrInvalidToken
+	}
+
+	var key map[string]*awsdynamodb.AttributeValue
+	if err := json.Unmarshal(b, &key); err != nil || len(key) == 0 {
+		return nil, util.ErrInvalidToken
+	}
+	return key, nil
+}
+
+// valueMatchesCondition holds when an unexpired item stores the value bound to :v.
+const valueMatchesCondition = "#v = :v AND (attribute_not_exists(#ttl) OR #ttl > :now)"
+
+func valueMatchesNames() map[string]*string {
+	return map[string]*string{
+		"#v":   aws.String(ValAttrName),
+		"#ttl": aws.String(TTLAttrName),
+	}
+}
+
+func valueMatchesValues(data []byte) map[string]*awsdynamodb.AttributeValue {
+	return map[string]*awsdynamodb.AttributeValue{
+		":v":   {B: data},
+		":now": nowAttr(),
+	}
+}
+
+// newItem builds the attributes stored for the item with the given key attributes.
+func newItem(key map[string]*awsdynamodb.AttributeValue, data []byte, ttl time.Duration) map[string]*awsdynamodb.AttributeValue {
+	item := map[string]*awsdynamodb.AttributeValue{
+		ValAttrName: {
+			B: data,
+		},
+	}
+	for name, attr := range key {
+		item[name] = attr
+	}
+	if ttl > 0 {
+		item[TTLAttrName] = expiryAttr(ttl)
+	}
+	return item
+}
+
+// itemValue returns the encoded value of item, or nil when the item holds
+// no value.
+func itemValue(item map[string]*awsdynamodb.AttributeValue) []byte {
+	if attr := item[ValAttrName]; attr != nil {
+		return attr.B
+	}
+	return nil
+}
+
+// nowAttr returns the current time in epoch seconds, comparable to TTLAttrName.
+func nowAttr() *awsdynamodb.AttributeValue {
+	return &awsdynamodb.AttributeValue{N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))}
+}
+
+// expiryAttr returns the TTL attribute of an item expiring after ttl,
+// rounded up to the next second.
+func expiryAttr(ttl time.Duration) *awsdynamodb.AttributeValue {
+	expiresAt := time.Now().Add(ttl)
+	sec := expiresAt.Unix()
+	if expiresAt.Nanosecond() > 0 {
+		sec++
+	}
+	return &awsdynamodb.AttributeValue{N: aws.String(strconv.FormatInt(sec, 10))}
+}
+
+// isExpired reports whether item carries a TTL attribute that is not after now.
+func isExpired(item map[string]*awsdynamodb.AttributeValue, now time.Time) bool {
+	attr := item[TTLAttrName]
+	if attr == nil || attr.N == nil {
+		return false
+	}
+
+	sec, err := strconv.ParseInt(*attr.N, 10, 64)
+	if err != nil {
+		return false
+	}
+	return sec <= now.Unix()
+}
+
+// wrapErr maps error codes returned by the AWS SDK
+// onto their gokv equivalents.
+func wrapErr(err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+
+	switch aerr.Code() {
+	case awsdynamodb.ErrCodeResourceNotFoundException:
+		return gokv.Wrap(gokv.ErrBucketNotFound, err)
+	case awsdynamodb.ErrCodeConditionalCheckFailedException,
+		awsdynamodb.ErrCodeTransactionConflictException,
+		awsdynamodb.ErrCodeTransactionCanceledException:
+		return gokv.Wrap(gokv.ErrConflict, err)
+	case awsdynamodb.ErrCodeItemCollectionSizeLimitExceededException:
+		return gokv.Wrap(gokv.ErrTooLarge, err)
+	case awsdynamodb.ErrCodeProvisionedThroughputExceededException,
+		awsdynamodb.ErrCodeRequestLimitExceeded,
+		"ThrottlingException":
+		return gokv.Wrap(gokv.ErrThrottled, err)
+	case awsdynamodb.ErrCodeInternalServerError,
+		"ServiceUnavailable",
+		"RequestError",
+		request.ErrCodeSerialization:
+		return gokv.Wrap(gokv.ErrUnavailable, err)
+	case "ValidationException":
+		if strings.Contains(aerr.Message(), "size has exceeded") {
+			return gokv.Wrap(gokv.ErrTooLarge, err)
+		}
+	}
+	return err
 }
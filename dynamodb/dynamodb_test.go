@@ -1,14 +1,22 @@
 package dynamodb
 
 import (
+	"context"
 	"errors"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/simar7/gokv"
 	"github.com/simar7/gokv/util"
 
 	"github.com/simar7/gokv/types"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 
@@ -21,12 +29,93 @@ type mockDynamoDB struct {
 	dynamodbiface.DynamoDBAPI
 	putItem        func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
 	getItem        func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	updateItem     func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+	transactWrite  func(*dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error)
+	transactGet    func(*dynamodb.TransactGetItemsInput) (*dynamodb.TransactGetItemsOutput, error)
 	deleteItem     func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
 	batchWriteItem func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	batchGetItem   func(*dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
 	scan           func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+	deleteTable    func(*dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error)
+	describeTable  func(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error)
+	createTable    func(*dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error)
+	query          func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	listTables     func(*dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error)
+	// calls records the table management calls made, in order.
+	calls *[]string
 }
 
-func (md mockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (md mockDynamoDB) record(call string) {
+	if md.calls != nil {
+		*md.calls = append(*md.calls, call)
+	}
+}
+
+func (md mockDynamoDB) DescribeTableWithContext(_ context.Context, input *dynamodb.DescribeTableInput, _ ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	md.record("DescribeTable")
+	if md.describeTable != nil {
+		return md.describeTable(input)
+	}
+
+	return &dynamodb.DescribeTableOutput{
+		Table: &dynamodb.TableDescription{TableStatus: aws.String(dynamodb.TableStatusActive)},
+	}, nil
+}
+
+func (md mockDynamoDB) QueryWithContext(_ context.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	if md.query != nil {
+		return md.query(input)
+	}
+
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (md mockDynamoDB) ListTablesWithContext(_ context.Context, input *dynamodb.ListTablesInput, _ ...request.Option) (*dynamodb.ListTablesOutput, error) {
+	if md.listTables != nil {
+		return md.listTables(input)
+	}
+
+	return &dynamodb.ListTablesOutput{}, nil
+}
+
+func (md mockDynamoDB) CreateTableWithContext(_ context.Context, input *dynamodb.CreateTableInput, _ ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	md.record("CreateTable")
+	if md.createTable != nil {
+		return md.createTable(input)
+	}
+
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (md mockDynamoDB) WaitUntilTableExistsWithContext(context.Context, *dynamodb.DescribeTableInput, ...request.WaiterOption) error {
+	md.record("WaitUntilTableExists")
+	return nil
+}
+
+func (md mockDynamoDB) WaitUntilTableNotExistsWithContext(context.Context, *dynamodb.DescribeTableInput, ...request.WaiterOption) error {
+	md.record("WaitUntilTableNotExists")
+	return nil
+}
+
+func (md mockDynamoDB) UpdateContinuousBackupsWithContext(context.Context, *dynamodb.UpdateContinuousBackupsInput, ...request.Option) (*dynamodb.UpdateContinuousBackupsOutput, error) {
+	md.record("UpdateContinuousBackups")
+	return &dynamodb.UpdateContinuousBackupsOutput{}, nil
+}
+
+func (md mockDynamoDB) UpdateTimeToLiveWithContext(context.Context, *dynamodb.UpdateTimeToLiveInput, ...request.Option) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	md.record("UpdateTimeToLive")
+	return &dynamodb.UpdateTimeToLiveOutput{}, nil
+}
+
+func (md mockDynamoDB) DeleteTableWithContext(_ context.Context, input *dynamodb.DeleteTableInput, _ ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	if md.deleteTable != nil {
+		return md.deleteTable(input)
+	}
+
+	return &dynamodb.DeleteTableOutput{}, nil
+}
+
+func (md mockDynamoDB) PutItemWithContext(_ context.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
 	if md.putItem != nil {
 		return md.putItem(input)
 	}
@@ -34,7 +123,7 @@ func (md mockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemO
 	return &dynamodb.PutItemOutput{}, nil
 }
 
-func (md mockDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (md mockDynamoDB) GetItemWithContext(_ context.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
 	if md.getItem != nil {
 		return md.getItem(input)
 	}
@@ -42,7 +131,31 @@ func (md mockDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemO
 	return &dynamodb.GetItemOutput{}, nil
 }
 
-func (md mockDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+func (md mockDynamoDB) UpdateItemWithContext(_ context.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	if md.updateItem != nil {
+		return md.updateItem(input)
+	}
+
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (md mockDynamoDB) TransactWriteItemsWithContext(_ context.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	if md.transactWrite != nil {
+		return md.transactWrite(input)
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (md mockDynamoDB) TransactGetItemsWithContext(_ context.Context, input *dynamodb.TransactGetItemsInput, _ ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
+	if md.transactGet != nil {
+		return md.transactGet(input)
+	}
+
+	return &dynamodb.TransactGetItemsOutput{}, nil
+}
+
+func (md mockDynamoDB) DeleteItemWithContext(_ context.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
 	if md.deleteItem != nil {
 		return md.deleteItem(input)
 	}
@@ -50,7 +163,7 @@ func (md mockDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.De
 	return &dynamodb.DeleteItemOutput{}, nil
 }
 
-func (md mockDynamoDB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+func (md mockDynamoDB) BatchWriteItemWithContext(_ context.Context, input *dynamodb.BatchWriteItemInput, _ ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
 	if md.batchWriteItem != nil {
 		return md.batchWriteItem(input)
 	}
@@ -58,7 +171,15 @@ func (md mockDynamoDB) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dyn
 	return &dynamodb.BatchWriteItemOutput{}, nil
 }
 
-func (md mockDynamoDB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+func (md mockDynamoDB) BatchGetItemWithContext(_ context.Context, input *dynamodb.BatchGetItemInput, _ ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	if md.batchGetItem != nil {
+		return md.batchGetItem(input)
+	}
+
+	return &dynamodb.BatchGetItemOutput{}, nil
+}
+
+func (md mockDynamoDB) ScanWithContext(_ context.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
 	if md.scan != nil {
 		return md.scan(input)
 	}
@@ -75,7 +196,7 @@ func TestStore_Set(t *testing.T) {
 	assert.NoError(t, err)
 	s.c = mockDynamoDB{
 		putItem: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, e error) {
-			assert.Equal(t, "testing", *input.TableName)
+			assert.Equal(t, "gokv_testing", *input.TableName)
 			assert.Equal(t, "foo", *input.Item[KeyAttrName].S)
 			assert.Equal(t, []byte(`"bar"`), input.Item[ValAttrName].B)
 			return &dynamodb.PutItemOutput{}, nil
@@ -121,7 +242,7 @@ func TestStore_Get(t *testing.T) {
 	assert.NoError(t, err)
 	s.c = mockDynamoDB{
 		getItem: func(input *dynamodb.GetItemInput) (output *dynamodb.GetItemOutput, e error) {
-			assert.Equal(t, "testing", *input.TableName)
+			assert.Equal(t, "gokv_testing", *input.TableName)
 			assert.Equal(t, "foo", *input.Key[KeyAttrName].S)
 			return &dynamodb.GetItemOutput{
 				Item: map[string]*dynamodb.AttributeValue{
@@ -148,6 +269,104 @@ func TestStore_Get(t *testing.T) {
 	assert.NoError(t, s.Close())
 }
 
+func TestStore_TTL(t *testing.T) {
+	s, err := NewStore(Options{
+		Region:         "ca-test-1",
+		TableName:      "gokvtesttable",
+		CustomEndpoint: "https://foo.bar/test",
+	})
+	assert.NoError(t, err)
+
+	t.Run("happy path, ttl attribute is written", func(t *testing.T) {
+		s.c = mockDynamoDB{
+			putItem: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, e error) {
+				expiresAt, err := strconv.ParseInt(*input.Item[TTLAttrName].N, 10, 64)
+				assert.NoError(t, err)
+				assert.InDelta(t, time.Now().Add(time.Hour).Unix(), expiresAt, 2)
+				return &dynamodb.PutItemOutput{}, nil
+			},
+		}
+
+		assert.NoError(t, s.Set(types.SetItemInput{
+			Key:        "foo",
+			Value:      "bar",
+			BucketName: "testing",
+			TTL:        time.Hour,
+		}))
+	})
+
+	t.Run("happy path, expired item is not returned", func(t *testing.T) {
+		s.c = mockDynamoDB{
+			getItem: func(input *dynamodb.GetItemInput) (output *dynamodb.GetItemOutput, e error) {
+				return &dynamodb.GetItemOutput{
+					Item: map[string]*dynamodb.AttributeValue{
+						KeyAttrName: {S: aws.String("foo")},
+						ValAttrName: {B: []byte(`"bar"`)},
+						TTLAttrName: {N: aws.String(strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))},
+					},
+				}, nil
+			},
+		}
+
+		var actualValue string
+		found, err := s.Get(types.GetItemInput{
+			Key:        "foo",
+			Value:      &actualValue,
+			BucketName: "testing",
+		})
+		assert.NoError(t, err)
+		assert.False(t, found)
+		assert.Empty(t, actualValue)
+	})
+}
+
+func TestStore_ConditionalWrites(t *testing.T) {
+	s, err := NewStore(Options{
+		Region:         "ca-test-1",
+		TableName:      "gokvtesttable",
+		CustomEndpoint: "https://foo.bar/test",
+	})
+	assert.NoError(t, err)
+
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+
+	t.Run("set if not exists", func(t *testing.T) {
+		s.c = mockDynamoDB{
+			putItem: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, e error) {
+				assert.Equal(t, "attribute_not_exists(#k) OR #ttl <= :now", *input.ConditionExpression)
+				return nil, conditionFailed
+			},
+		}
+		err := s.SetIfNotExists(types.SetItemInput{Key: "foo", Value: "bar", BucketName: "testing"})
+		assert.True(t, errors.Is(err, gokv.ErrConflict))
+	})
+
+	t.Run("compare and swap", func(t *testing.T) {
+		s.c = mockDynamoDB{
+			putItem: func(input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, e error) {
+				assert.Equal(t, valueMatchesCondition, *input.ConditionExpression)
+				assert.Equal(t, []byte(`"bar"`), input.ExpressionAttributeValues[":v"].B)
+				assert.Equal(t, []byte(`"baz"`), input.Item[ValAttrName].B)
+				return &dynamodb.PutItemOutput{}, nil
+			},
+		}
+		assert.NoError(t, s.CompareAndSwap(types.CompareAndSwapInput{
+			Key: "foo", OldValue: "bar", NewValue: "baz", BucketName: "testing"}))
+	})
+
+	t.Run("delete if", func(t *testing.T) {
+		s.c = mockDynamoDB{
+			deleteItem: func(input *dynamodb.DeleteItemInput) (output *dynamodb.DeleteItemOutput, e error) {
+				assert.Equal(t, valueMatchesCondition, *input.ConditionExpression)
+				assert.Equal(t, []byte(`"bar"`), input.ExpressionAttributeValues[":v"].B)
+				return nil, conditionFailed
+			},
+		}
+		err := s.DeleteIf(types.DeleteIfInput{Key: "foo", Value: "bar", BucketName: "testing"})
+		assert.True(t, errors.Is(err, gokv.ErrConflict))
+	})
+}
+
 func TestStore_Delete(t *testing.T) {
 	s, err := NewStore(Options{
 		Region:         "ca-test-1",
@@ -156,14 +375,34 @@ func TestStore_Delete(t *testing.T) {
 	})
 	assert.NoError(t, err)
 	s.c = mockDynamoDB{deleteItem: func(input *dynamodb.DeleteItemInput) (output *dynamodb.DeleteItemOutput, e error) {
-		assert.Equal(t, "testing", *input.TableName)
+		assert.Equal(t, "gokv_testing", *input.TableName)
 		assert.Equal(t, "foo", *input.Key[KeyAttrName].S)
+		assert.Equal(t, "attribute_exists(#k) AND (attribute_not_exists(#ttl) OR #ttl > :now)", *input.ConditionExpression)
+		assert.Equal(t, TTLAttrName, *input.ExpressionAttributeNames["#ttl"])
 		return &dynamodb.DeleteItemOutput{}, nil
 	}}
 
 	assert.NoError(t, s.Delete(types.DeleteItemInput{Key: "foo", BucketName: "testing"}))
 	assert.NoError(t, s.Close())
 
+	t.Run("sad path: key not found or expired", func(t *testing.T) {
+		s.c = mockDynamoDB{deleteItem: func(input *dynamodb.DeleteItemInput) (output *dynamodb.DeleteItemOutput, e error) {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+		}}
+		assert.Equal(t, gokv.ErrNotFound, s.Delete(types.DeleteItemInput{Key: "foo", BucketName: "testing"}))
+	})
+
+	t.Run("sad path: empty bucket name", func(t *testing.T) {
+		assert.Equal(t, util.ErrEmptyBucketName, s.Delete(types.DeleteItemInput{Key: "foo"}))
+	})
+
+	t.Run("sad path: table not found", func(t *testing.T) {
+		s.c = mockDynamoDB{deleteItem: func(input *dynamodb.DeleteItemInput) (output *dynamodb.DeleteItemOutput, e error) {
+			return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "table not found", nil)
+		}}
+		err := s.Delete(types.DeleteItemInput{Key: "foo", BucketName: "testing"})
+		assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+	})
 }
 
 func TestStore_BatchSet(t *testing.T) {
@@ -181,7 +420,7 @@ func TestStore_BatchSet(t *testing.T) {
 			for k := range input.RequestItems { // since there's only one key
 				inputKey = k
 			}
-			assert.Equal(t, "testing", inputKey)
+			assert.Equal(t, "gokv_testing", inputKey)
 
 			assert.Equal(t, []*dynamodb.WriteRequest{
 				{
@@ -222,6 +461,224 @@ func TestStore_BatchSet(t *testing.T) {
 
 }
 
+func TestStore_BatchSet_Chunks(t *testing.T) {
+	keys := make([]string, 60)
+	values := make([]string, 60)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		values[i] = "val" + strconv.Itoa(i)
+	}
+
+	t.Run("happy path, chunks of 25 with unprocessed items retried", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+
+		var mu sync.Mutex
+		var calls int
+		written := make(map[string]bool)
+		s.c = mockDynamoDB{
+			batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+
+				requests := input.RequestItems["testing"]
+				assert.True(t, len(requests) <= 25)
+
+				// Leave the last item of every full chunk unprocessed once.
+				if len(requests) == 25 {
+					for _, r := range requests[:24] {
+						written[writeRequestKey(r)] = true
+					}
+					return &dynamodb.BatchWriteItemOutput{
+						UnprocessedItems: map[string][]*dynamodb.WriteRequest{
+							"testing": requests[24:],
+						},
+					}, nil
+				}
+				for _, r := range requests {
+					written[writeRequestKey(r)] = true
+				}
+				return &dynamodb.BatchWriteItemOutput{}, nil
+			},
+		}
+
+		for _, concurrency := range []int{0, 3} {
+			calls = 0
+			written = make(map[string]bool)
+			s.batchConcurrency = concurrency
+
+			assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
+				BucketName: "testing",
+				Keys:       keys,
+				Values:     values,
+			}))
+			assert.Equal(t, 5, calls) // three chunks plus two retries
+			assert.Equal(t, len(keys), len(written))
+		}
+	})
+
+	t.Run("sad path, a failed chunk is reported with its keys", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec, batchConcurrency: 2}
+		s.c = mockDynamoDB{
+			batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				requests := input.RequestItems["testing"]
+				if writeRequestKey(requests[0]) == "key25" {
+					return nil, awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+				}
+				return &dynamodb.BatchWriteItemOutput{}, nil
+			},
+		}
+
+		err := s.BatchSet(types.BatchSetItemInput{
+			BucketName: "testing",
+			Keys:       keys,
+			Values:     values,
+		})
+
+		var pfe *PartialFailureError
+		assert.True(t, errors.As(err, &pfe))
+		assert.True(t, errors.Is(err, gokv.ErrThrottled))
+		assert.Equal(t, 25, len(pfe.Keys))
+		assert.Contains(t, pfe.Keys, "key25")
+		assert.Contains(t, pfe.Keys, "key49")
+		assert.NotContains(t, pfe.Keys, "key50")
+	})
+
+	t.Run("sad path, mismatched keys and values", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec, c: mockDynamoDB{}}
+		assert.Equal(t, util.ErrLengthMismatch, s.BatchSet(types.BatchSetItemInput{
+			BucketName: "testing",
+			Keys:       keys,
+			Values:     values[:1],
+		}))
+	})
+}
+
+func TestStore_BatchGet(t *testing.T) {
+	s, err := NewStore(Options{
+		Region:         "ca-test-1",
+		TableName:      "gokvtesttable",
+		CustomEndpoint: "https://foo.bar/test",
+	})
+	assert.NoError(t, err)
+
+	t.Run("happy path, unprocessed keys are retried", func(t *testing.T) {
+		calls := 0
+		s.c = mockDynamoDB{
+			batchGetItem: func(input *dynamodb.BatchGetItemInput) (output *dynamodb.BatchGetItemOutput, e error) {
+				calls++
+				keys := input.RequestItems["gokv_testing"].Keys
+				switch calls {
+				case 1:
+					assert.Equal(t, 3, len(keys)) // duplicate keys are only requested once
+					return &dynamodb.BatchGetItemOutput{
+						Responses: map[string][]map[string]*dynamodb.AttributeValue{
+							"gokv_testing": {{KeyAttrName: {S: aws.String("foo")}, ValAttrName: {B: []byte(`"bar"`)}}},
+						},
+						UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{
+							"gokv_testing": {Keys: keys[1:]},
+						},
+					}, nil
+				default:
+					assert.Equal(t, 2, len(keys))
+					return &dynamodb.BatchGetItemOutput{
+						Responses: map[string][]map[string]*dynamodb.AttributeValue{
+							"gokv_testing": {{KeyAttrName: {S: aws.String("faz")}, ValAttrName: {B: []byte(`"baz"`)}}},
+						},
+					}, nil
+				}
+			},
+		}
+
+		var values []string
+		out, err := s.BatchGet(types.BatchGetItemInput{
+			BucketName: "testing",
+			Keys:       []string{"foo", "faz", "missing", "foo"},
+			Values:     &values,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, []bool{true, true, false, true}, out.Found)
+		assert.Equal(t, []string{"bar", "baz", "", "bar"}, values)
+	})
+
+	t.Run("happy path, keys are chunked", func(t *testing.T) {
+		calls := 0
+		s.c = mockDynamoDB{
+			batchGetItem: func(input *dynamodb.BatchGetItemInput) (output *dynamodb.BatchGetItemOutput, e error) {
+				calls++
+				assert.True(t, len(input.RequestItems["gokv_testing"].Keys) <= batchGetLimit)
+				return &dynamodb.BatchGetItemOutput{}, nil
+			},
+		}
+
+		var keys []string
+		for i := 0; i < 250; i++ {
+			keys = append(keys, strconv.Itoa(i))
+		}
+		values := map[string]string{}
+		out, err := s.BatchGet(types.BatchGetItemInput{BucketName: "testing", Keys: keys, Values: values})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, 250, len(out.Found))
+	})
+}
+
+func TestStore_BatchDelete(t *testing.T) {
+	s, err := NewStore(Options{
+		Region:         "ca-test-1",
+		TableName:      "gokvtesttable",
+		CustomEndpoint: "https://foo.bar/test",
+	})
+	assert.NoError(t, err)
+
+	var keys []string
+	for i := 0; i < 30; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+
+	var deleted []string
+	writeCalls := 0
+	s.c = mockDynamoDB{
+		batchGetItem: func(input *dynamodb.BatchGetItemInput) (output *dynamodb.BatchGetItemOutput, e error) {
+			assert.Equal(t, "#k, #ttl", *input.RequestItems["gokv_testing"].ProjectionExpression)
+
+			// every key but "0" exists
+			var items []map[string]*dynamodb.AttributeValue
+			for _, key := range input.RequestItems["gokv_testing"].Keys {
+				if *key[KeyAttrName].S != "0" {
+					items = append(items, key)
+				}
+			}
+			return &dynamodb.BatchGetItemOutput{
+				Responses: map[string][]map[string]*dynamodb.AttributeValue{"gokv_testing": items},
+			}, nil
+		},
+		batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (output *dynamodb.BatchWriteItemOutput, e error) {
+			writeCalls++
+			requests := input.RequestItems["gokv_testing"]
+			assert.True(t, len(requests) <= batchWriteLimit)
+
+			// leave the last request of the first call unprocessed
+			output = &dynamodb.BatchWriteItemOutput{}
+			if writeCalls == 1 {
+				output.UnprocessedItems = map[string][]*dynamodb.WriteRequest{"gokv_testing": requests[len(requests)-1:]}
+				requests = requests[:len(requests)-1]
+			}
+			for _, r := range requests {
+				deleted = append(deleted, *r.DeleteRequest.Key[KeyAttrName].S)
+			}
+			return output, nil
+		},
+	}
+
+	out, err := s.BatchDelete(types.BatchDeleteItemInput{BucketName: "testing", Keys: keys})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0"}, out.Missing)
+	assert.Equal(t, 3, writeCalls)
+	assert.ElementsMatch(t, keys, deleted)
+}
+
 func TestStore_Scan(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		s, err := NewStore(Options{
@@ -236,18 +693,18 @@ func TestStore_Scan(t *testing.T) {
 					Items: []map[string]*dynamodb.AttributeValue{
 						{
 							KeyAttrName: &dynamodb.AttributeValue{
-								SS: []*string{aws.String("key1")},
+								S: aws.String("key1"),
 							},
 							ValAttrName: &dynamodb.AttributeValue{
-								BS: [][]byte{[]byte("val1")},
+								B: []byte("val1"),
 							},
 						},
 						{
 							KeyAttrName: &dynamodb.AttributeValue{
-								SS: []*string{aws.String("key2")},
+								S: aws.String("key2"),
 							},
 							ValAttrName: &dynamodb.AttributeValue{
-								BS: [][]byte{[]byte("val2")},
+								B: []byte("val2"),
 							},
 						},
 					},
@@ -263,6 +720,89 @@ func TestStore_Scan(t *testing.T) {
 		}, output)
 	})
 
+	t.Run("happy path, paginated", func(t *testing.T) {
+		s, err := NewStore(Options{
+			Region:         "ca-test-1",
+			TableName:      "gokvtesttable",
+			CustomEndpoint: "https://foo.bar/test",
+		})
+		assert.NoError(t, err)
+
+		items := []map[string]*dynamodb.AttributeValue{
+			{KeyAttrName: {S: aws.String("key1")}, ValAttrName: {B: []byte("val1")}},
+			{KeyAttrName: {S: aws.String("key2")}, ValAttrName: {B: []byte("val2")}},
+			{KeyAttrName: {S: aws.String("key3")}, ValAttrName: {B: []byte("val3")}},
+		}
+		// serve one item per call, as if every item filled a 1 MB page
+		s.c = mockDynamoDB{
+			scan: func(input *dynamodb.ScanInput) (output *dynamodb.ScanOutput, e error) {
+				i := 0
+				if input.ExclusiveStartKey != nil {
+					for j, item := range items {
+						if *item[KeyAttrName].S == *input.ExclusiveStartKey[KeyAttrName].S {
+							i = j + 1
+						}
+					}
+				}
+				output = &dynamodb.ScanOutput{Items: items[i : i+1]}
+				if i < len(items)-1 {
+					output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{KeyAttrName: items[i][KeyAttrName]}
+				}
+				return output, nil
+			},
+		}
+
+		// all pages are followed without a limit
+		output, err := s.Scan(types.ScanInput{BucketName: "scanbucket"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"key1", "key2", "key3"}, output.Keys)
+		assert.Empty(t, output.NextToken)
+
+		// one page at a time with a limit
+		var keys []string
+		input := types.ScanInput{BucketName: "scanbucket", Limit: 1}
+		for {
+			output, err := s.Scan(input)
+			assert.NoError(t, err)
+			keys = append(keys, output.Keys...)
+			if output.NextToken == "" {
+				break
+			}
+			input.StartToken = output.NextToken
+		}
+		assert.Equal(t, []string{"key1", "key2", "key3"}, keys)
+
+		_, err = s.Scan(types.ScanInput{BucketName: "scanbucket", StartToken: "!!"})
+		assert.Equal(t, util.ErrInvalidToken, err)
+	})
+
+	t.Run("happy path, prefix and range", func(t *testing.T) {
+		s, err := NewStore(Options{
+			Region:         "ca-test-1",
+			TableName:      "gokvtesttable",
+			CustomEndpoint: "https://foo.bar/test",
+		})
+		assert.NoError(t, err)
+		s.c = mockDynamoDB{
+			scan: func(input *dynamodb.ScanInput) (output *dynamodb.ScanOutput, e error) {
+				assert.Equal(t, "(attribute_not_exists(#ttl) OR #ttl > :now) AND begins_with(#k, :prefix) AND #k >= :start AND #k < :end", *input.FilterExpression)
+				assert.Equal(t, KeyAttrName, *input.ExpressionAttributeNames["#k"])
+				assert.Equal(t, "tenant/1/", *input.ExpressionAttributeValues[":prefix"].S)
+				assert.Equal(t, "tenant/1/a", *input.ExpressionAttributeValues[":start"].S)
+				assert.Equal(t, "tenant/1/c", *input.ExpressionAttributeValues[":end"].S)
+				return &dynamodb.ScanOutput{}, nil
+			},
+		}
+
+		_, err = s.Scan(types.ScanInput{
+			BucketName: "scanbucket",
+			Prefix:     "tenant/1/",
+			StartKey:   "tenant/1/a",
+			EndKey:     "tenant/1/c",
+		})
+		assert.NoError(t, err)
+	})
+
 	t.Run("sad path: missing bucket name", func(t *testing.T) {
 		so, err := Store{}.Scan(types.ScanInput{})
 		assert.Equal(t, util.ErrEmptyBucketName, err)
@@ -287,3 +827,782 @@ func TestStore_Scan(t *testing.T) {
 		assert.Empty(t, so)
 	})
 }
+
+func TestStore_DeleteBucket(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{
+			deleteTable: func(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+				assert.Equal(t, "testing", *input.TableName)
+				return &dynamodb.DeleteTableOutput{}, nil
+			},
+		}}
+		assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "testing"}))
+	})
+
+	t.Run("sad path, table not found", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{
+			deleteTable: func(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+				return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no such table", nil)
+			},
+		}}
+		assert.True(t, errors.Is(s.DeleteBucket(types.DeleteBucketInput{BucketName: "testing"}), gokv.ErrBucketNotFound))
+	})
+
+	t.Run("sad path, empty bucket name", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{}}
+		assert.Equal(t, util.ErrEmptyBucketName, s.DeleteBucket(types.DeleteBucketInput{}))
+	})
+}
+
+func TestStore_TableProvisioning(t *testing.T) {
+	notFound := func(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no such table", nil)
+	}
+
+	t.Run("happy path, missing table is created once", func(t *testing.T) {
+		var calls []string
+		var created *dynamodb.CreateTableInput
+		s := Store{
+			codec: DefaultOptions.Codec,
+			options: Options{
+				BillingMode:         dynamodb.BillingModePayPerRequest,
+				PointInTimeRecovery: true,
+				EnableTTL:           true,
+				EnableStreams:       true,
+			},
+			tables: &sync.Map{},
+		}
+		s.c = mockDynamoDB{
+			calls:         &calls,
+			describeTable: notFound,
+			createTable: func(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+				created = input
+				return &dynamodb.CreateTableOutput{}, nil
+			},
+		}
+
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+		}
+		assert.Equal(t, []string{"DescribeTable", "CreateTable", "WaitUntilTableExists", "UpdateContinuousBackups", "UpdateTimeToLive"}, calls)
+		assert.Equal(t, "testing", *created.TableName)
+		assert.Equal(t, KeyAttrName, *created.KeySchema[0].AttributeName)
+		assert.Equal(t, dynamodb.KeyTypeHash, *created.KeySchema[0].KeyType)
+		assert.Equal(t, dynamodb.BillingModePayPerRequest, *created.BillingMode)
+		assert.Nil(t, created.ProvisionedThroughput)
+		assert.Equal(t, dynamodb.StreamViewTypeKeysOnly, *created.StreamSpecification.StreamViewType)
+	})
+
+	t.Run("happy path, provisioned throughput", func(t *testing.T) {
+		var created *dynamodb.CreateTableInput
+		s := Store{
+			codec:   DefaultOptions.Codec,
+			options: Options{BillingMode: dynamodb.BillingModeProvisioned, ReadCapacityUnits: 3, WriteCapacityUnits: 4},
+			tables:  &sync.Map{},
+		}
+		s.c = mockDynamoDB{
+			describeTable: notFound,
+			createTable: func(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+				created = input
+				return nil, awserr.New(dynamodb.ErrCodeResourceInUseException, "table being created", nil)
+			},
+		}
+
+		assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "testing", Keys: []string{"foo"}, Values: []string{"bar"}}))
+		assert.Equal(t, int64(3), *created.ProvisionedThroughput.ReadCapacityUnits)
+		assert.Equal(t, int64(4), *created.ProvisionedThroughput.WriteCapacityUnits)
+	})
+
+	t.Run("happy path, existing table", func(t *testing.T) {
+		var calls []string
+		s := Store{codec: DefaultOptions.Codec, tables: &sync.Map{}}
+		s.c = mockDynamoDB{calls: &calls}
+
+		assert.NoError(t, s.SetIfNotExists(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+		assert.Equal(t, []string{"DescribeTable"}, calls)
+	})
+
+	t.Run("happy path, table creation disabled", func(t *testing.T) {
+		var calls []string
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{calls: &calls}
+
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+		assert.Empty(t, calls)
+	})
+
+	t.Run("happy path, deleted bucket is looked up again", func(t *testing.T) {
+		var calls []string
+		s := Store{codec: DefaultOptions.Codec, tables: &sync.Map{}}
+		s.c = mockDynamoDB{calls: &calls}
+
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+		assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "testing"}))
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+		assert.Equal(t, []string{"DescribeTable", "WaitUntilTableNotExists", "DescribeTable"}, calls)
+	})
+
+	t.Run("sad path, describe fails", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec, tables: &sync.Map{}}
+		s.c = mockDynamoDB{
+			describeTable: func(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+				return nil, awserr.New(dynamodb.ErrCodeInternalServerError, "oops", nil)
+			},
+		}
+
+		err := s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"})
+		assert.True(t, errors.Is(err, gokv.ErrUnavailable))
+	})
+}
+
+func TestStore_SingleTable(t *testing.T) {
+	newSingleTableStore := func(md mockDynamoDB) Store {
+		return Store{
+			c:         md,
+			tableName: "gokvtesttable",
+			codec:     DefaultOptions.Codec,
+			options:   Options{SingleTable: true},
+		}
+	}
+	itemKey := func(bucket, key string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{
+			BucketAttrName: {S: aws.String(bucket)},
+			KeyAttrName:    {S: aws.String(key)},
+		}
+	}
+
+	t.Run("happy path, set and get address the bucket partition", func(t *testing.T) {
+		s := newSingleTableStore(mockDynamoDB{
+			putItem: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				assert.Equal(t, "gokvtesttable", *input.TableName)
+				assert.Equal(t, map[string]*dynamodb.AttributeValue{
+					BucketAttrName: {S: aws.String("testing")},
+					KeyAttrName:    {S: aws.String("foo")},
+					ValAttrName:    {B: []byte(`"bar"`)},
+				}, input.Item)
+				return &dynamodb.PutItemOutput{}, nil
+			},
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				assert.Equal(t, "gokvtesttable", *input.TableName)
+				assert.Equal(t, itemKey("testing", "foo"), input.Key)
+				return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+					ValAttrName: {B: []byte(`"bar"`)},
+				}}, nil
+			},
+		})
+
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+
+		var v string
+		found, err := s.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "bar", v)
+	})
+
+	t.Run("happy path, scan queries the bucket", func(t *testing.T) {
+		s := newSingleTableStore(mockDynamoDB{
+			query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				assert.Equal(t, "gokvtesttable", *input.TableName)
+				assert.Equal(t, "#b = :b AND begins_with(#k, :prefix)", *input.KeyConditionExpression)
+				assert.Equal(t, "testing", *input.ExpressionAttributeValues[":b"].S)
+				assert.Equal(t, "a", *input.ExpressionAttributeValues[":prefix"].S)
+
+				var items []map[string]*dynamodb.AttributeValue
+				for _, k := range []string{"a1", "a2", "a3"} {
+					item := itemKey("testing", k)
+					item[ValAttrName] = &dynamodb.AttributeValue{B: []byte(`"val"`)}
+					items = append(items, item)
+				}
+				return &dynamodb.QueryOutput{Items: items}, nil
+			},
+		})
+
+		// the end key cannot be part of the key condition and is applied to the results
+		out, err := s.Scan(types.ScanInput{BucketName: "testing", Prefix: "a", EndKey: "a3"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a1", "a2"}, out.Keys)
+	})
+
+	t.Run("happy path, delete bucket pages through the partition", func(t *testing.T) {
+		var deleted []string
+		queries := 0
+		s := newSingleTableStore(mockDynamoDB{
+			query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				queries++
+				assert.Equal(t, "#b = :b", *input.KeyConditionExpression)
+				if queries == 1 {
+					assert.Nil(t, input.ExclusiveStartKey)
+					return &dynamodb.QueryOutput{
+						Items:            []map[string]*dynamodb.AttributeValue{itemKey("testing", "foo")},
+						LastEvaluatedKey: itemKey("testing", "foo"),
+					}, nil
+				}
+				assert.Equal(t, itemKey("testing", "foo"), input.ExclusiveStartKey)
+				return &dynamodb.QueryOutput{
+					Items: []map[string]*dynamodb.AttributeValue{itemKey("testing", "bar")},
+				}, nil
+			},
+			batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				for _, r := range input.RequestItems["gokvtesttable"] {
+					assert.Equal(t, "testing", *r.DeleteRequest.Key[BucketAttrName].S)
+					deleted = append(deleted, writeRequestKey(r))
+				}
+				return &dynamodb.BatchWriteItemOutput{}, nil
+			},
+			deleteTable: func(*dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+				t.Fatal("the shared table must not be deleted")
+				return nil, nil
+			},
+		})
+
+		assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "testing"}))
+		assert.Equal(t, 2, queries)
+		assert.Equal(t, []string{"foo", "bar"}, deleted)
+	})
+
+	t.Run("sad path, delete empty bucket", func(t *testing.T) {
+		s := newSingleTableStore(mockDynamoDB{})
+		assert.Equal(t, gokv.ErrBucketNotFound, s.DeleteBucket(types.DeleteBucketInput{BucketName: "testing"}))
+	})
+
+	t.Run("happy path, shared table is created with a composite key", func(t *testing.T) {
+		var created *dynamodb.CreateTableInput
+		s := newSingleTableStore(mockDynamoDB{
+			describeTable: func(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+				assert.Equal(t, "gokvtesttable", *input.TableName)
+				return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no such table", nil)
+			},
+			createTable: func(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+				created = input
+				return &dynamodb.CreateTableOutput{}, nil
+			},
+		})
+		s.options.BillingMode = dynamodb.BillingModePayPerRequest
+		s.tables = &sync.Map{}
+
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "foo", Value: "bar"}))
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "foo", Value: "bar"}))
+		assert.Equal(t, "gokvtesttable", *created.TableName)
+		assert.Equal(t, []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(BucketAttrName), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String(KeyAttrName), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		}, created.KeySchema)
+	})
+}
+
+func TestStore_Info(t *testing.T) {
+	tables := map[string]*dynamodb.TableDescription{
+		"gokv_foo": {
+			ItemCount:      aws.Int64(10),
+			TableSizeBytes: aws.Int64(1000),
+			ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{
+				ReadCapacityUnits:  aws.Int64(5),
+				WriteCapacityUnits: aws.Int64(3),
+			},
+		},
+		"gokv_bar": {
+			ItemCount:      aws.Int64(2),
+			TableSizeBytes: aws.Int64(200),
+		},
+		"other": {
+			ItemCount:      aws.Int64(7),
+			TableSizeBytes: aws.Int64(700),
+		},
+	}
+	md := mockDynamoDB{
+		describeTable: func(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+			table, ok := tables[*input.TableName]
+			if !ok {
+				return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no such table", nil)
+			}
+			return &dynamodb.DescribeTableOutput{Table: table}, nil
+		},
+		listTables: func(input *dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
+			if input.ExclusiveStartTableName == nil {
+				return &dynamodb.ListTablesOutput{
+					TableNames:             aws.StringSlice([]string{"gokv_", "gokv_foo"}),
+					LastEvaluatedTableName: aws.String("gokv_foo"),
+				}, nil
+			}
+			// tables of other applications are not buckets of the store
+			return &dynamodb.ListTablesOutput{TableNames: aws.StringSlice([]string{"gokv_bar", "other"})}, nil
+		},
+	}
+
+	t.Run("happy path, table per bucket", func(t *testing.T) {
+		s := Store{c: md, tableName: "gokvtesttable", options: Options{TablePrefix: "gokv_"}}
+
+		info, err := s.Info()
+		assert.NoError(t, err)
+		assert.Equal(t, types.StoreInfo{
+			Name:               "gokvtesttable",
+			Size:               1200,
+			Items:              12,
+			UsedBytes:          1200,
+			ReadCapacityUnits:  5,
+			WriteCapacityUnits: 3,
+			Buckets: []types.BucketInfo{
+				{Name: "foo", Items: 10, Size: 1000},
+				{Name: "bar", Items: 2, Size: 200},
+			},
+		}, info)
+	})
+
+	t.Run("happy path, single table", func(t *testing.T) {
+		s := Store{c: md, tableName: "gokv_foo", options: Options{SingleTable: true}}
+
+		info, err := s.Info()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), info.Items)
+		assert.Equal(t, int64(1000), info.Size)
+		assert.Empty(t, info.Buckets)
+	})
+
+	t.Run("sad path, table not found", func(t *testing.T) {
+		s := Store{c: md, tableName: "missing", options: Options{SingleTable: true}}
+
+		_, err := s.Info()
+		assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+	})
+}
+
+func TestStore_ListBuckets(t *testing.T) {
+	t.Run("happy path, table per bucket", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{
+			listTables: func(*dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
+				return &dynamodb.ListTablesOutput{TableNames: aws.StringSlice([]string{"app_foo", "foo", "app_bar"})}, nil
+			},
+			describeTable: func(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+				assert.True(t, strings.HasPrefix(*input.TableName, "app_"))
+				return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+					ItemCount:      aws.Int64(int64(len(*input.TableName))),
+					TableSizeBytes: aws.Int64(100),
+				}}, nil
+			},
+		}, options: Options{TablePrefix: "app_"}}
+
+		buckets, err := s.ListBuckets()
+		assert.NoError(t, err)
+		assert.Equal(t, []types.BucketInfo{
+			{Name: "foo", Items: 7, Size: 100},
+			{Name: "bar", Items: 7, Size: 100},
+		}, buckets)
+	})
+
+	t.Run("happy path, single table", func(t *testing.T) {
+		scans := 0
+		s := Store{tableName: "gokvtesttable", options: Options{SingleTable: true}}
+		s.c = mockDynamoDB{
+			scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				scans++
+				assert.Equal(t, "#b", *input.ProjectionExpression)
+				bucket := func(name string) map[string]*dynamodb.AttributeValue {
+					return map[string]*dynamodb.AttributeValue{BucketAttrName: {S: aws.String(name)}}
+				}
+				if scans == 1 {
+					return &dynamodb.ScanOutput{
+						Items:            []map[string]*dynamodb.AttributeValue{bucket("foo"), bucket("bar")},
+						LastEvaluatedKey: bucket("bar"),
+					}, nil
+				}
+				return &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{bucket("foo")}}, nil
+			},
+		}
+
+		buckets, err := s.ListBuckets()
+		assert.NoError(t, err)
+		assert.Equal(t, []types.BucketInfo{
+			{Name: "bar", Items: 1},
+			{Name: "foo", Items: 2},
+		}, buckets)
+	})
+}
+
+func TestStore_BucketInfo(t *testing.T) {
+	t.Run("happy path, single table counts the partition", func(t *testing.T) {
+		s := Store{tableName: "gokvtesttable", options: Options{SingleTable: true}}
+		s.c = mockDynamoDB{
+			query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				assert.Equal(t, dynamodb.SelectCount, *input.Select)
+				if input.ExclusiveStartKey == nil {
+					return &dynamodb.QueryOutput{
+						Count:            aws.Int64(3),
+						LastEvaluatedKey: map[string]*dynamodb.AttributeValue{KeyAttrName: {S: aws.String("c")}},
+					}, nil
+				}
+				return &dynamodb.QueryOutput{Count: aws.Int64(2)}, nil
+			},
+		}
+
+		info, err := s.BucketInfo(types.BucketInfoInput{BucketName: "testing"})
+		assert.NoError(t, err)
+		assert.Equal(t, types.BucketInfo{Name: "testing", Items: 5}, info)
+	})
+
+	t.Run("sad path, empty partition", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{}, tableName: "gokvtesttable", options: Options{SingleTable: true}}
+
+		_, err := s.BucketInfo(types.BucketInfoInput{BucketName: "testing"})
+		assert.Equal(t, gokv.ErrBucketNotFound, err)
+	})
+
+	t.Run("sad path, table not found", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{
+			describeTable: func(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+				return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no such table", nil)
+			},
+		}}
+
+		_, err := s.BucketInfo(types.BucketInfoInput{BucketName: "testing"})
+		assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+	})
+}
+
+func TestStore_Exists(t *testing.T) {
+	items := map[string]map[string]*dynamodb.AttributeValue{
+		"foo":     {KeyAttrName: {S: aws.String("foo")}},
+		"expired": {KeyAttrName: {S: aws.String("expired")}, TTLAttrName: {N: aws.String("1")}},
+	}
+	s := Store{c: mockDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			assert.Equal(t, "#k, #ttl", *input.ProjectionExpression)
+			return &dynamodb.GetItemOutput{Item: items[*input.Key[KeyAttrName].S]}, nil
+		},
+	}}
+
+	for key, expected := range map[string]bool{"foo": true, "expired": false, "missing": false} {
+		exists, err := s.Exists(types.ExistsInput{BucketName: "testing", Key: key})
+		assert.NoError(t, err, key)
+		assert.Equal(t, expected, exists, key)
+	}
+}
+
+func TestStore_Count(t *testing.T) {
+	page := func(count int64, last bool) (*int64, map[string]*dynamodb.AttributeValue) {
+		if last {
+			return aws.Int64(count), nil
+		}
+		return aws.Int64(count), map[string]*dynamodb.AttributeValue{KeyAttrName: {S: aws.String("k")}}
+	}
+
+	t.Run("happy path, table per bucket", func(t *testing.T) {
+		s := Store{c: mockDynamoDB{
+			scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				assert.Equal(t, "testing", *input.TableName)
+				assert.Equal(t, dynamodb.SelectCount, *input.Select)
+				count, lastKey := page(3, input.ExclusiveStartKey != nil)
+				return &dynamodb.ScanOutput{Count: count, LastEvaluatedKey: lastKey}, nil
+			},
+		}}
+
+		n, err := s.Count(types.CountInput{BucketName: "testing"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), n)
+	})
+
+	t.Run("happy path, single table", func(t *testing.T) {
+		s := Store{tableName: "gokvtesttable", options: Options{SingleTable: true}}
+		s.c = mockDynamoDB{
+			query: func(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				assert.Equal(t, "gokvtesttable", *input.TableName)
+				assert.Equal(t, "testing", *input.ExpressionAttributeValues[":b"].S)
+				assert.Equal(t, dynamodb.SelectCount, *input.Select)
+				count, lastKey := page(2, input.ExclusiveStartKey != nil)
+				return &dynamodb.QueryOutput{Count: count, LastEvaluatedKey: lastKey}, nil
+			},
+		}
+
+		n, err := s.Count(types.CountInput{BucketName: "testing"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), n)
+	})
+}
+
+func TestStore_Increment(t *testing.T) {
+	conditionFailed := awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+
+	t.Run("happy path", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				assert.True(t, *input.ConsistentRead)
+				return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+					KeyAttrName: {S: aws.String("foo")},
+					ValAttrName: {B: []byte("10")},
+				}}, nil
+			},
+			updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				assert.Equal(t, "testing", *input.TableName)
+				assert.Equal(t, "foo", *input.Key[KeyAttrName].S)
+				assert.Equal(t, "SET #v = :n", *input.UpdateExpression)
+				assert.Equal(t, valueMatchesCondition, *input.ConditionExpression)
+				assert.Equal(t, []byte("10"), input.ExpressionAttributeValues[":v"].B)
+				assert.Equal(t, []byte("7"), input.ExpressionAttributeValues[":n"].B)
+				return &dynamodb.UpdateItemOutput{}, nil
+			},
+		}
+
+		n, err := s.Decrement(types.IncrementInput{BucketName: "testing", Key: "foo", Delta: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), n)
+	})
+
+	t.Run("happy path, value written by Set", func(t *testing.T) {
+		var item map[string]*dynamodb.AttributeValue
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			putItem: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				item = input.Item
+				return &dynamodb.PutItemOutput{}, nil
+			},
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: item}, nil
+			},
+			updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				if string(item[ValAttrName].B) != string(input.ExpressionAttributeValues[":v"].B) {
+					return nil, conditionFailed
+				}
+				item[ValAttrName] = input.ExpressionAttributeValues[":n"]
+				return &dynamodb.UpdateItemOutput{}, nil
+			},
+		}
+
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: 5, TTL: time.Hour}))
+		n, err := s.Increment(types.IncrementInput{BucketName: "testing", Key: "foo", Delta: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(6), n)
+		assert.NotNil(t, item[TTLAttrName])
+
+		var v int64
+		found, err := s.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(6), v)
+
+		// CompareAndSwap and DeleteIf compare the binary value they encode
+		data, err := s.codec.Marshal(6)
+		assert.NoError(t, err)
+		assert.Equal(t, data, item[ValAttrName].B)
+	})
+
+	t.Run("concurrent write starts over", func(t *testing.T) {
+		reads := 0
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				reads++
+				return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+					ValAttrName: {B: []byte(strconv.Itoa(reads))},
+				}}, nil
+			},
+			updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				if reads == 1 {
+					return nil, conditionFailed
+				}
+				return &dynamodb.UpdateItemOutput{}, nil
+			},
+		}
+
+		n, err := s.Increment(types.IncrementInput{BucketName: "testing", Key: "foo", Delta: 5})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, reads)
+		assert.Equal(t, int64(7), n)
+	})
+
+	t.Run("expired counter starts over", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+					ValAttrName: {B: []byte("not a counter")},
+					TTLAttrName: {N: aws.String("1")},
+				}}, nil
+			},
+			putItem: func(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				assert.Equal(t, "attribute_not_exists(#v) OR #ttl <= :now", *input.ConditionExpression)
+				assert.Equal(t, []byte("5"), input.Item[ValAttrName].B)
+				assert.Nil(t, input.Item[TTLAttrName])
+				return &dynamodb.PutItemOutput{}, nil
+			},
+		}
+
+		n, err := s.Increment(types.IncrementInput{BucketName: "testing", Key: "foo", Delta: 5})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), n)
+	})
+
+	t.Run("sad path, not a counter", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+					ValAttrName: {B: []byte(`"val"`)},
+				}}, nil
+			},
+		}
+
+		_, err := s.Increment(types.IncrementInput{BucketName: "testing", Key: "foo", Delta: 1})
+		assert.Equal(t, util.ErrNotCounter, err)
+	})
+
+	t.Run("sad path, overflow is not written", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+					ValAttrName: {B: []byte("9223372036854775807")},
+				}}, nil
+			},
+			updateItem: func(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				t.Error("overflowing counter was written")
+				return &dynamodb.UpdateItemOutput{}, nil
+			},
+		}
+
+		_, err := s.Increment(types.IncrementInput{BucketName: "testing", Key: "foo", Delta: 1})
+		assert.Equal(t, util.ErrCounterOverflow, err)
+	})
+
+	t.Run("sad path, empty key", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec, c: mockDynamoDB{}}
+		_, err := s.Increment(types.IncrementInput{BucketName: "testing", Delta: 1})
+		assert.Equal(t, util.ErrEmptyKey, err)
+	})
+}
+
+func TestStore_Txn(t *testing.T) {
+	move := types.TxnInput{Ops: []types.TxnOp{
+		{Type: types.TxnCheck, BucketName: "testing", Key: "unguarded"},
+		{Type: types.TxnDelete, BucketName: "testing", Key: "foo", Condition: types.TxnMatches, Match: "bar"},
+		{Type: types.TxnSet, BucketName: "other", Key: "foo", Value: "bar", Condition: types.TxnNotExists},
+		{Type: types.TxnCheck, BucketName: "testing", Key: "index", Condition: types.TxnExists},
+	}}
+
+	t.Run("happy path", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			transactWrite: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+				// the unconditional check is not sent
+				assert.Len(t, input.TransactItems, 3)
+
+				del := input.TransactItems[0].Delete
+				assert.Equal(t, "testing", *del.TableName)
+				assert.Equal(t, valueMatchesCondition, *del.ConditionExpression)
+				assert.Equal(t, []byte(`"bar"`), del.ExpressionAttributeValues[":v"].B)
+
+				put := input.TransactItems[1].Put
+				assert.Equal(t, "other", *put.TableName)
+				assert.Equal(t, "attribute_not_exists(#k) OR #ttl <= :now", *put.ConditionExpression)
+				assert.Equal(t, []byte(`"bar"`), put.Item[ValAttrName].B)
+
+				check := input.TransactItems[2].ConditionCheck
+				assert.Equal(t, "index", *check.Key[KeyAttrName].S)
+				assert.Equal(t, "attribute_exists(#k) AND (attribute_not_exists(#ttl) OR #ttl > :now)", *check.ConditionExpression)
+				return &dynamodb.TransactWriteItemsOutput{}, nil
+			},
+		}
+		assert.NoError(t, s.Txn(move))
+	})
+
+	t.Run("sad path, condition failed", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			transactWrite: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+				return nil, awserr.New(dynamodb.ErrCodeTransactionCanceledException,
+					"Transaction cancelled, please refer cancellation reasons for specific reasons [None, None, ConditionalCheckFailed]", nil)
+			},
+		}
+
+		err := s.Txn(move)
+		assert.True(t, errors.Is(err, gokv.ErrConflict))
+		assert.Equal(t, &gokv.TxnConflictError{Index: 3, BucketName: "testing", Key: "index"}, err)
+	})
+
+	t.Run("sad path, concurrent transaction", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec}
+		s.c = mockDynamoDB{
+			transactWrite: func(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+				return nil, awserr.New(dynamodb.ErrCodeTransactionConflictException, "Transaction is ongoing for the item", nil)
+			},
+		}
+
+		assert.Equal(t, &gokv.TxnConflictError{Index: -1}, s.Txn(move))
+	})
+
+	t.Run("sad path, too many ops", func(t *testing.T) {
+		s := Store{codec: DefaultOptions.Codec, c: mockDynamoDB{}}
+		var input types.TxnInput
+		for i := 0; i < 101; i++ {
+			input.Ops = append(input.Ops, types.TxnOp{Type: types.TxnDelete, BucketName: "testing", Key: "key" + strconv.Itoa(i)})
+		}
+
+		err := s.Txn(input)
+		assert.True(t, errors.Is(err, ErrTooManyTxnOps))
+		assert.True(t, errors.Is(err, gokv.ErrTooLarge))
+	})
+}
+
+func TestStore_View(t *testing.T) {
+	s := Store{codec: DefaultOptions.Codec}
+	s.c = mockDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			assert.True(t, *input.ConsistentRead)
+			return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+				KeyAttrName: {S: aws.String("foo")},
+				ValAttrName: {B: []byte(`"bar"`)},
+			}}, nil
+		},
+		transactGet: func(input *dynamodb.TransactGetItemsInput) (*dynamodb.TransactGetItemsOutput, error) {
+			assert.Len(t, input.TransactItems, 2)
+			assert.Equal(t, "testing", *input.TransactItems[0].Get.TableName)
+			return &dynamodb.TransactGetItemsOutput{Responses: []*dynamodb.ItemResponse{
+				{Item: map[string]*dynamodb.AttributeValue{
+					KeyAttrName: {S: aws.String("foo")},
+					ValAttrName: {B: []byte(`"bar"`)},
+				}},
+				{},
+			}}, nil
+		},
+		scan: func(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			assert.True(t, *input.ConsistentRead)
+			return &dynamodb.ScanOutput{}, nil
+		},
+	}
+
+	err := s.View(func(tx gokv.ReadTx) error {
+		var v string
+		found, err := tx.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		var values []string
+		out, err := tx.BatchGet(types.BatchGetItemInput{BucketName: "testing", Keys: []string{"foo", "missing"}, Values: &values})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, false}, out.Found)
+		assert.Equal(t, []string{"bar", ""}, values)
+
+		keys := make([]string, 101)
+		for i := range keys {
+			keys[i] = "key" + strconv.Itoa(i)
+		}
+		_, err = tx.BatchGet(types.BatchGetItemInput{BucketName: "testing", Keys: keys, Values: &values})
+		assert.True(t, errors.Is(err, ErrTooManyTxnOps))
+
+		_, err = tx.Scan(types.ScanInput{BucketName: "testing"})
+		assert.NoError(t, err)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// reads outside of a view are eventually consistent
+	s.c = mockDynamoDB{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			assert.Nil(t, input.ConsistentRead)
+			return &dynamodb.GetItemOutput{}, nil
+		},
+	}
+	var v string
+	_, err = s.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &v})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,252 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+)
+
+// ErrStreamDisabled is returned by Watch for tables without a stream.
+var ErrStreamDisabled = errors.New("table has no stream enabled")
+
+// ttlPrincipal is the identity DynamoDB attributes deletions by TTL to.
+const ttlPrincipal = "dynamodb.amazonaws.com"
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext polls the stream of the table of the bucket, which
+// EnableStreams turns on for created tables, every StreamPollInterval.
+// It starts from the latest record of each shard, so StartToken is not
+// supported. Dropping a table closes its stream, so deleting a bucket
+// of its own table ends the watch without delete events.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return nil, nil, err
+	}
+
+	if input.StartToken != "" {
+		return nil, nil, gokv.ErrNotSupported
+	}
+
+	out, err := s.c.DescribeTableWithContext(ctx, &awsdynamodb.DescribeTableInput{
+		TableName: aws.String(s.table(input.BucketName)),
+	})
+	if err != nil {
+		return nil, nil, wrapErr(err)
+	}
+	if out.Table.LatestStreamArn == nil {
+		return nil, nil, ErrStreamDisabled
+	}
+
+	sw := &streamWatcher{
+		s:         s,
+		input:     input,
+		streamArn: out.Table.LatestStreamArn,
+		iterators: make(map[string]*string),
+		events:    make(chan types.Event),
+		done:      make(chan struct{}),
+	}
+	// position the open shards at their latest record before returning,
+	// so that every change made after Watch returns is reported
+	if err := sw.discoverShards(ctx, dynamodbstreams.ShardIteratorTypeLatest); err != nil {
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(sw.done)
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-sw.done:
+		}
+	}()
+	go sw.run()
+
+	return sw.events, cancel, nil
+}
+
+// streamWatcher follows the shards of a single stream.
+type streamWatcher struct {
+	s         Store
+	input     types.WatchInput
+	streamArn *string
+	// iterators holds the next iterator of every shard being read.
+	// Closed shards are dropped once read to their end.
+	iterators map[string]*string
+	// known lists every shard seen, including those read to their end.
+	known  map[string]bool
+	events chan types.Event
+	done   chan struct{}
+}
+
+func (sw *streamWatcher) run() {
+	defer close(sw.events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-sw.done
+		cancel()
+	}()
+
+	ticker := time.NewTicker(sw.s.options.StreamPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := sw.poll(ctx); err != nil &&
+			!errors.Is(err, gokv.ErrThrottled) && !errors.Is(err, gokv.ErrUnavailable) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sw.done:
+			return
+		}
+	}
+}
+
+// poll reads the new records of every shard and picks up the shards
+// split off since the last poll, reading those from their start.
+func (sw *streamWatcher) poll(ctx context.Context) error {
+	for shardID, iterator := range sw.iterators {
+		out, err := sw.s.streams.GetRecordsWithContext(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodbstreams.ErrCodeExpiredIteratorException {
+			// the iterator was not used for 15 minutes, continue from now
+			if sw.iterators[shardID], err = sw.shardIterator(ctx, shardID, dynamodbstreams.ShardIteratorTypeLatest); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return wrapErr(err)
+		}
+
+		for _, record := range out.Records {
+			ev, ok := sw.event(record)
+			if !ok {
+				continue
+			}
+			select {
+			case sw.events <- ev:
+			case <-sw.done:
+				return ctx.Err()
+			}
+		}
+
+		if out.NextShardIterator == nil {
+			delete(sw.iterators, shardID)
+		} else {
+			sw.iterators[shardID] = out.NextShardIterator
+		}
+	}
+
+	return sw.discoverShards(ctx, dynamodbstreams.ShardIteratorTypeTrimHorizon)
+}
+
+// discoverShards starts reading the shards not seen before at
+// iteratorType. Closed shards are skipped on the first call, as they
+// hold no changes made after Watch was called.
+func (sw *streamWatcher) discoverShards(ctx context.Context, iteratorType string) error {
+	first := sw.known == nil
+	if first {
+		sw.known = make(map[string]bool)
+	}
+
+	var lastShardID *string
+	for {
+		out, err := sw.s.streams.DescribeStreamWithContext(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             sw.streamArn,
+			ExclusiveStartShardId: lastShardID,
+		})
+		if err != nil {
+			return wrapErr(err)
+		}
+
+		for _, shard := range out.StreamDescription.Shards {
+			shardID := aws.StringValue(shard.ShardId)
+			if sw.known[shardID] {
+				continue
+			}
+			sw.known[shardID] = true
+
+			closed := shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil
+			if first && closed {
+				continue
+			}
+			iterator, err := sw.shardIterator(ctx, shardID, iteratorType)
+			if err != nil {
+				return err
+			}
+			sw.iterators[shardID] = iterator
+		}
+
+		lastShardID = out.StreamDescription.LastEvaluatedShardId
+		if lastShardID == nil {
+			return nil
+		}
+	}
+}
+
+func (sw *streamWatcher) shardIterator(ctx context.Context, shardID, iteratorType string) (*string, error) {
+	out, err := sw.s.streams.GetShardIteratorWithContext(ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         sw.streamArn,
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(iteratorType),
+	})
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return out.ShardIterator, nil
+}
+
+// event maps a stream record onto the event it reports, if it concerns
+// an item of the watched bucket.
+func (sw *streamWatcher) event(record *dynamodbstreams.Record) (types.Event, bool) {
+	if record.Dynamodb == nil {
+		return types.Event{}, false
+	}
+	keys := record.Dynamodb.Keys
+
+	if sw.s.options.SingleTable {
+		if b := keys[BucketAttrName]; b == nil || aws.StringValue(b.S) != sw.input.BucketName {
+			return types.Event{}, false
+		}
+	}
+	k := keys[KeyAttrName]
+	if k == nil || k.S == nil || !strings.HasPrefix(*k.S, sw.input.Prefix) {
+		return types.Event{}, false
+	}
+
+	ev := types.Event{BucketName: sw.input.BucketName, Key: *k.S}
+	switch aws.StringValue(record.EventName) {
+	case dynamodbstreams.OperationTypeInsert, dynamodbstreams.OperationTypeModify:
+		ev.Type = types.EventPut
+	case dynamodbstreams.OperationTypeRemove:
+		ev.Type = types.EventDelete
+		if id := record.UserIdentity; id != nil && aws.StringValue(id.PrincipalId) == ttlPrincipal {
+			ev.Type = types.EventExpire
+		}
+	default:
+		return types.Event{}, false
+	}
+	return ev, true
+}
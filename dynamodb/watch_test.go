@@ -0,0 +1,208 @@
+package dynamodb
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// localStream stands in for DynamoDB Streams, holding the records
+// of every shard in memory. Iterators are "shard/position".
+type localStream struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	mu     sync.Mutex
+	shards []string
+	closed map[string]bool
+	// records holds the records of every shard.
+	records map[string][]*dynamodbstreams.Record
+}
+
+func newLocalStream(shards ...string) *localStream {
+	return &localStream{
+		shards:  shards,
+		closed:  make(map[string]bool),
+		records: make(map[string][]*dynamodbstreams.Record),
+	}
+}
+
+func (ls *localStream) addShard(shardID string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.shards = append(ls.shards, shardID)
+}
+
+func (ls *localStream) put(shardID, eventName, key string, principalID string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	record := &dynamodbstreams.Record{
+		EventName: aws.String(eventName),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			Keys: map[string]*dynamodb.AttributeValue{KeyAttrName: {S: aws.String(key)}},
+		},
+	}
+	if principalID != "" {
+		record.UserIdentity = &dynamodbstreams.Identity{PrincipalId: aws.String(principalID), Type: aws.String("Service")}
+	}
+	ls.records[shardID] = append(ls.records[shardID], record)
+}
+
+func (ls *localStream) DescribeStreamWithContext(_ context.Context, input *dynamodbstreams.DescribeStreamInput, _ ...request.Option) (*dynamodbstreams.DescribeStreamOutput, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var shards []*dynamodbstreams.Shard
+	for _, id := range ls.shards {
+		shard := &dynamodbstreams.Shard{ShardId: aws.String(id), SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{}}
+		if ls.closed[id] {
+			shard.SequenceNumberRange.EndingSequenceNumber = aws.String("1")
+		}
+		shards = append(shards, shard)
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &dynamodbstreams.StreamDescription{Shards: shards}}, nil
+}
+
+func (ls *localStream) GetShardIteratorWithContext(_ context.Context, input *dynamodbstreams.GetShardIteratorInput, _ ...request.Option) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	pos := 0
+	if *input.ShardIteratorType == dynamodbstreams.ShardIteratorTypeLatest {
+		pos = len(ls.records[*input.ShardId])
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(*input.ShardId + "/" + strconv.Itoa(pos))}, nil
+}
+
+func (ls *localStream) GetRecordsWithContext(_ context.Context, input *dynamodbstreams.GetRecordsInput, _ ...request.Option) (*dynamodbstreams.GetRecordsOutput, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	parts := strings.Split(*input.ShardIterator, "/")
+	shardID := parts[0]
+	pos, _ := strconv.Atoi(parts[1])
+
+	records := ls.records[shardID][pos:]
+	out := &dynamodbstreams.GetRecordsOutput{Records: records}
+	if !ls.closed[shardID] {
+		out.NextShardIterator = aws.String(shardID + "/" + strconv.Itoa(pos+len(records)))
+	}
+	return out, nil
+}
+
+func receive(t *testing.T, events <-chan types.Event) types.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return types.Event{}
+}
+
+func TestStore_Watch(t *testing.T) {
+	stream := newLocalStream("shard1", "old")
+	stream.closed["old"] = true
+	stream.put("shard1", dynamodbstreams.OperationTypeInsert, "a0", "")
+
+	s := Store{options: Options{StreamPollInterval: time.Millisecond}, streams: stream}
+	s.c = mockDynamoDB{
+		describeTable: func(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+			assert.Equal(t, "testing", *input.TableName)
+			return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+				LatestStreamArn: aws.String("arn:stream"),
+			}}, nil
+		},
+	}
+
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: "testing", Prefix: "a"})
+	assert.NoError(t, err)
+
+	stream.put("shard1", dynamodbstreams.OperationTypeInsert, "a1", "")
+	stream.put("shard1", dynamodbstreams.OperationTypeModify, "b1", "")
+	stream.put("shard1", dynamodbstreams.OperationTypeModify, "a1", "")
+	stream.put("shard1", dynamodbstreams.OperationTypeRemove, "a1", "")
+	stream.put("shard1", dynamodbstreams.OperationTypeRemove, "a2", ttlPrincipal)
+
+	// a shard split off later is read from its start
+	stream.put("shard2", dynamodbstreams.OperationTypeInsert, "a3", "")
+	stream.addShard("shard2")
+
+	var got []types.Event
+	for i := 0; i < 5; i++ {
+		got = append(got, receive(t, events))
+	}
+	assert.Equal(t, []types.Event{
+		{Type: types.EventPut, BucketName: "testing", Key: "a1"},
+		{Type: types.EventPut, BucketName: "testing", Key: "a1"},
+		{Type: types.EventDelete, BucketName: "testing", Key: "a1"},
+		{Type: types.EventExpire, BucketName: "testing", Key: "a2"},
+		{Type: types.EventPut, BucketName: "testing", Key: "a3"},
+	}, got)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestStore_Watch_SingleTable(t *testing.T) {
+	stream := newLocalStream("shard1")
+	s := Store{tableName: "gokvtesttable", options: Options{SingleTable: true, StreamPollInterval: time.Millisecond}, streams: stream}
+	s.c = mockDynamoDB{
+		describeTable: func(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+			assert.Equal(t, "gokvtesttable", *input.TableName)
+			return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+				LatestStreamArn: aws.String("arn:stream"),
+			}}, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _, err := s.WatchWithContext(ctx, types.WatchInput{BucketName: "testing"})
+	assert.NoError(t, err)
+
+	stream.mu.Lock()
+	for _, bucket := range []string{"other", "testing"} {
+		stream.records["shard1"] = append(stream.records["shard1"], &dynamodbstreams.Record{
+			EventName: aws.String(dynamodbstreams.OperationTypeInsert),
+			Dynamodb: &dynamodbstreams.StreamRecord{Keys: map[string]*dynamodb.AttributeValue{
+				BucketAttrName: {S: aws.String(bucket)},
+				KeyAttrName:    {S: aws.String("foo")},
+			}},
+		})
+	}
+	stream.mu.Unlock()
+
+	assert.Equal(t, types.Event{Type: types.EventPut, BucketName: "testing", Key: "foo"}, receive(t, events))
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestStore_Watch_Errors(t *testing.T) {
+	s := Store{options: Options{StreamPollInterval: time.Millisecond}, streams: newLocalStream()}
+	s.c = mockDynamoDB{}
+
+	_, _, err := s.Watch(types.WatchInput{BucketName: "testing"})
+	assert.Equal(t, ErrStreamDisabled, err)
+
+	_, _, err = s.Watch(types.WatchInput{BucketName: "testing", StartToken: "1"})
+	assert.Equal(t, gokv.ErrNotSupported, err)
+}
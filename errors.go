@@ -0,0 +1,71 @@
+package gokv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Backend independent errors. Every store wraps the errors returned by
+// its underlying datastore into one of these, so callers can use
+// errors.Is without importing a specific backend package.
+var (
+	ErrNotFound       = errors.New("key not found")
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrConflict       = errors.New("conflicting write")
+	ErrTooLarge       = errors.New("key or value too large")
+	ErrUnavailable    = errors.New("store unavailable")
+	ErrThrottled      = errors.New("request throttled")
+	ErrNotSupported   = errors.New("not supported by this store")
+)
+
+// Error carries the native error returned by a backend together
+// with the gokv error it maps to.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Wrap annotates err with kind. It returns nil if err is nil
+// and err unchanged if it already matches kind.
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, kind) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// TxnConflictError reports the op of a transaction whose condition did
+// not hold. It matches ErrConflict.
+type TxnConflictError struct {
+	// Index of the op in TxnInput.Ops, or -1 if the transaction was
+	// aborted by a concurrent write rather than by one of its conditions.
+	Index      int
+	BucketName string
+	Key        string
+}
+
+func (e *TxnConflictError) Error() string {
+	if e.Index < 0 {
+		return "transaction aborted by a concurrent write"
+	}
+	return fmt.Sprintf("condition of transaction op %d on %q in bucket %q failed", e.Index, e.Key, e.BucketName)
+}
+
+func (e *TxnConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -0,0 +1,40 @@
+package gokv
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		nativeErr := errors.New("native error")
+		err := Wrap(ErrThrottled, nativeErr)
+
+		assert.True(t, errors.Is(err, ErrThrottled))
+		assert.True(t, errors.Is(err, nativeErr))
+		assert.False(t, errors.Is(err, ErrUnavailable))
+		assert.Equal(t, "request throttled: native error", err.Error())
+	})
+
+	t.Run("happy path, already wrapped", func(t *testing.T) {
+		err := Wrap(ErrUnavailable, errors.New("native error"))
+		assert.Equal(t, err, Wrap(ErrUnavailable, err))
+	})
+
+	t.Run("happy path, nil error", func(t *testing.T) {
+		assert.NoError(t, Wrap(ErrNotFound, nil))
+	})
+}
+
+func TestTxnConflictError(t *testing.T) {
+	err := error(&TxnConflictError{Index: 2, BucketName: "testing", Key: "foo"})
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, `condition of transaction op 2 on "foo" in bucket "testing" failed`, err.Error())
+
+	err = &TxnConflictError{Index: -1}
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Equal(t, "transaction aborted by a concurrent write", err.Error())
+}
@@ -0,0 +1,36 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "FS_TestConformance-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	newStore := func(t *testing.T) gokv.Store {
+		path, err := ioutil.TempDir(dir, "store-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := NewStore(Options{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	storetest.Run(t, newStore)
+	storetest.RunWatch(t, newStore)
+}
@@ -0,0 +1,1250 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+)
+
+// ErrNameTooLong is returned for keys and bucket names whose encoded
+// file name is longer than most file systems allow. It matches
+// gokv.ErrTooLarge.
+var ErrNameTooLong = errors.New("encoded name too long")
+
+const (
+	// tmpPrefix starts the names of the files being written. Encoded
+	// names never start with a dot, so these are told apart when listing.
+	tmpPrefix = ".tmp-"
+	// expirySuffix names the file next to an item holding its expiration
+	// time. Encoded names never contain a dot.
+	expirySuffix = ".expires"
+	// maxNameLen is the longest encoded name, leaving room for expirySuffix
+	// within the 255 bytes most file systems allow.
+	maxNameLen = 255 - len(expirySuffix)
+
+	dirPerm = 0700
+)
+
+type Options struct {
+	// Path is the directory holding the buckets. It is created if missing.
+	Path  string
+	Codec encoding.Codec
+}
+
+var DefaultOptions = Options{
+	Path:  "gokvfs",
+	Codec: encoding.JSON,
+}
+
+// Store keeps every bucket in a directory under Path and every item in a
+// file of that directory, spread over 256 subdirectories by a hash of the
+// key. File names are the keys, with every byte other than a lower case
+// letter, a digit, '-' and '_' escaped as %XX. Values are written as
+// encoded by the codec, and the expiration time of an item with a TTL is
+// kept in a file next to it, suffixed with ".expires".
+//
+// Every file is replaced atomically, but writes spanning several files,
+// such as BatchSet and Txn, are only atomic with respect to the copies of
+// the Store in this process, and may be partially applied by a crash.
+type Store struct {
+	dir   string
+	codec encoding.Codec
+	mu    *sync.RWMutex
+	feed  *util.Feed
+	// view is set on the Store passed to the fn of View, which holds the
+	// read lock while fn runs.
+	view bool
+}
+
+var _ gokv.StoreWithContext = (*Store)(nil)
+
+func NewStore(options Options) (*Store, error) {
+	if options.Path == "" {
+		options.Path = DefaultOptions.Path
+	}
+	if options.Codec == nil {
+		options.Codec = DefaultOptions.Codec
+	}
+
+	if err := os.MkdirAll(options.Path, dirPerm); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir:   options.Path,
+		codec: options.Codec,
+		mu:    &sync.RWMutex{},
+		feed:  &util.Feed{},
+	}, nil
+}
+
+func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return wrapErr(s.put(input.BucketName, input.Key, data, input.TTL))
+}
+
+// BatchSet writes one file per pair. See Store for its atomicity.
+func (s Store) BatchSet(input types.BatchSetItemInput) error {
+	return s.BatchSetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
+	}
+
+	if err := checkNames(input.BucketName, input.Keys...); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := reflect.ValueOf(input.Values)
+	datas := make([][]byte, len(input.Keys))
+	for i := range input.Keys {
+		data, err := s.codec.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		datas[i] = data
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, key := range input.Keys {
+		if err := s.put(input.BucketName, key, datas[i], input.TTL); err != nil {
+			return wrapErr(err)
+		}
+	}
+	return nil
+}
+
+func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return false, err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	unlock := s.rlock()
+	data, found, err := s.get(input.BucketName, input.Key, time.Now())
+	unlock()
+	if err != nil || !found {
+		return false, wrapErr(err)
+	}
+
+	return true, s.codec.Unmarshal(data, input.Value)
+}
+
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+// BatchGetWithContext reads every key under a single read lock.
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := checkNames(input.BucketName, input.Keys...); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	data := make([][]byte, len(input.Keys))
+	found := make([]bool, len(input.Keys))
+	err := func() error {
+		defer s.rlock()()
+		now := time.Now()
+		for i, key := range input.Keys {
+			var err error
+			if data[i], found[i], err = s.get(input.BucketName, key, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		return types.BatchGetItemOutput{}, wrapErr(err)
+	}
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
+func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
+	if err := util.CheckKey(input.Key); err != nil {
+		return err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found, err := s.get(input.BucketName, input.Key, time.Now())
+	if err != nil {
+		return wrapErr(err)
+	}
+	if !found {
+		return gokv.ErrNotFound
+	}
+	return wrapErr(s.remove(input.BucketName, input.Key, types.EventDelete))
+}
+
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := checkNames(input.BucketName, input.Keys...); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missing []string
+	now := time.Now()
+	for _, key := range input.Keys {
+		_, found, err := s.get(input.BucketName, key, now)
+		if err != nil {
+			return types.BatchDeleteItemOutput{}, wrapErr(err)
+		}
+		if !found {
+			missing = append(missing, key)
+			continue
+		}
+		if err := s.remove(input.BucketName, key, types.EventDelete); err != nil {
+			return types.BatchDeleteItemOutput{}, wrapErr(err)
+		}
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
+}
+
+// SetIfNotExistsWithContext is atomic with respect to the copies of the
+// Store in this process only, as are the other conditional writes.
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found, err := s.get(input.BucketName, input.Key, time.Now())
+	if err != nil {
+		return wrapErr(err)
+	}
+	if found {
+		return gokv.ErrConflict
+	}
+	return wrapErr(s.put(input.BucketName, input.Key, data, input.TTL))
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	oldData, err := s.codec.Marshal(input.OldValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, found, err := s.get(input.BucketName, input.Key, time.Now())
+	if err != nil {
+		return wrapErr(err)
+	}
+	if !found || !bytes.Equal(current, oldData) {
+		return gokv.ErrConflict
+	}
+	return wrapErr(s.put(input.BucketName, input.Key, newData, input.TTL))
+}
+
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, found, err := s.get(input.BucketName, input.Key, time.Now())
+	if err != nil {
+		return wrapErr(err)
+	}
+	if !found || !bytes.Equal(current, data) {
+		return gokv.ErrConflict
+	}
+	return wrapErr(s.remove(input.BucketName, input.Key, types.EventDelete))
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext evaluates the conditions and applies the ops in order
+// under a single write lock. See Store for its atomicity.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	for _, op := range input.Ops {
+		if err := checkNames(op.BucketName, op.Key); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(input.Ops))
+	matches := make([][]byte, len(input.Ops))
+	for i, op := range input.Ops {
+		var err error
+		if op.Type == types.TxnSet {
+			if values[i], err = s.codec.Marshal(op.Value); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if matches[i], err = s.codec.Marshal(op.Match); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+
+	live := make([]bool, len(input.Ops))
+	for i, op := range input.Ops {
+		current, found, err := s.get(op.BucketName, op.Key, now)
+		if err != nil {
+			return wrapErr(err)
+		}
+		if !txnConditionHolds(op, current, found, matches[i]) {
+			return &gokv.TxnConflictError{Index: i, BucketName: op.BucketName, Key: op.Key}
+		}
+		live[i] = found
+	}
+
+	for i, op := range input.Ops {
+		var err error
+		switch op.Type {
+		case types.TxnSet:
+			err = s.put(op.BucketName, op.Key, values[i], op.TTL)
+		case types.TxnDelete:
+			if live[i] {
+				err = s.remove(op.BucketName, op.Key, types.EventDelete)
+			}
+		}
+		if err != nil {
+			return wrapErr(err)
+		}
+	}
+	return nil
+}
+
+// txnConditionHolds evaluates the condition of op against the live value
+// of its item, matching it against match for TxnMatches.
+func txnConditionHolds(op types.TxnOp, current []byte, found bool, match []byte) bool {
+	switch op.Condition {
+	case types.TxnAlways:
+		return true
+	case types.TxnExists:
+		return found
+	case types.TxnNotExists:
+		return !found
+	case types.TxnMatches:
+		return found && bytes.Equal(current, match)
+	}
+	return false
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext holds the read lock of the store while fn runs, so every
+// read of tx sees the same items, unless another process writes to the
+// directory. fn must not write to the store, as the write would wait for
+// fn to return.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.view = true
+	return fn(readTx{ctx: ctx, s: s})
+}
+
+// rlock locks the store for reading, unless the read lock is held by a View.
+func (s Store) rlock() func() {
+	if s.view {
+		return func() {}
+	}
+	s.mu.RLock()
+	return s.mu.RUnlock
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+// DeleteBucketWithContext removes the directory of the bucket.
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
+	if err := checkNames(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.bucketDir(input.BucketName)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return gokv.ErrBucketNotFound
+	}
+
+	var files []itemFile
+	if s.feed.Active() {
+		var err error
+		if files, err = s.listItems(input.BucketName); err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return wrapErr(err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		return wrapErr(err)
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		typ := types.EventDelete
+		if expired, _ := isExpired(f.path, now); expired {
+			typ = types.EventExpire
+		}
+		s.feed.Publish(types.Event{Type: typ, BucketName: input.BucketName, Key: f.key})
+	}
+	return nil
+}
+
+func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext lists every file of the bucket and sorts their keys, as
+// keys are spread over the subdirectories by hash, before reading the
+// values of the page.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
+	if err := checkNames(input.BucketName); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	var start string
+	if input.StartToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(input.StartToken)
+		if err != nil || len(b) == 0 {
+			return types.ScanOutput{}, util.ErrInvalidToken
+		}
+		start = string(b)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	defer s.rlock()()
+
+	files, err := s.listItems(input.BucketName)
+	if err != nil {
+		return types.ScanOutput{}, wrapErr(err)
+	}
+
+	// seek straight to the first candidate
+	seek := start
+	for _, bound := range []string{input.Prefix, input.StartKey} {
+		if bound > seek {
+			seek = bound
+		}
+	}
+
+	var out types.ScanOutput
+	now := time.Now()
+	i := sort.Search(len(files), func(i int) bool { return files[i].key >= seek })
+	for ; i < len(files); i++ {
+		if err := ctx.Err(); err != nil {
+			return types.ScanOutput{}, err
+		}
+
+		f := files[i]
+		if !strings.HasPrefix(f.key, input.Prefix) || (input.EndKey != "" && f.key >= input.EndKey) {
+			break
+		}
+
+		data, found, err := readItem(f.path, now)
+		if err != nil {
+			return types.ScanOutput{}, wrapErr(err)
+		}
+		if !found {
+			continue
+		}
+
+		if input.Limit > 0 && len(out.Keys) == input.Limit {
+			out.NextToken = base64.RawURLEncoding.EncodeToString([]byte(f.key))
+			break
+		}
+
+		out.Keys = append(out.Keys, f.key)
+		out.Values = append(out.Values, data)
+	}
+	return out, nil
+}
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext reports the changes made through the copies of the
+// Store in this process. Changes made to the directory by other processes
+// are not seen, and expired items are reported once Reap removes them.
+// Changes are not kept, so StartToken is not supported.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.feed.Subscribe(ctx, input)
+}
+
+// Close is a no-op, every write is on disk once it returns.
+func (s Store) Close() error {
+	return nil
+}
+
+func (s Store) Info() (types.StoreInfo, error) {
+	return s.InfoWithContext(context.Background())
+}
+
+// InfoWithContext reports the total size of the files of the store as
+// Size, including the files holding expiration times.
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return types.StoreInfo{}, err
+	}
+
+	buckets, err := s.ListBucketsWithContext(ctx)
+	if err != nil {
+		return types.StoreInfo{}, err
+	}
+
+	info := types.StoreInfo{
+		Name:    s.dir,
+		Buckets: buckets,
+	}
+	for _, bi := range buckets {
+		info.Items += bi.Items
+		info.Size += bi.Size
+	}
+	info.UsedBytes = info.Size
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext walks the directory of every bucket, sorted by
+// the encoded bucket name.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	defer s.rlock()()
+
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+
+	var buckets []types.BucketInfo
+	for _, e := range entries {
+		name, ok := decodeName(e.Name())
+		if !e.IsDir() || !ok {
+			continue
+		}
+		info, err := s.bucketInfo(name)
+		if err != nil {
+			return nil, wrapErr(err)
+		}
+		buckets = append(buckets, info)
+	}
+	return buckets, nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := checkNames(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	defer s.rlock()()
+
+	if _, err := os.Stat(s.bucketDir(input.BucketName)); os.IsNotExist(err) {
+		return types.BucketInfo{}, gokv.ErrBucketNotFound
+	}
+	info, err := s.bucketInfo(input.BucketName)
+	if err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+	return info, nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+// ExistsWithContext stats the file of the item instead of reading it.
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	defer s.rlock()()
+
+	path := s.itemPath(input.BucketName, input.Key)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, wrapErr(err)
+	}
+
+	expired, err := isExpired(path, time.Now())
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return !expired, nil
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+// CountWithContext lists the files of the bucket, reading only the
+// expiration times of the items that have one.
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := checkNames(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	defer s.rlock()()
+
+	files, err := s.listItems(input.BucketName)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	var n int64
+	now := time.Now()
+	for _, f := range files {
+		if f.expires {
+			expired, err := isExpired(f.path, now)
+			if err != nil {
+				return 0, wrapErr(err)
+			}
+			if expired {
+				continue
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext reads, updates and writes back the counter
+// under the write lock, keeping its expiration time.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := checkNames(input.BucketName, input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	data, found, err := s.get(input.BucketName, input.Key, now)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+
+	var ttl time.Duration
+	if found {
+		t, err := expiresAt(s.itemPath(input.BucketName, input.Key))
+		if err != nil {
+			return 0, wrapErr(err)
+		}
+		if !t.IsZero() {
+			ttl = t.Sub(now)
+		}
+	}
+
+	n, data, err := util.Increment(data, input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.put(input.BucketName, input.Key, data, ttl); err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, nil
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+// Reap removes the files of the expired items of bucketName, along with
+// temporary files left behind by writes interrupted by a crash.
+func (s Store) Reap(bucketName string) error {
+	if err := checkNames(bucketName); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.listItems(bucketName)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		if !f.expires {
+			continue
+		}
+		expired, err := isExpired(f.path, now)
+		if err != nil {
+			return wrapErr(err)
+		}
+		if expired {
+			if err := s.remove(bucketName, f.key, types.EventExpire); err != nil {
+				return wrapErr(err)
+			}
+		}
+	}
+
+	tmps, err := filepath.Glob(filepath.Join(s.bucketDir(bucketName), "*", tmpPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, tmp := range tmps {
+		if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+			return wrapErr(err)
+		}
+	}
+	return nil
+}
+
+// itemFile is an item found by listing a bucket.
+type itemFile struct {
+	key  string
+	path string
+	size int64
+	// expires is set if the item has an expiration time.
+	expires bool
+}
+
+func (s Store) bucketDir(bucketName string) string {
+	return filepath.Join(s.dir, encodeName(bucketName))
+}
+
+func (s Store) itemPath(bucketName, key string) string {
+	return filepath.Join(s.bucketDir(bucketName), shard(key), encodeName(key))
+}
+
+// get reads the live value of key, reporting whether it was found.
+func (s Store) get(bucketName, key string, now time.Time) ([]byte, bool, error) {
+	return readItem(s.itemPath(bucketName, key), now)
+}
+
+// put writes the item and its expiration time, or removes the file holding
+// the expiration time for a ttl <= 0.
+func (s Store) put(bucketName, key string, data []byte, ttl time.Duration) error {
+	path := s.itemPath(bucketName, key)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return err
+	}
+
+	// the expiration time goes first, so a crash in between leaves
+	// the previous value expiring rather than a new one never expiring
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl).UTC().Format(time.RFC3339Nano)
+		if err := writeFile(path+expirySuffix, []byte(expiresAt)); err != nil {
+			return err
+		}
+	}
+	if err := writeFile(path, data); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		if err := os.Remove(path + expirySuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	s.feed.Publish(types.Event{Type: types.EventPut, BucketName: bucketName, Key: key})
+	return nil
+}
+
+// remove deletes the files of the item and reports the change as typ.
+func (s Store) remove(bucketName, key string, typ types.EventType) error {
+	path := s.itemPath(bucketName, key)
+	for _, p := range []string{path, path + expirySuffix} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	s.feed.Publish(types.Event{Type: typ, BucketName: bucketName, Key: key})
+	return nil
+}
+
+// listItems lists the items of the bucket, sorted by key. Expired items
+// are included. A missing bucket has no items.
+func (s Store) listItems(bucketName string) ([]itemFile, error) {
+	dir := s.bucketDir(bucketName)
+	shards, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []itemFile
+	for _, sh := range shards {
+		if !sh.IsDir() {
+			continue
+		}
+		shardDir := filepath.Join(dir, sh.Name())
+		entries, err := ioutil.ReadDir(shardDir)
+		if err != nil {
+			return nil, err
+		}
+
+		expires := make(map[string]bool)
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), expirySuffix) {
+				expires[strings.TrimSuffix(e.Name(), expirySuffix)] = true
+			}
+		}
+		for _, e := range entries {
+			key, ok := decodeName(e.Name())
+			if !ok || !e.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, itemFile{
+				key:     key,
+				path:    filepath.Join(shardDir, e.Name()),
+				size:    e.Size(),
+				expires: expires[e.Name()],
+			})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].key < files[j].key })
+	return files, nil
+}
+
+// bucketInfo describes the bucket. Items that expired but have not been
+// reaped yet are still counted.
+func (s Store) bucketInfo(bucketName string) (types.BucketInfo, error) {
+	info := types.BucketInfo{Name: bucketName}
+	err := filepath.Walk(s.bucketDir(bucketName), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		info.Size += fi.Size()
+		if _, ok := decodeName(fi.Name()); ok {
+			info.Items++
+		}
+		return nil
+	})
+	return info, err
+}
+
+// readItem reads the item at path, reporting whether it exists and has
+// not expired.
+func readItem(path string, now time.Time) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	expired, err := isExpired(path, now)
+	if err != nil || expired {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// isExpired reports whether the item at path has an expiration time that
+// is not after now.
+func isExpired(path string, now time.Time) (bool, error) {
+	t, err := expiresAt(path)
+	if err != nil || t.IsZero() {
+		return false, err
+	}
+	return !t.After(now), nil
+}
+
+// expiresAt returns the expiration time of the item at path, which is
+// zero if it has none. An expiration time that cannot be parsed, as left
+// by a corrupted file, is taken as long past, so the item is dropped
+// rather than kept forever.
+func expiresAt(path string) (time.Time, error) {
+	v, err := ioutil.ReadFile(path + expirySuffix)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, string(v))
+	if err != nil {
+		return time.Unix(0, 0), nil
+	}
+	return t, nil
+}
+
+// writeFile replaces the file at path with data atomically, by renaming
+// a synced temporary file over it and syncing the directory.
+func writeFile(path string, data []byte) (err error) {
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes the creation, renaming and removal of the files of dir
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// shard names the subdirectory of the bucket holding key.
+func shard(key string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return fmt.Sprintf("%02x", h.Sum32()&0xff)
+}
+
+// encodeName maps s onto a file name made of lower case letters, digits,
+// '-', '_' and %XX escapes. Upper case letters are escaped as well, so
+// names stay distinct on case-insensitive file systems.
+func encodeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// decodeName reverses encodeName, reporting false for names it cannot
+// have produced, such as those of temporary and expiration time files.
+func decodeName(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_':
+			b.WriteByte(c)
+		case c == '%' && i+2 < len(name):
+			v, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", false
+			}
+			b.WriteByte(byte(v))
+			i += 2
+		default:
+			return "", false
+		}
+	}
+	// escapes are upper case hex, and only of the bytes that need one
+	if encodeName(b.String()) != name {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// checkNames returns an error if bucketName is empty, or if it or any of
+// keys is too long once encoded.
+func checkNames(bucketName string, keys ...string) error {
+	if err := util.CheckBucketName(bucketName); err != nil {
+		return err
+	}
+	if len(encodeName(bucketName)) > maxNameLen {
+		return gokv.Wrap(gokv.ErrTooLarge, ErrNameTooLong)
+	}
+	for _, key := range keys {
+		if len(encodeName(key)) > maxNameLen {
+			return gokv.Wrap(gokv.ErrTooLarge, ErrNameTooLong)
+		}
+	}
+	return nil
+}
+
+// wrapErr maps errors returned by the file system onto their gokv
+// equivalents.
+func wrapErr(err error) error {
+	if errors.Is(err, syscall.ENAMETOOLONG) {
+		return gokv.Wrap(gokv.ErrTooLarge, err)
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package filesystem
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "FS_TestStore-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore(Options{Path: filepath.Join(dir, "store")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestNewStore(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	fi, err := os.Stat(s.dir)
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+}
+
+func TestEncodeName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{name: "foo-bar_42", expected: "foo-bar_42"},
+		{name: "Foo", expected: "%46oo"},
+		{name: "../etc/passwd", expected: "%2E%2E%2Fetc%2Fpasswd"},
+		{name: ".", expected: "%2E"},
+		{name: "a b%c", expected: "a%20b%25c"},
+		{name: "\x00é", expected: "%00%C3%A9"},
+	}
+
+	for _, tc := range testCases {
+		encoded := encodeName(tc.name)
+		assert.Equal(t, tc.expected, encoded, tc.name)
+
+		decoded, ok := decodeName(encoded)
+		assert.True(t, ok, tc.name)
+		assert.Equal(t, tc.name, decoded, tc.name)
+	}
+
+	// names that encodeName does not produce are not items
+	for _, name := range []string{"", ".tmp-123", "foo.expires", "Foo", "%4a", "%2", "%zz", "%61"} {
+		_, ok := decodeName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestStore_Layout(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "My Bucket", Key: "user/42", Value: "val"}))
+
+	path := filepath.Join(s.dir, "%4Dy%20%42ucket", shard("user/42"), "user%2F42")
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `"val"`, string(data))
+
+	// no temporary file is left behind
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// a file written by hand is picked up
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(filepath.Dir(path), "other"), []byte(`"hand"`), 0600))
+	out, err := s.Scan(types.ScanInput{BucketName: "My Bucket"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other", "user/42"}, out.Keys)
+}
+
+func TestStore_Scan(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	keys := []string{"d", "a", "c", "b", "e"}
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: keys, Values: []string{"1", "2", "3", "4", "5"}}))
+
+	// keys are sorted across the subdirectories
+	out, err := s.Scan(types.ScanInput{BucketName: "foo", Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, out.Keys)
+	assert.Equal(t, [][]byte{[]byte(`"2"`), []byte(`"4"`), []byte(`"3"`)}, out.Values)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: out.NextToken})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "e"}, out.Keys)
+	assert.Empty(t, out.NextToken)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "missing"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Keys)
+
+	_, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: "!"})
+	assert.Equal(t, util.ErrInvalidToken, err)
+}
+
+func TestStore_TTL(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Nanosecond}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "c", Value: "val"}))
+	time.Sleep(time.Millisecond)
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	exists, err := s.Exists(types.ExistsInput{BucketName: "foo", Key: "a"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// a crashed write leaves a temporary file, which Reap cleans up
+	tmp := filepath.Join(s.bucketDir("foo"), shard("c"), tmpPrefix+"1")
+	assert.NoError(t, ioutil.WriteFile(tmp, []byte("partial"), 0600))
+
+	assert.NoError(t, s.Reap("foo"))
+	_, err = os.Stat(s.itemPath("foo", "a"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(s.itemPath("foo", "a") + expirySuffix)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+
+	// overwriting without a TTL clears it
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val"}))
+	_, err = os.Stat(s.itemPath("foo", "b") + expirySuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	info, err := s.BucketInfo(types.BucketInfoInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), info.Items)
+}
+
+func TestStore_TTL_Corrupt(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, ioutil.WriteFile(s.itemPath("foo", "a")+expirySuffix, []byte("garbage"), 0600))
+
+	// an unreadable expiration time counts as expired
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, s.Reap("foo"))
+	_, err = os.Stat(s.itemPath("foo", "a"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStore_Info(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "a", Value: "value"}))
+
+	info, err := s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, s.dir, info.Name)
+	assert.Equal(t, int64(3), info.Items)
+	assert.Equal(t, []types.BucketInfo{
+		{Name: "bar", Items: 1, Size: 7},
+		// the expiration time of b takes up as many bytes as its RFC 3339 form
+		{Name: "foo", Items: 2, Size: 10 + int64(len(readFile(t, s.itemPath("foo", "b")+expirySuffix)))},
+	}, info.Buckets)
+	assert.Equal(t, info.Buckets[0].Size+info.Buckets[1].Size, info.Size)
+	assert.Equal(t, info.Size, info.UsedBytes)
+
+	_, err = s.BucketInfo(types.BucketInfoInput{BucketName: "missing"})
+	assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+}
+
+func TestStore_NameTooLong(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	// every upper case letter takes three bytes once escaped
+	key := strings.Repeat("K", maxNameLen/3+1)
+	err := s.Set(types.SetItemInput{BucketName: "foo", Key: key, Value: "val"})
+	assert.True(t, errors.Is(err, gokv.ErrTooLarge))
+	assert.True(t, errors.Is(err, ErrNameTooLong))
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: key[:maxNameLen/3], Value: "val"}))
+}
+
+func TestStore_DeleteBucket(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"}))
+
+	_, err := os.Stat(s.bucketDir("foo"))
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, errors.Is(s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"}), gokv.ErrBucketNotFound))
+}
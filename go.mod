@@ -1,15 +1,14 @@
 module github.com/simar7/gokv
 
-go 1.12
+go 1.13
 
 require (
 	github.com/alicebob/miniredis/v2 v2.11.0
 	github.com/aws/aws-sdk-go v1.25.31
-	github.com/davecgh/go-spew v1.1.0
+	github.com/dgraph-io/badger/v2 v2.2007.4
 	github.com/dustin/go-humanize v1.0.0
-	github.com/gomodule/redigo v2.0.0+incompatible
-	github.com/stretchr/testify v1.4.0
+	github.com/gomodule/redigo v1.8.9
+	github.com/stretchr/testify v1.7.0
 	go.etcd.io/bbolt v1.3.3
-	golang.org/x/net v0.0.0-20191108221443-4ba9e2ef068c // indirect
-	golang.org/x/sys v0.0.0-20191105231009-c1f44814a5cd // indirect
+	modernc.org/sqlite v1.10.6
 )
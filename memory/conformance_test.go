@@ -0,0 +1,31 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	newStore := func(t *testing.T) gokv.Store {
+		s, err := NewStore(Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	storetest.Run(t, newStore)
+	storetest.RunWatch(t, newStore)
+}
+
+func TestConformance_Limited(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) gokv.Store {
+		s, err := NewStore(Options{MaxItems: 1000, Eviction: LFU})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
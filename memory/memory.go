@@ -0,0 +1,1103 @@
+package memory
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+)
+
+// ErrItemTooLarge is returned for items larger than MaxBytes on their own.
+// It matches gokv.ErrTooLarge.
+var ErrItemTooLarge = errors.New("item larger than MaxBytes")
+
+// ctxCheckInterval is the number of keys visited between
+// checks of the context during long running iterations.
+const ctxCheckInterval = 1000
+
+// EvictionPolicy selects the item evicted to stay within the
+// capacity limits of a store.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used item.
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used item, and the least
+	// recently used one among items used equally often.
+	LFU
+)
+
+type Options struct {
+	// Name is reported by Info.
+	Name  string
+	Codec encoding.Codec
+	// MaxItems and MaxBytes limit the number of items and the size of their
+	// keys and values across all buckets. Once a write goes beyond a limit,
+	// items are evicted as chosen by Eviction. Zero means no limit.
+	MaxItems int
+	MaxBytes int64
+	Eviction EvictionPolicy
+}
+
+var DefaultOptions = Options{
+	Name:  "gokvmemory",
+	Codec: encoding.JSON,
+}
+
+// Store keeps its buckets in process memory. Copies of a Store share the
+// same items, which are lost once the last copy is dropped.
+type Store struct {
+	db    *db
+	name  string
+	codec encoding.Codec
+	// view is set on the Store passed to the fn of View, which holds the
+	// read lock of db while fn runs.
+	view bool
+}
+
+var _ gokv.StoreWithContext = (*Store)(nil)
+
+func NewStore(options Options) (*Store, error) {
+	if options.Name == "" {
+		options.Name = DefaultOptions.Name
+	}
+	if options.Codec == nil {
+		options.Codec = DefaultOptions.Codec
+	}
+
+	return &Store{
+		db: &db{
+			buckets:  make(map[string]*bucket),
+			maxItems: options.MaxItems,
+			maxBytes: options.MaxBytes,
+			usage:    usageHeap{policy: options.Eviction},
+		},
+		name:  options.Name,
+		codec: options.Codec,
+	}, nil
+}
+
+func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+	if err := s.db.checkSize(input.Key, data); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.makeRoom(s.db.put(input.BucketName, input.Key, data, input.TTL, time.Now()))
+	return nil
+}
+
+// BatchSet writes all pairs atomically.
+func (s Store) BatchSet(input types.BatchSetItemInput) error {
+	return s.BatchSetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := reflect.ValueOf(input.Values)
+	datas := make([][]byte, len(input.Keys))
+	for i, key := range input.Keys {
+		data, err := s.codec.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		if err := s.db.checkSize(key, data); err != nil {
+			return err
+		}
+		datas[i] = data
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	for i, key := range input.Keys {
+		s.db.makeRoom(s.db.put(input.BucketName, key, datas[i], input.TTL, now))
+	}
+	return nil
+}
+
+func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	var data []byte
+	s.read(func(record bool) {
+		if it := s.db.lookup(input.BucketName, input.Key, time.Now(), record); it != nil {
+			data = it.data
+		}
+	})
+
+	if data == nil {
+		return false, nil
+	}
+
+	return true, s.codec.Unmarshal(data, input.Value)
+}
+
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+// BatchGetWithContext reads every key under a single lock.
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	data := make([][]byte, len(input.Keys))
+	found := make([]bool, len(input.Keys))
+	s.read(func(record bool) {
+		now := time.Now()
+		for i, key := range input.Keys {
+			if it := s.db.lookup(input.BucketName, key, now, record); it != nil {
+				data[i] = it.data
+				found[i] = true
+			}
+		}
+	})
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
+func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
+	if err := util.CheckKey(input.Key); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	it := s.db.lookup(input.BucketName, input.Key, time.Now(), false)
+	if it == nil {
+		return gokv.ErrNotFound
+	}
+	s.db.remove(it, types.EventDelete)
+	return nil
+}
+
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+// BatchDeleteWithContext deletes every key under a single lock.
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	var missing []string
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	for _, key := range input.Keys {
+		if it := s.db.lookup(input.BucketName, key, now, false); it != nil {
+			s.db.remove(it, types.EventDelete)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
+}
+
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+	if err := s.db.checkSize(input.Key, data); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	if s.db.lookup(input.BucketName, input.Key, now, false) != nil {
+		return gokv.ErrConflict
+	}
+	s.db.makeRoom(s.db.put(input.BucketName, input.Key, data, input.TTL, now))
+	return nil
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	oldData, err := s.codec.Marshal(input.OldValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
+	}
+	if err := s.db.checkSize(input.Key, newData); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	if it := s.db.lookup(input.BucketName, input.Key, now, false); it == nil || !bytes.Equal(it.data, oldData) {
+		return gokv.ErrConflict
+	}
+	s.db.makeRoom(s.db.put(input.BucketName, input.Key, newData, input.TTL, now))
+	return nil
+}
+
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	it := s.db.lookup(input.BucketName, input.Key, time.Now(), false)
+	if it == nil || !bytes.Equal(it.data, data) {
+		return gokv.ErrConflict
+	}
+	s.db.remove(it, types.EventDelete)
+	return nil
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext evaluates the conditions and applies the ops in order
+// under a single lock.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	for _, op := range input.Ops {
+		if err := util.CheckBucketName(op.BucketName); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(input.Ops))
+	matches := make([][]byte, len(input.Ops))
+	for i, op := range input.Ops {
+		var err error
+		if op.Type == types.TxnSet {
+			if values[i], err = s.codec.Marshal(op.Value); err != nil {
+				return err
+			}
+			if err := s.db.checkSize(op.Key, values[i]); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if matches[i], err = s.codec.Marshal(op.Match); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+
+	for i, op := range input.Ops {
+		if !s.db.txnConditionHolds(op, matches[i], now) {
+			return &gokv.TxnConflictError{Index: i, BucketName: op.BucketName, Key: op.Key}
+		}
+	}
+
+	for i, op := range input.Ops {
+		switch op.Type {
+		case types.TxnSet:
+			s.db.makeRoom(s.db.put(op.BucketName, op.Key, values[i], op.TTL, now))
+		case types.TxnDelete:
+			if it := s.db.lookup(op.BucketName, op.Key, now, false); it != nil {
+				s.db.remove(it, types.EventDelete)
+			}
+		}
+	}
+	return nil
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext holds the read lock of the store while fn runs, so every
+// read of tx sees the same items. fn must not write to the store, as the
+// write would wait for fn to return. Reads of tx do not count as uses of
+// items for eviction.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	s.view = true
+	return fn(readTx{ctx: ctx, s: s})
+}
+
+// read runs fn with the store locked for reading items by key. fn is
+// passed true when it is to record uses and drop expired items, which
+// takes the write lock. That is only needed outside of a View by a store
+// with a capacity limit, so other reads share the read lock.
+func (s Store) read(fn func(record bool)) {
+	if s.view {
+		fn(false)
+		return
+	}
+	if !s.db.limited() {
+		s.db.mu.RLock()
+		defer s.db.mu.RUnlock()
+		fn(false)
+		return
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	fn(true)
+}
+
+// rlock locks the store for reading, unless the read lock is held by a View.
+func (s Store) rlock() func() {
+	if s.view {
+		return func() {}
+	}
+	s.db.mu.RLock()
+	return s.db.mu.RUnlock
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	b := s.db.buckets[input.BucketName]
+	if b == nil {
+		return gokv.ErrBucketNotFound
+	}
+	now := time.Now()
+	for _, it := range b.items {
+		typ := types.EventDelete
+		if it.expired(now) {
+			typ = types.EventExpire
+		}
+		s.db.remove(it, typ)
+	}
+	delete(s.db.buckets, input.BucketName)
+	return nil
+}
+
+func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext walks the keys of the bucket in sorted order. The sorted
+// keys are cached until the next write to the bucket adds or removes a key.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	var start string
+	if input.StartToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(input.StartToken)
+		if err != nil || len(b) == 0 {
+			return types.ScanOutput{}, util.ErrInvalidToken
+		}
+		start = string(b)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	defer s.rlock()()
+
+	var out types.ScanOutput
+	b := s.db.buckets[input.BucketName]
+	if b == nil {
+		return out, nil
+	}
+
+	// seek straight to the first candidate
+	seek := start
+	for _, bound := range []string{input.Prefix, input.StartKey} {
+		if bound > seek {
+			seek = bound
+		}
+	}
+
+	keys := b.sortedKeys()
+	now := time.Now()
+	for i := sort.SearchStrings(keys, seek); i < len(keys); i++ {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return types.ScanOutput{}, err
+			}
+		}
+
+		k := keys[i]
+		if !strings.HasPrefix(k, input.Prefix) || (input.EndKey != "" && k >= input.EndKey) {
+			break
+		}
+
+		it := b.items[k]
+		if it.expired(now) {
+			continue
+		}
+
+		if input.Limit > 0 && len(out.Keys) == input.Limit {
+			out.NextToken = base64.RawURLEncoding.EncodeToString([]byte(k))
+			break
+		}
+
+		out.Keys = append(out.Keys, k)
+		out.Values = append(out.Values, append([]byte{}, it.data...))
+	}
+	return out, nil
+}
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext reports the changes made through any copy of the store.
+// Evicted items are reported as deleted, and expired items once they are
+// removed by Reap, DeleteBucket or a read from a store with a capacity
+// limit. Changes are not kept, so
+// StartToken is not supported.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.db.feed.Subscribe(ctx, input)
+}
+
+// Close is a no-op, the items stay in memory until the Store is dropped.
+func (s Store) Close() error {
+	return nil
+}
+
+func (s Store) Info() (types.StoreInfo, error) {
+	return s.InfoWithContext(context.Background())
+}
+
+// InfoWithContext reports the size of keys and values as Size, which is
+// what MaxBytes limits. It does not include the overhead of the maps
+// holding them.
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return types.StoreInfo{}, err
+	}
+
+	defer s.rlock()()
+
+	info := types.StoreInfo{
+		Name:      s.name,
+		Size:      s.db.size,
+		Items:     int64(s.db.items),
+		UsedBytes: s.db.size,
+		Buckets:   s.db.listBuckets(),
+	}
+	if s.db.maxBytes > 0 {
+		info.FreeBytes = s.db.maxBytes - s.db.size
+	}
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext describes the buckets sorted by name.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	defer s.rlock()()
+	return s.db.listBuckets(), nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	defer s.rlock()()
+	b := s.db.buckets[input.BucketName]
+	if b == nil {
+		return types.BucketInfo{}, gokv.ErrBucketNotFound
+	}
+	return b.info(input.BucketName), nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+// ExistsWithContext does not count as a use of the item for eviction.
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	defer s.rlock()()
+	return s.db.lookup(input.BucketName, input.Key, time.Now(), false) != nil, nil
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	defer s.rlock()()
+	b := s.db.buckets[input.BucketName]
+	if b == nil {
+		return 0, nil
+	}
+
+	var n int64
+	now := time.Now()
+	for _, it := range b.items {
+		if !it.expired(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext reads, updates and writes back the counter
+// under a single lock, keeping its expiration time.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+
+	var data []byte
+	var ttl time.Duration
+	if it := s.db.lookup(input.BucketName, input.Key, now, false); it != nil {
+		data = it.data
+		if !it.expiresAt.IsZero() {
+			ttl = it.expiresAt.Sub(now)
+		}
+	}
+
+	n, data, err := util.Increment(data, input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	s.db.makeRoom(s.db.put(input.BucketName, input.Key, data, ttl, now))
+	return n, nil
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+// Reap removes the expired items of bucketName. Expired items are never
+// returned, but without Reap they are only removed once they are
+// overwritten or evicted, or read from a store with a capacity limit.
+func (s Store) Reap(bucketName string) error {
+	if err := util.CheckBucketName(bucketName); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	b := s.db.buckets[bucketName]
+	if b == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, it := range b.items {
+		if it.expired(now) {
+			s.db.remove(it, types.EventExpire)
+		}
+	}
+	return nil
+}
+
+// db holds the items shared by the copies of a Store.
+type db struct {
+	mu      sync.RWMutex
+	buckets map[string]*bucket
+	// items and size hold the number of items and the size of their keys
+	// and values across all buckets.
+	items int
+	size  int64
+
+	maxItems int
+	maxBytes int64
+	// usage orders the items by eviction priority. It is only kept
+	// when a capacity limit is set.
+	usage usageHeap
+	clock uint64
+
+	feed util.Feed
+}
+
+type bucket struct {
+	items map[string]*item
+	size  int64
+
+	// keys caches the sorted keys of items for scans. Writes that add or
+	// remove a key reset it, holding the write lock of the db, while scans
+	// holding the read lock rebuild it under keysMu.
+	keysMu sync.Mutex
+	keys   []string
+}
+
+type item struct {
+	bucketName string
+	key        string
+	data       []byte
+	// expiresAt is zero for items that never expire.
+	expiresAt time.Time
+
+	// uses, lastUsed and index are the bookkeeping of the usage heap.
+	uses     uint64
+	lastUsed uint64
+	index    int
+}
+
+func (it *item) expired(now time.Time) bool {
+	return !it.expiresAt.IsZero() && !it.expiresAt.After(now)
+}
+
+func (it *item) size() int64 {
+	return int64(len(it.key) + len(it.data))
+}
+
+func (d *db) limited() bool {
+	return d.maxItems > 0 || d.maxBytes > 0
+}
+
+// checkSize returns an error if an item could never fit within MaxBytes.
+func (d *db) checkSize(key string, data []byte) error {
+	if d.maxBytes > 0 && int64(len(key)+len(data)) > d.maxBytes {
+		return gokv.Wrap(gokv.ErrTooLarge, ErrItemTooLarge)
+	}
+	return nil
+}
+
+// lookup returns the live item at key in bucketName, or nil. With record
+// set, it counts a use of the item and removes it if it has expired,
+// which requires the write lock.
+func (d *db) lookup(bucketName, key string, now time.Time, record bool) *item {
+	b := d.buckets[bucketName]
+	if b == nil {
+		return nil
+	}
+	it := b.items[key]
+	if it == nil {
+		return nil
+	}
+	if it.expired(now) {
+		if record {
+			d.remove(it, types.EventExpire)
+		}
+		return nil
+	}
+	if record {
+		d.touch(it)
+	}
+	return it
+}
+
+// put writes data at key in bucketName and returns the item holding it.
+// A ttl <= 0 clears any expiration previously set on the item.
+func (d *db) put(bucketName, key string, data []byte, ttl time.Duration, now time.Time) *item {
+	b := d.buckets[bucketName]
+	if b == nil {
+		b = &bucket{items: make(map[string]*item)}
+		d.buckets[bucketName] = b
+	}
+
+	it := b.items[key]
+	if it == nil {
+		it = &item{bucketName: bucketName, key: key, index: -1}
+		b.items[key] = it
+		b.keys = nil
+		d.items++
+	} else {
+		b.size -= it.size()
+		d.size -= it.size()
+	}
+
+	it.data = data
+	it.expiresAt = time.Time{}
+	if ttl > 0 {
+		it.expiresAt = now.Add(ttl)
+	}
+	b.size += it.size()
+	d.size += it.size()
+
+	d.touch(it)
+	d.feed.Publish(types.Event{Type: types.EventPut, BucketName: bucketName, Key: key})
+	return it
+}
+
+// remove drops it from its bucket and reports the change as typ.
+func (d *db) remove(it *item, typ types.EventType) {
+	b := d.buckets[it.bucketName]
+	delete(b.items, it.key)
+	b.keys = nil
+	b.size -= it.size()
+	d.size -= it.size()
+	d.items--
+
+	if it.index >= 0 {
+		heap.Remove(&d.usage, it.index)
+	}
+	d.feed.Publish(types.Event{Type: typ, BucketName: it.bucketName, Key: it.key})
+}
+
+// touch counts a use of it, if a capacity limit is set.
+func (d *db) touch(it *item) {
+	if !d.limited() {
+		return
+	}
+
+	d.clock++
+	it.uses++
+	it.lastUsed = d.clock
+	if it.index < 0 {
+		heap.Push(&d.usage, it)
+	} else {
+		heap.Fix(&d.usage, it.index)
+	}
+}
+
+// makeRoom evicts items until the store is within its capacity limits
+// again, sparing keep, the item just written.
+func (d *db) makeRoom(keep *item) {
+	for (d.maxItems > 0 && d.items > d.maxItems) || (d.maxBytes > 0 && d.size > d.maxBytes) {
+		h := d.usage.items
+		victim := h[0]
+		if victim == keep {
+			if len(h) == 1 {
+				return
+			}
+			// the next item to evict is one of the children of the root
+			victim = h[1]
+			if len(h) > 2 && d.usage.Less(2, 1) {
+				victim = h[2]
+			}
+		}
+		d.remove(victim, types.EventDelete)
+	}
+}
+
+// txnConditionHolds evaluates the condition of op, matching the live
+// value of its item against match for TxnMatches.
+func (d *db) txnConditionHolds(op types.TxnOp, match []byte, now time.Time) bool {
+	if op.Condition == types.TxnAlways {
+		return true
+	}
+
+	it := d.lookup(op.BucketName, op.Key, now, false)
+	switch op.Condition {
+	case types.TxnExists:
+		return it != nil
+	case types.TxnNotExists:
+		return it == nil
+	case types.TxnMatches:
+		return it != nil && bytes.Equal(it.data, match)
+	}
+	return false
+}
+
+func (d *db) listBuckets() []types.BucketInfo {
+	names := make([]string, 0, len(d.buckets))
+	for name := range d.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buckets := make([]types.BucketInfo, len(names))
+	for i, name := range names {
+		buckets[i] = d.buckets[name].info(name)
+	}
+	return buckets
+}
+
+// info describes the bucket. Items that expired but have not been
+// removed yet are still counted.
+func (b *bucket) info(name string) types.BucketInfo {
+	return types.BucketInfo{
+		Name:  name,
+		Items: int64(len(b.items)),
+		Size:  b.size,
+	}
+}
+
+func (b *bucket) sortedKeys() []string {
+	b.keysMu.Lock()
+	defer b.keysMu.Unlock()
+
+	if b.keys == nil {
+		b.keys = make([]string, 0, len(b.items))
+		for k := range b.items {
+			b.keys = append(b.keys, k)
+		}
+		sort.Strings(b.keys)
+	}
+	return b.keys
+}
+
+// usageHeap orders items from the first to the last to evict.
+type usageHeap struct {
+	policy EvictionPolicy
+	items  []*item
+}
+
+func (h *usageHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *usageHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.policy == LFU && a.uses != b.uses {
+		return a.uses < b.uses
+	}
+	return a.lastUsed < b.lastUsed
+}
+
+func (h *usageHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *usageHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(h.items)
+	h.items = append(h.items, it)
+}
+
+func (h *usageHeap) Pop() interface{} {
+	n := len(h.items)
+	it := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	it.index = -1
+	return it
+}
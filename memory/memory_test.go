@@ -0,0 +1,276 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/storetest"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStore(options Options) *Store {
+	s, _ := NewStore(options)
+	return s
+}
+
+func keys(t *testing.T, s *Store, bucketName string) []string {
+	t.Helper()
+	out, err := s.Scan(types.ScanInput{BucketName: bucketName})
+	assert.NoError(t, err)
+	return out.Keys
+}
+
+func TestNewStore(t *testing.T) {
+	s, err := NewStore(Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultOptions.Name, s.name)
+	assert.Equal(t, encoding.JSON, s.codec)
+}
+
+func TestStore_Codec(t *testing.T) {
+	s := setupStore(Options{Codec: encoding.Raw})
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: []byte("raw")}))
+	out, err := s.Scan(types.ScanInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("raw")}, out.Values)
+
+	// scanned values do not share memory with the store
+	out.Values[0][0] = 'x'
+	var v []byte
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("raw"), v)
+}
+
+func TestStore_Scan(t *testing.T) {
+	s := setupStore(Options{})
+
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
+		BucketName: "foo",
+		Keys:       []string{"c", "a", "d", "b"},
+		Values:     []string{"val", "val", "val", "val"},
+	}))
+
+	out, err := s.Scan(types.ScanInput{BucketName: "foo", Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, out.Keys)
+	assert.NotEmpty(t, out.NextToken)
+
+	// keys added after the token between pages are picked up in order
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "e", Value: "val"}))
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: out.NextToken})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "e"}, out.Keys)
+	assert.Empty(t, out.NextToken)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "missing"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Keys)
+
+	_, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: "!"})
+	assert.Equal(t, util.ErrInvalidToken, err)
+}
+
+func TestStore_TTL(t *testing.T) {
+	// reads only drop expired items of a store with a capacity limit
+	s := setupStore(Options{MaxItems: 10})
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Nanosecond}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Nanosecond}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "c", Value: "val", TTL: time.Hour}))
+	time.Sleep(time.Millisecond)
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, []string{"c"}, keys(t, s, "foo"))
+
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.True(t, errors.Is(s.Delete(types.DeleteItemInput{BucketName: "foo", Key: "b"}), gokv.ErrNotFound))
+	assert.NoError(t, s.SetIfNotExists(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Nanosecond}))
+	time.Sleep(time.Millisecond)
+
+	// a is gone since the Get, b is left for Reap
+	info, err := s.BucketInfo(types.BucketInfoInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), info.Items)
+
+	assert.NoError(t, s.Reap("foo"))
+	info, err = s.BucketInfo(types.BucketInfoInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), info.Items)
+
+	// overwriting without a TTL clears it
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "c", Value: "val"}))
+	assert.True(t, s.db.buckets["foo"].items["c"].expiresAt.IsZero())
+}
+
+func TestStore_TTL_Unlimited(t *testing.T) {
+	s := setupStore(Options{})
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Nanosecond}))
+	time.Sleep(time.Millisecond)
+
+	// reads share the read lock, so the expired item is left for Reap
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Equal(t, 1, s.db.items)
+
+	assert.NoError(t, s.Reap("foo"))
+	assert.Equal(t, 0, s.db.items)
+}
+
+func TestStore_Info(t *testing.T) {
+	s := setupStore(Options{Name: "test", MaxBytes: 100})
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "bb", Value: "val"}))
+
+	info, err := s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, types.StoreInfo{
+		Name:      "test",
+		Size:      13,
+		Items:     2,
+		UsedBytes: 13,
+		FreeBytes: 87,
+		Buckets: []types.BucketInfo{
+			{Name: "bar", Items: 1, Size: 7},
+			{Name: "foo", Items: 1, Size: 6},
+		},
+	}, info)
+
+	// overwrites and deletes are accounted for
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "value"}))
+	assert.NoError(t, s.Delete(types.DeleteItemInput{BucketName: "bar", Key: "bb"}))
+	info, err = s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size)
+	assert.Equal(t, int64(1), info.Items)
+
+	assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"}))
+	info, err = s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size)
+	assert.Equal(t, []types.BucketInfo{{Name: "bar"}}, info.Buckets)
+}
+
+func TestStore_Eviction(t *testing.T) {
+	testCases := []struct {
+		name     string
+		eviction EvictionPolicy
+		expected []string
+	}{
+		{
+			name:     "LRU evicts the least recently used item",
+			eviction: LRU,
+			expected: []string{"a", "c", "d"},
+		},
+		{
+			name:     "LFU evicts the least frequently used item",
+			eviction: LFU,
+			expected: []string{"a", "b", "d"},
+		},
+	}
+
+	for _, tc := range testCases {
+		s := setupStore(Options{MaxItems: 3, Eviction: tc.eviction})
+
+		for _, k := range []string{"a", "b", "c"} {
+			assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: k, Value: "val"}), tc.name)
+		}
+		// a is used the most, b the least recently but more often than c
+		var v string
+		for _, k := range []string{"a", "b", "b", "c", "a"} {
+			_, err := s.Get(types.GetItemInput{BucketName: "foo", Key: k, Value: &v})
+			assert.NoError(t, err, tc.name)
+		}
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "d", Value: "val"}), tc.name)
+
+		assert.Equal(t, tc.expected, keys(t, s, "foo"), tc.name)
+	}
+}
+
+func TestStore_Eviction_MaxBytes(t *testing.T) {
+	s := setupStore(Options{MaxBytes: 15, Eviction: LFU})
+
+	// a new item is never evicted to make room for itself, although
+	// it is the least frequently used one
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	var v string
+	_, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "c", Value: "val"}))
+	assert.Equal(t, []string{"a"}, keys(t, s, "foo"))
+	assert.Equal(t, []string{"c"}, keys(t, s, "bar"))
+
+	err = s.Set(types.SetItemInput{BucketName: "foo", Key: "d", Value: "value larger than the store"})
+	assert.True(t, errors.Is(err, gokv.ErrTooLarge))
+	assert.True(t, errors.Is(err, ErrItemTooLarge))
+
+	info, err := s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), info.Size)
+}
+
+func TestStore_View(t *testing.T) {
+	s := setupStore(Options{MaxItems: 2})
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val"}))
+
+	written := make(chan struct{})
+	err := s.View(func(tx gokv.ReadTx) error {
+		go func() {
+			defer close(written)
+			assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "c", Value: "val"}))
+		}()
+
+		// the write waits for the view to end
+		time.Sleep(10 * time.Millisecond)
+		out, err := tx.Scan(types.ScanInput{BucketName: "foo"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, out.Keys)
+
+		// reads of a view are not uses of a
+		var v string
+		found, err := tx.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	<-written
+	assert.Equal(t, []string{"b", "c"}, keys(t, s, "foo"))
+}
+
+func TestStore_Watch_Eviction(t *testing.T) {
+	s := setupStore(Options{MaxItems: 3})
+
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: "foo", Prefix: "a"})
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a1", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b1", Value: "val"}))
+
+	// evicts a1 and b1
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "bar", Keys: []string{"b1", "b2", "b3"}, Values: []string{"val", "val", "val"}}))
+
+	assert.Equal(t, types.Event{Type: types.EventPut, BucketName: "foo", Key: "a1"}, storetest.Receive(t, events))
+	assert.Equal(t, types.Event{Type: types.EventDelete, BucketName: "foo", Key: "a1"}, storetest.Receive(t, events))
+}
@@ -0,0 +1,28 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	// miniredis only expires keys when its clock is moved forward
+	storetest.RunWithOptions(t, func(t *testing.T) gokv.Store {
+		mr.FlushAll()
+
+		s, err := NewStore(Options{Address: mr.Addr()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}, storetest.Options{Sleep: mr.FastForward})
+}
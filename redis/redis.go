@@ -1,10 +1,21 @@
 package redis
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/simar7/gokv"
 	"github.com/simar7/gokv/encoding"
 
 	"github.com/simar7/gokv/util"
@@ -16,16 +27,48 @@ import (
 var (
 	ErrInvalidAddress  = errors.New("invalid redis address specified")
 	ErrRedisInitFailed = errors.New("redis initialization failed")
-	ErrKeyNotFound     = errors.New("key not found")
+	ErrKeyNotFound     = gokv.ErrNotFound
 	ErrNotImplemented  = errors.New("function not implemented")
 )
 
+// compareAndSwapScript sets KEYS[1] to ARGV[2] only if it currently
+// holds ARGV[1], expiring it after ARGV[3] milliseconds if non zero.
+var compareAndSwapScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// deleteIfScript deletes KEYS[1] only if it currently holds ARGV[1].
+var deleteIfScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call("DEL", KEYS[1])
+`)
+
+// bucketSeparator follows the length of the bucket name and the bucket
+// name itself in the redis key of an item.
+const bucketSeparator = ":"
+
+// scanBatchSize is the COUNT hint used when walking a whole bucket or the
+// whole keyspace, and so roughly the number of keys handled per round trip.
+const scanBatchSize = 1000
+
 type Options struct {
 	MaxIdleConnections   int
 	MaxActiveConnections int
 	Network              string
 	Address              string
-	Codec                encoding.Codec
+	// DB is the index of the database selected on every connection.
+	DB    int
+	Codec encoding.Codec
 }
 
 var DefaultOptions = Options{
@@ -36,17 +79,21 @@ var DefaultOptions = Options{
 }
 
 type Store struct {
-	p     *redis.Pool
-	codec encoding.Codec
+	p       *redis.Pool
+	codec   encoding.Codec
+	address string
+	db      int
 }
 
+var _ gokv.StoreWithContext = Store{}
+
 func (s Store) ping() error {
 	c := s.p.Get()
 	defer c.Close()
 
 	_, err := c.Do("PING")
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
 	return nil
@@ -77,15 +124,17 @@ func NewStore(options Options) (Store, error) {
 		p: &redis.Pool{
 			MaxIdle:   options.MaxIdleConnections,
 			MaxActive: options.MaxActiveConnections,
-			Dial: func() (redis.Conn, error) {
-				c, err := redis.Dial(options.Network, options.Address)
+			DialContext: func(ctx context.Context) (redis.Conn, error) {
+				c, err := redis.DialContext(ctx, options.Network, options.Address, redis.DialDatabase(options.DB))
 				if err != nil {
-					return nil, fmt.Errorf("%s: %s", ErrRedisInitFailed, err)
+					return nil, gokv.Wrap(gokv.ErrUnavailable, fmt.Errorf("%s: %s", ErrRedisInitFailed, err))
 				}
 				return c, nil
 			},
 		},
-		codec: options.Codec,
+		codec:   options.Codec,
+		address: options.Address,
+		db:      options.DB,
 	}
 
 	if err := s.ping(); err != nil {
@@ -96,11 +145,22 @@ func NewStore(options Options) (Store, error) {
 }
 
 func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
 	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
 		return err
 	}
 
-	c := s.p.Get()
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
 	defer c.Close()
 
 	b, err := s.codec.Marshal(input.Value)
@@ -108,52 +168,82 @@ func (s Store) Set(input types.SetItemInput) error {
 		return err
 	}
 
-	_, err = redis.String(c.Do("SET", input.Key, string(b)))
+	_, err = redis.String(redis.DoContext(c, ctx, "SET", setArgs(bucketKey(input.BucketName, input.Key), b, input.TTL)...))
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
 	return nil
 }
 
 func (s Store) BatchSet(input types.BatchSetItemInput) error {
-	c := s.p.Get()
+	return s.BatchSetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
 	defer c.Close()
 
 	for i := 0; i < len(input.Keys); i++ {
-		if err := util.CheckKeyAndValue(input.Keys[i], input.Values); err != nil {
-			return err
-		}
-
 		val := reflect.ValueOf(input.Values).Index(i).Interface()
 		b, err := s.codec.Marshal(val)
 		if err != nil {
 			return err
 		}
 
-		if err := c.Send("SET", input.Keys[i], string(b)); err != nil {
-			return err
+		if err := c.Send("SET", setArgs(bucketKey(input.BucketName, input.Keys[i]), b, input.TTL)...); err != nil {
+			return wrapErr(err)
 		}
 	}
 
 	if err := c.Flush(); err != nil {
-		return err
+		return wrapErr(err)
+	}
+
+	for range input.Keys {
+		if _, err := redis.ReceiveContext(c, ctx); err != nil {
+			return wrapErr(err)
+		}
 	}
 
 	return nil
 }
 
 func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
 	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
 		return false, err
 	}
 
-	c := s.p.Get()
-	defer c.Close()
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
 
-	val, err := redis.Bytes(c.Do("GET", input.Key))
+	c, err := s.p.GetContext(ctx)
 	if err != nil {
-		return false, ErrKeyNotFound
+		return false, wrapErr(err)
+	}
+	defer c.Close()
+
+	val, err := redis.Bytes(redis.DoContext(c, ctx, "GET", bucketKey(input.BucketName, input.Key)))
+	if err == redis.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, wrapErr(err)
 	}
 
 	if err := s.codec.Unmarshal(val, &input.Value); err != nil {
@@ -163,17 +253,68 @@ func (s Store) Get(input types.GetItemInput) (found bool, err error) {
 	return true, nil
 }
 
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return types.BatchGetItemOutput{}, wrapErr(err)
+	}
+	defer c.Close()
+
+	var args []interface{}
+	for _, k := range input.Keys {
+		args = append(args, bucketKey(input.BucketName, k))
+	}
+	data, err := redis.ByteSlices(redis.DoContext(c, ctx, "MGET", args...))
+	if err != nil {
+		return types.BatchGetItemOutput{}, wrapErr(err)
+	}
+
+	found := make([]bool, len(input.Keys))
+	for i, d := range data {
+		found[i] = d != nil
+	}
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
 func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
 	if err := util.CheckKey(input.Key); err != nil {
 		return err
 	}
 
-	c := s.p.Get()
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
 	defer c.Close()
 
-	keysDeleted, err := c.Do("DEL", input.Key)
+	keysDeleted, err := redis.DoContext(c, ctx, "DEL", bucketKey(input.BucketName, input.Key))
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 
 	if keysDeleted.(int64) <= 0 {
@@ -183,68 +324,891 @@ func (s Store) Delete(input types.DeleteItemInput) error {
 	return nil
 }
 
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+// BatchDeleteWithContext pipelines one DEL per key
+// to learn which of the keys did not exist.
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return types.BatchDeleteItemOutput{}, wrapErr(err)
+	}
+	defer c.Close()
+
+	for _, k := range input.Keys {
+		if err := c.Send("DEL", bucketKey(input.BucketName, k)); err != nil {
+			return types.BatchDeleteItemOutput{}, wrapErr(err)
+		}
+	}
+
+	if err := c.Flush(); err != nil {
+		return types.BatchDeleteItemOutput{}, wrapErr(err)
+	}
+
+	var missing []string
+	for _, k := range input.Keys {
+		deleted, err := redis.Int(redis.ReceiveContext(c, ctx))
+		if err != nil {
+			return types.BatchDeleteItemOutput{}, wrapErr(err)
+		}
+		if deleted == 0 {
+			missing = append(missing, k)
+		}
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
+}
+
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer c.Close()
+
+	b, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	reply, err := redis.DoContext(c, ctx, "SET", append(setArgs(bucketKey(input.BucketName, input.Key), b, input.TTL), "NX")...)
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if reply == nil {
+		return gokv.ErrConflict
+	}
+
+	return nil
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	oldData, err := s.codec.Marshal(input.OldValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer c.Close()
+
+	swapped, err := redis.Bool(compareAndSwapScript.DoContext(ctx, c, bucketKey(input.BucketName, input.Key), string(oldData), string(newData), ttlMillis(input.TTL)))
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if !swapped {
+		return gokv.ErrConflict
+	}
+
+	return nil
+}
+
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer c.Close()
+
+	deleted, err := redis.Bool(deleteIfScript.DoContext(ctx, c, bucketKey(input.BucketName, input.Key), string(data)))
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	if !deleted {
+		return gokv.ErrConflict
+	}
+
+	return nil
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext queues the ops in a MULTI/EXEC block. Ops with a
+// condition have their keys watched and read first, so that a concurrent
+// write between the check and EXEC aborts the transaction with a
+// *gokv.TxnConflictError whose Index is -1.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	for _, op := range input.Ops {
+		if err := util.CheckBucketName(op.BucketName); err != nil {
+			return err
+		}
+	}
+
+	values := make([][]byte, len(input.Ops))
+	matches := make([][]byte, len(input.Ops))
+	var watched []interface{}
+	for i, op := range input.Ops {
+		var err error
+		if op.Type == types.TxnSet {
+			if values[i], err = s.codec.Marshal(op.Value); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if matches[i], err = s.codec.Marshal(op.Match); err != nil {
+				return err
+			}
+		}
+		if op.Condition != types.TxnAlways {
+			watched = append(watched, bucketKey(op.BucketName, op.Key))
+		}
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer c.Close()
+
+	if len(watched) > 0 {
+		if _, err := redis.DoContext(c, ctx, "WATCH", watched...); err != nil {
+			return wrapErr(err)
+		}
+		for i, op := range input.Ops {
+			if op.Condition == types.TxnAlways {
+				continue
+			}
+			current, err := redis.Bytes(redis.DoContext(c, ctx, "GET", bucketKey(op.BucketName, op.Key)))
+			if err != nil && err != redis.ErrNil {
+				return wrapErr(err)
+			}
+			if !txnConditionHolds(op.Condition, current, matches[i]) {
+				if _, err := redis.DoContext(c, ctx, "UNWATCH"); err != nil {
+					return wrapErr(err)
+				}
+				return &gokv.TxnConflictError{Index: i, BucketName: op.BucketName, Key: op.Key}
+			}
+		}
+	}
+
+	if err := c.Send("MULTI"); err != nil {
+		return wrapErr(err)
+	}
+	for i, op := range input.Ops {
+		key := bucketKey(op.BucketName, op.Key)
+		switch op.Type {
+		case types.TxnSet:
+			err = c.Send("SET", setArgs(key, values[i], op.TTL)...)
+		case types.TxnDelete:
+			err = c.Send("DEL", key)
+		}
+		if err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	reply, err := redis.DoContext(c, ctx, "EXEC")
+	if err != nil {
+		return wrapErr(err)
+	}
+	if reply == nil {
+		return &gokv.TxnConflictError{Index: -1}
+	}
+	return nil
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext gives fn a ReadTx whose reads are atomic one by one:
+// a Get, a BatchGet and every page of a Scan each read all of their values
+// with a single MGET. Redis cannot hold a snapshot across commands, so
+// writes by other clients may land between two reads of fn.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(readTx{ctx: ctx, s: s})
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+// txnConditionHolds evaluates cond against the current value of an
+// item, which is nil if the item does not exist.
+func txnConditionHolds(cond types.TxnCondition, current, match []byte) bool {
+	switch cond {
+	case types.TxnAlways:
+		return true
+	case types.TxnExists:
+		return current != nil
+	case types.TxnNotExists:
+		return current == nil
+	case types.TxnMatches:
+		return current != nil && bytes.Equal(current, match)
+	}
+	return false
+}
+
+func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+// DeleteBucketWithContext removes every key of the bucket, deleting each
+// page returned by SCAN as it goes so that large buckets never have to be
+// held in memory at once. It returns ErrBucketNotFound if the bucket holds
+// no keys, as redis cannot tell an empty bucket from a missing one.
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer c.Close()
+
+	pattern := escapePattern(bucketKey(input.BucketName, "")) + "*"
+	cursor, deleted := 0, 0
+	for {
+		var keys []string
+		keys, cursor, err = s.getKeys(ctx, c, cursor, scanBatchSize, pattern)
+		if err != nil {
+			return wrapErr(err)
+		}
+
+		if len(keys) > 0 {
+			args := make([]interface{}, len(keys))
+			for i, k := range keys {
+				args[i] = k
+			}
+			n, err := redis.Int(redis.DoContext(c, ctx, "DEL", args...))
+			if err != nil {
+				return wrapErr(err)
+			}
+			deleted += n
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if deleted == 0 {
+		return gokv.ErrBucketNotFound
+	}
+
+	return nil
+}
+
 func (s Store) Close() error {
 	return s.p.Close()
 }
 
 func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
-	keys, err := s.getAllKeys()
-	if err != nil {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext walks the keys of the bucket with SCAN, issuing it until
+// the page is full as Limit is only a COUNT hint to redis. Prefix is matched
+// by redis while StartKey and EndKey are applied to the scanned keys, as SCAN
+// does not return keys in order. The keys scanned past the end of a page are
+// carried in NextToken along with the cursor, so none are skipped.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
 		return types.ScanOutput{}, err
 	}
 
-	values, err := s.getAllValues(keys)
+	bucketPrefix := bucketKey(input.BucketName, "")
+	var token scanToken
+	var done bool
+	if input.StartToken != "" {
+		var err error
+		if token, err = decodeScanToken(input.StartToken); err != nil {
+			return types.ScanOutput{}, err
+		}
+		// a cursor of 0 in a token means the iteration completed
+		done = token.Cursor == 0
+	}
+
+	var pending []string
+	for _, k := range token.Keys {
+		pending = append(pending, bucketPrefix+k)
+	}
+
+	c, err := s.p.GetContext(ctx)
 	if err != nil {
-		return types.ScanOutput{}, err
+		return types.ScanOutput{}, wrapErr(err)
+	}
+	defer c.Close()
+
+	count := scanBatchSize
+	if input.Limit > 0 {
+		count = input.Limit
+	}
+	pattern := escapePattern(bucketPrefix+input.Prefix) + "*"
+	cursor := token.Cursor
+
+	var out types.ScanOutput
+	for {
+		need := len(pending)
+		if input.Limit > 0 {
+			need = input.Limit - len(out.Keys)
+		}
+		for !done && (input.Limit <= 0 || len(pending) < need) {
+			var keys []string
+			keys, cursor, err = s.getKeys(ctx, c, cursor, count, pattern)
+			if err != nil {
+				return types.ScanOutput{}, wrapErr(err)
+			}
+			for _, k := range keys {
+				if util.InScanRange(strings.TrimPrefix(k, bucketPrefix), input.Prefix, input.StartKey, input.EndKey) {
+					pending = append(pending, k)
+				}
+			}
+			done = cursor == 0
+		}
+
+		if input.Limit <= 0 || need > len(pending) {
+			need = len(pending)
+		}
+		keys, values, err := s.getValues(ctx, c, pending[:need])
+		if err != nil {
+			return types.ScanOutput{}, wrapErr(err)
+		}
+		pending = pending[need:]
+		for i, k := range keys {
+			out.Keys = append(out.Keys, strings.TrimPrefix(k, bucketPrefix))
+			out.Values = append(out.Values, values[i])
+		}
+
+		// keys deleted since they were scanned leave room for more
+		if input.Limit <= 0 || len(out.Keys) >= input.Limit || (done && len(pending) == 0) {
+			break
+		}
 	}
 
-	return types.ScanOutput{
-		Keys:   keys,
-		Values: values,
-	}, nil
+	if !done || len(pending) > 0 {
+		next := scanToken{Cursor: cursor}
+		for _, k := range pending {
+			next.Keys = append(next.Keys, strings.TrimPrefix(k, bucketPrefix))
+		}
+		if out.NextToken, err = encodeScanToken(next); err != nil {
+			return types.ScanOutput{}, err
+		}
+	}
+
+	return out, nil
 }
 
-func (s Store) getAllValues(keys []string) ([][]byte, error) {
-	c := s.p.Get()
+// scanToken is where a scan resumes: the keys already scanned but not yet
+// returned, then the SCAN cursor.
+type scanToken struct {
+	Cursor int      `json:"c"`
+	Keys   []string `json:"k,omitempty"`
+}
 
-	var values [][]byte
-	var args []interface{}
+// encodeScanToken turns token into an opaque string.
+func encodeScanToken(token scanToken) (string, error) {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeScanToken reverses encodeScanToken.
+func decodeScanToken(s string) (scanToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return scanToken{}, util.ErrInvalidToken
+	}
+
+	var token scanToken
+	if err := json.Unmarshal(b, &token); err != nil || token.Cursor < 0 || (token.Cursor == 0 && len(token.Keys) == 0) {
+		return scanToken{}, util.ErrInvalidToken
+	}
+	return token, nil
+}
 
+// getValues fetches the values of keys, dropping the keys
+// that were deleted or expired since they were scanned.
+func (s Store) getValues(ctx context.Context, c redis.Conn, keys []string) ([]string, [][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+
+	var args []interface{}
 	for _, k := range keys {
 		args = append(args, k)
 	}
-	vals, err := redis.Values(c.Do("MGET", args...))
+	vals, err := redis.Values(redis.DoContext(c, ctx, "MGET", args...))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	for _, value := range vals {
+	var foundKeys []string
+	var values [][]byte
+	for i, value := range vals {
+		if value == nil {
+			continue
+		}
+		foundKeys = append(foundKeys, keys[i])
 		values = append(values, value.([]byte))
 	}
 
-	return values, nil
+	return foundKeys, values, nil
 }
 
-func (s Store) getAllKeys() ([]string, error) {
-	c := s.p.Get()
-
-	iter := 0
+// getKeys scans from cursor for keys matching pattern and returns them along with
+// the cursor to resume from. A limit <= 0 scans until the iteration completes.
+func (s Store) getKeys(ctx context.Context, c redis.Conn, cursor, limit int, pattern string) ([]string, int, error) {
 	var keys []string
 	for {
-		if arr, err := redis.Values(c.Do("SCAN", iter)); err != nil {
-			return nil, err
-		} else {
-			iter, _ = redis.Int(arr[0], nil)
-			keys, _ = redis.Strings(arr[1], nil)
+		args := []interface{}{cursor, "MATCH", pattern}
+		if limit > 0 {
+			args = append(args, "COUNT", limit)
+		}
+
+		arr, err := redis.Values(redis.DoContext(c, ctx, "SCAN", args...))
+		if err != nil {
+			return nil, 0, err
 		}
 
-		if iter == 0 {
+		cursor, _ = redis.Int(arr[0], nil)
+		page, _ := redis.Strings(arr[1], nil)
+		keys = append(keys, page...)
+
+		if cursor == 0 || limit > 0 {
 			break
 		}
 	}
-	return keys, nil
+	return keys, cursor, nil
 }
 
 func (s Store) Info() (types.StoreInfo, error) {
-	return types.StoreInfo{}, ErrNotImplemented
+	return s.InfoWithContext(context.Background())
+}
+
+// InfoWithContext reports the number of keys in the database and, where
+// the server allows the INFO command, its version and memory usage. The
+// buckets are counted by walking the whole keyspace with SCAN.
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return types.StoreInfo{}, wrapErr(err)
+	}
+	defer c.Close()
+
+	info := types.StoreInfo{Name: s.address}
+	if info.Items, err = redis.Int64(redis.DoContext(c, ctx, "DBSIZE")); err != nil {
+		return types.StoreInfo{}, wrapErr(err)
+	}
+
+	// managed offerings and redis compatible servers may reject INFO
+	raw, err := redis.String(redis.DoContext(c, ctx, "INFO"))
+	if _, ok := err.(redis.Error); !ok && err != nil {
+		return types.StoreInfo{}, wrapErr(err)
+	} else if err == nil {
+		fields := parseInfo(raw)
+		info.Version = fields["redis_version"]
+		used, _ := strconv.ParseInt(fields["used_memory"], 10, 64)
+		max, _ := strconv.ParseInt(fields["maxmemory"], 10, 64)
+		info.Size, info.UsedBytes = used, used
+		if max > used {
+			info.FreeBytes = max - used
+		}
+	}
+
+	if info.Buckets, err = s.listBuckets(ctx, c); err != nil {
+		return types.StoreInfo{}, wrapErr(err)
+	}
+
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext finds the buckets by walking the whole keyspace
+// with SCAN. Only the number of keys of a bucket is reported.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer c.Close()
+
+	buckets, err := s.listBuckets(ctx, c)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return buckets, nil
+}
+
+func (s Store) listBuckets(ctx context.Context, c redis.Conn) ([]types.BucketInfo, error) {
+	counts := make(map[string]int64)
+	err := s.walkKeys(ctx, c, "[1-9]*"+escapePattern(bucketSeparator)+"*", func(keys []string) {
+		for _, k := range keys {
+			if bucketName, _, ok := splitBucketKey(k); ok {
+				counts[bucketName]++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []types.BucketInfo
+	for name, n := range counts {
+		buckets = append(buckets, types.BucketInfo{Name: name, Items: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets, nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+// BucketInfoWithContext counts the keys of the bucket with SCAN. It returns
+// ErrBucketNotFound if the bucket holds no keys, like DeleteBucket.
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+	defer c.Close()
+
+	info := types.BucketInfo{Name: input.BucketName}
+	err = s.walkKeys(ctx, c, escapePattern(bucketKey(input.BucketName, ""))+"*", func(keys []string) {
+		info.Items += int64(len(keys))
+	})
+	if err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+
+	if info.Items == 0 {
+		return types.BucketInfo{}, gokv.ErrBucketNotFound
+	}
+	return info, nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	defer c.Close()
+
+	exists, err := redis.Bool(redis.DoContext(c, ctx, "EXISTS", bucketKey(input.BucketName, input.Key)))
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return exists, nil
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+// CountWithContext counts the keys of the bucket with SCAN,
+// as redis keeps no per prefix statistics.
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	defer c.Close()
+
+	var n int64
+	err = s.walkKeys(ctx, c, escapePattern(bucketKey(input.BucketName, ""))+"*", func(keys []string) {
+		n += int64(len(keys))
+	})
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext uses INCRBY, which stores the counter as decimal
+// text regardless of the codec of the store and keeps its expiration time.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	c, err := s.p.GetContext(ctx)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	defer c.Close()
+
+	n, err := redis.Int64(redis.DoContext(c, ctx, "INCRBY", bucketKey(input.BucketName, input.Key), input.Delta))
+	if err != nil {
+		return 0, counterErr(err)
+	}
+	return n, nil
+}
+
+// counterErr maps the errors INCRBY returns for a value that is not a
+// counter, or would overflow, onto those of the other stores.
+func counterErr(err error) error {
+	if redisErr, ok := err.(redis.Error); ok {
+		switch msg := string(redisErr); {
+		case strings.HasPrefix(msg, "ERR value is not an integer"):
+			return util.ErrNotCounter
+		case strings.HasPrefix(msg, "ERR increment or decrement would overflow"):
+			return util.ErrCounterOverflow
+		}
+	}
+	return wrapErr(err)
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+// walkKeys scans the whole keyspace for keys matching pattern,
+// handing every page of keys to fn.
+func (s Store) walkKeys(ctx context.Context, c redis.Conn, pattern string, fn func(keys []string)) error {
+	for cursor := 0; ; {
+		keys, next, err := s.getKeys(ctx, c, cursor, scanBatchSize, pattern)
+		if err != nil {
+			return err
+		}
+		fn(keys)
+
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// parseInfo parses the "field:value" lines of an INFO reply.
+func parseInfo(raw string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
+// bucketKey returns the redis key holding key in bucketName, which is
+// "<length of bucketName>:<bucketName>:<key>". The length keeps the keys
+// of a bucket from sharing a prefix with those of any other bucket, even
+// when bucket names or keys contain the separator.
+func bucketKey(bucketName, key string) string {
+	return strconv.Itoa(len(bucketName)) + bucketSeparator + bucketName + bucketSeparator + key
+}
+
+// splitBucketKey returns the bucket name and the key that bucketKey
+// joined into k, reporting false for keys written some other way.
+func splitBucketKey(k string) (string, string, bool) {
+	i := strings.Index(k, bucketSeparator)
+	if i <= 0 || k[0] == '0' {
+		return "", "", false
+	}
+	n, err := strconv.Atoi(k[:i])
+	if err != nil || n <= 0 {
+		return "", "", false
+	}
+
+	k = k[i+1:]
+	if len(k) <= n || k[n:n+1] != bucketSeparator {
+		return "", "", false
+	}
+	return k[:n], k[n+1:], true
+}
+
+// escapePattern escapes the glob special characters of s
+// so it can be used literally in a MATCH pattern.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// setArgs builds the arguments of a SET command,
+// asking redis to expire the key when ttl > 0.
+func setArgs(key string, value []byte, ttl time.Duration) []interface{} {
+	args := []interface{}{key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", ttlMillis(ttl))
+	}
+	return args
+}
+
+// ttlMillis converts ttl to milliseconds, rounding positive
+// durations up to at least 1 as redis rejects an expiry of zero.
+func ttlMillis(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	ms := int64(ttl / time.Millisecond)
+	if ms == 0 {
+		ms = 1
+	}
+	return ms
+}
+
+// wrapErr maps connection and server errors returned by redigo
+// onto their gokv equivalents.
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == redis.ErrPoolExhausted || err == io.EOF {
+		return gokv.Wrap(gokv.ErrUnavailable, err)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return gokv.Wrap(gokv.ErrUnavailable, err)
+	}
+
+	if redisErr, ok := err.(redis.Error); ok {
+		switch msg := string(redisErr); {
+		case strings.HasPrefix(msg, "LOADING"),
+			strings.HasPrefix(msg, "BUSY"),
+			strings.HasPrefix(msg, "MASTERDOWN"),
+			strings.HasPrefix(msg, "TRYAGAIN"):
+			return gokv.Wrap(gokv.ErrUnavailable, err)
+		case strings.HasPrefix(msg, "ERR max number of clients reached"):
+			return gokv.Wrap(gokv.ErrThrottled, err)
+		}
+	}
+	return err
 }
@@ -39,8 +39,9 @@ func benchmarkSet(j int, b *testing.B) {
 			wg.Add(1)
 			go func(i int) {
 				assert.NoError(b, s.Set(types.SetItemInput{
-					Key:   fmt.Sprintf("foo%d", i),
-					Value: "bar",
+					BucketName: "testing",
+					Key:        fmt.Sprintf("foo%d", i),
+					Value:      "bar",
 				}))
 				wg.Done()
 			}(i)
@@ -71,8 +72,9 @@ func benchmarkBatchSet(j int, b *testing.B) {
 			wg.Add(1)
 			go func(i int) {
 				assert.NoError(b, s.BatchSet(types.BatchSetItemInput{
-					Keys:   []string{fmt.Sprintf("foo%d", i)},
-					Values: []string{fmt.Sprintf("bar%d", i)},
+					BucketName: "testing",
+					Keys:       []string{fmt.Sprintf("foo%d", i)},
+					Values:     []string{fmt.Sprintf("bar%d", i)},
 				}))
 				wg.Done()
 			}(i)
@@ -1,14 +1,19 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/simar7/gokv"
 	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,12 +40,30 @@ func TestNewStore(t *testing.T) {
 		assert.Equal(t, 80, s.p.MaxIdle)
 	})
 
+	t.Run("happy path, database selected", func(t *testing.T) {
+		mr, err := miniredis.Run()
+		assert.NoError(t, err)
+		defer mr.Close()
+
+		s, err := NewStore(Options{
+			Address: mr.Addr(),
+			DB:      3,
+		})
+		assert.NoError(t, err)
+		defer s.Close()
+
+		assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+		assert.True(t, mr.DB(3).Exists(bucketKey("testing", "foo")))
+		assert.False(t, mr.Exists(bucketKey("testing", "foo")))
+	})
+
 	t.Run("sad path, ping fails", func(t *testing.T) {
 		s, err := NewStore(Options{
 			Address: "path/to/nowhere:1234",
 		})
 
 		assert.Contains(t, err.Error(), "redis initialization failed: dial tcp: lookup path/to/nowhere")
+		assert.True(t, errors.Is(err, gokv.ErrUnavailable))
 		assert.Equal(t, Store{}, s)
 	})
 }
@@ -64,7 +87,6 @@ func TestStore_Get(t *testing.T) {
 		},
 		{
 			name:          "happy path, key not found",
-			expectedError: ErrKeyNotFound,
 			expectedValue: testStruct{},
 		},
 		{
@@ -83,14 +105,14 @@ func TestStore_Get(t *testing.T) {
 
 		if tc.inStore {
 			if tc.badMarshal {
-				_ = mr.Set("foo", "fubar")
+				_ = mr.Set(bucketKey("testing", "foo"), "fubar")
 			} else {
 				b, _ := json.Marshal(testStruct{
 					Foo: "foo",
 					Bar: 42.0,
 					Baz: 123,
 				})
-				_ = mr.Set("foo", string(b))
+				_ = mr.Set(bucketKey("testing", "foo"), string(b))
 			}
 		}
 
@@ -102,8 +124,9 @@ func TestStore_Get(t *testing.T) {
 
 		var actualValue testStruct
 		found, err := s.Get(types.GetItemInput{
-			Key:   "foo",
-			Value: &actualValue,
+			BucketName: "testing",
+			Key:        "foo",
+			Value:      &actualValue,
 		})
 
 		switch {
@@ -111,7 +134,7 @@ func TestStore_Get(t *testing.T) {
 			assert.Equal(t, tc.expectedError.Error(), err.Error(), tc.name)
 		default:
 			assert.NoError(t, err, tc.name)
-			assert.True(t, found, tc.name)
+			assert.Equal(t, tc.inStore, found, tc.name)
 		}
 
 		assert.Equal(t, tc.expectedValue, actualValue, tc.name)
@@ -130,7 +153,8 @@ func TestStore_Set(t *testing.T) {
 	defer s.Close()
 
 	assert.NoError(t, s.Set(types.SetItemInput{
-		Key: "foo",
+		BucketName: "testing",
+		Key:        "foo",
 		Value: testStruct{
 			Foo: "foo",
 			Bar: 42.0,
@@ -140,12 +164,44 @@ func TestStore_Set(t *testing.T) {
 
 	// check if the key was actually set
 	var actualValue testStruct
-	found, err := s.Get(types.GetItemInput{Key: "foo", Value: &actualValue})
+	found, err := s.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &actualValue})
 	assert.True(t, found)
 	assert.NoError(t, err)
 	assert.Equal(t, testStruct{Foo: "foo", Bar: 42.0, Baz: 123}, actualValue)
 }
 
+func TestStore_Set_TTL(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar", TTL: time.Minute}))
+	assert.Equal(t, time.Minute, mr.TTL(bucketKey("testing", "foo")))
+
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
+		BucketName: "testing",
+		Keys:       []string{"key1", "key2"},
+		Values:     []string{"val1", "val2"},
+		TTL:        time.Second,
+	}))
+	assert.Equal(t, time.Second, mr.TTL(bucketKey("testing", "key1")))
+	assert.Equal(t, time.Second, mr.TTL(bucketKey("testing", "key2")))
+
+	mr.FastForward(time.Minute)
+
+	var actualValue string
+	found, err := s.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &actualValue})
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, actualValue)
+}
+
 func TestStore_Delete(t *testing.T) {
 	t.Run("happy path, key to delete exists in redis", func(t *testing.T) {
 		mr, err := miniredis.Run()
@@ -157,7 +213,7 @@ func TestStore_Delete(t *testing.T) {
 			Bar: 42.0,
 			Baz: 123,
 		})
-		_ = mr.Set("foo", string(b))
+		_ = mr.Set(bucketKey("testing", "foo"), string(b))
 
 		s, err := NewStore(Options{
 			Address: mr.Addr(),
@@ -165,7 +221,7 @@ func TestStore_Delete(t *testing.T) {
 		assert.NoError(t, err)
 		defer s.Close()
 
-		assert.NoError(t, s.Delete(types.DeleteItemInput{Key: "foo"}))
+		assert.NoError(t, s.Delete(types.DeleteItemInput{BucketName: "testing", Key: "foo"}))
 	})
 
 	t.Run("sad path, key to delete does not exist", func(t *testing.T) {
@@ -179,7 +235,9 @@ func TestStore_Delete(t *testing.T) {
 		assert.NoError(t, err)
 		defer s.Close()
 
-		assert.Equal(t, ErrKeyNotFound, s.Delete(types.DeleteItemInput{Key: "foo"}))
+		err = s.Delete(types.DeleteItemInput{BucketName: "testing", Key: "foo"})
+		assert.Equal(t, ErrKeyNotFound, err)
+		assert.True(t, errors.Is(err, gokv.ErrNotFound))
 	})
 }
 
@@ -195,14 +253,15 @@ func TestStore_BatchSet(t *testing.T) {
 	defer s.Close()
 
 	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
-		Keys:   []string{"key1", "key2", "key3"},
-		Values: []string{"val1", "val2", "val3"},
+		BucketName: "testing",
+		Keys:       []string{"key1", "key2", "key3"},
+		Values:     []string{"val1", "val2", "val3"},
 	}))
 
 	// check if the keys were actually set
 	for i := 1; i <= 3; i++ {
 		var actualValue string
-		found, err := s.Get(types.GetItemInput{Key: fmt.Sprintf("key%d", i), Value: &actualValue})
+		found, err := s.Get(types.GetItemInput{BucketName: "testing", Key: fmt.Sprintf("key%d", i), Value: &actualValue})
 		assert.True(t, found)
 		assert.NoError(t, err)
 		assert.Equal(t, fmt.Sprintf("val%d", i), actualValue)
@@ -224,11 +283,12 @@ func TestStore_Scan(t *testing.T) {
 	expectedValues := []string{"val1", "", "val3"}
 
 	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{
-		Keys:   expectedKeys,
-		Values: expectedValues,
+		BucketName: "foo",
+		Keys:       expectedKeys,
+		Values:     expectedValues,
 	}))
 
-	out, err := s.Scan(types.ScanInput{})
+	out, err := s.Scan(types.ScanInput{BucketName: "foo"})
 	assert.NoError(t, err)
 
 	assert.Equal(t, []string{"key1", "key2", "key3"}, out.Keys)
@@ -236,3 +296,471 @@ func TestStore_Scan(t *testing.T) {
 		assert.Equal(t, fmt.Sprintf(`"%s"`, expectedValues[i]), string(v))
 	}
 }
+
+func TestStore_WithContext(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	t.Run("happy path", func(t *testing.T) {
+		assert.NoError(t, s.SetWithContext(context.Background(), types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+
+		var actualValue string
+		found, err := s.GetWithContext(context.Background(), types.GetItemInput{BucketName: "testing", Key: "foo", Value: &actualValue})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "bar", actualValue)
+	})
+
+	t.Run("sad path, context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.Error(t, s.SetWithContext(ctx, types.SetItemInput{BucketName: "testing", Key: "foo", Value: "baz"}))
+
+		out, err := s.ScanWithContext(ctx, types.ScanInput{BucketName: "testing"})
+		assert.Error(t, err)
+		assert.Empty(t, out)
+	})
+}
+
+func TestStore_ConditionalWrites(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	// set if not exists
+	assert.NoError(t, s.SetIfNotExists(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "bar", TTL: time.Minute}))
+	assert.Equal(t, time.Minute, mr.TTL(bucketKey("testing", "foo")))
+	assert.Equal(t, gokv.ErrConflict, s.SetIfNotExists(types.SetItemInput{BucketName: "testing", Key: "foo", Value: "baz"}))
+
+	// compare and swap
+	assert.Equal(t, gokv.ErrConflict, s.CompareAndSwap(types.CompareAndSwapInput{BucketName: "testing", Key: "foo", OldValue: "baz", NewValue: "qux"}))
+	assert.NoError(t, s.CompareAndSwap(types.CompareAndSwapInput{BucketName: "testing", Key: "foo", OldValue: "bar", NewValue: "qux"}))
+	assert.Equal(t, gokv.ErrConflict, s.CompareAndSwap(types.CompareAndSwapInput{BucketName: "testing", Key: "missing", OldValue: "bar", NewValue: "qux"}))
+
+	var actualValue string
+	found, err := s.Get(types.GetItemInput{BucketName: "testing", Key: "foo", Value: &actualValue})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "qux", actualValue)
+
+	// delete if
+	assert.Equal(t, gokv.ErrConflict, s.DeleteIf(types.DeleteIfInput{BucketName: "testing", Key: "foo", Value: "bar"}))
+	assert.NoError(t, s.DeleteIf(types.DeleteIfInput{BucketName: "testing", Key: "foo", Value: "qux"}))
+	assert.False(t, mr.Exists(bucketKey("testing", "foo")))
+}
+
+func TestStore_Scan_Paginated(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	var expectedKeys []string
+	for i := 0; i < 25; i++ {
+		k := fmt.Sprintf("key%02d", i)
+		expectedKeys = append(expectedKeys, k)
+		_ = mr.Set(bucketKey("foo", k), fmt.Sprintf(`"val%d"`, i))
+	}
+	_ = mr.Set(bucketKey("bar", "key00"), `"val"`)
+
+	// miniredis ignores the COUNT hint and returns every key at once,
+	// so the pages have to be cut to Limit
+	var keys []string
+	input := types.ScanInput{BucketName: "foo", Limit: 4}
+	for {
+		out, err := s.Scan(input)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(out.Keys), input.Limit)
+		assert.Equal(t, len(out.Keys), len(out.Values))
+		keys = append(keys, out.Keys...)
+		if out.NextToken == "" {
+			break
+		}
+		input.StartToken = out.NextToken
+	}
+	assert.Equal(t, expectedKeys, keys)
+
+	t.Run("keys deleted between pages", func(t *testing.T) {
+		out, err := s.Scan(types.ScanInput{BucketName: "foo", Limit: 4})
+		assert.NoError(t, err)
+		assert.Equal(t, expectedKeys[:4], out.Keys)
+
+		mr.Del(bucketKey("foo", "key04"))
+		mr.Del(bucketKey("foo", "key05"))
+		out, err = s.Scan(types.ScanInput{BucketName: "foo", Limit: 4, StartToken: out.NextToken})
+		assert.NoError(t, err)
+		assert.Equal(t, expectedKeys[6:10], out.Keys)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		for _, token := range []string{"foo", "1", "e30"} {
+			_, err := s.Scan(types.ScanInput{BucketName: "foo", StartToken: token})
+			assert.Equal(t, util.ErrInvalidToken, err, token)
+		}
+	})
+
+	t.Run("empty bucket name", func(t *testing.T) {
+		_, err := s.Scan(types.ScanInput{})
+		assert.Equal(t, util.ErrEmptyBucketName, err)
+	})
+}
+
+func TestStore_Scan_Range(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	for _, k := range []string{"tenant/1/obj/a", "tenant/1/obj/b", "tenant/1*/obj/c", "tenant/2/obj/a"} {
+		_ = mr.Set(bucketKey("foo", k), `"bar"`)
+	}
+
+	out, err := s.Scan(types.ScanInput{BucketName: "foo", Prefix: "tenant/1/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant/1/obj/a", "tenant/1/obj/b"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", Prefix: "tenant/1*"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant/1*/obj/c"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartKey: "tenant/1/obj/b", EndKey: "tenant/2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant/1/obj/b"}, out.Keys)
+}
+
+func TestStore_BatchGet(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	_ = mr.Set(bucketKey("testing", "foo"), `"bar"`)
+	_ = mr.Set(bucketKey("testing", "faz"), `"baz"`)
+
+	var values []string
+	out, err := s.BatchGet(types.BatchGetItemInput{
+		BucketName: "testing",
+		Keys:       []string{"foo", "missing", "faz"},
+		Values:     &values,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, out.Found)
+	assert.Equal(t, []string{"bar", "", "baz"}, values)
+
+	mapValues := map[string]string{}
+	_, err = s.BatchGet(types.BatchGetItemInput{
+		BucketName: "testing",
+		Keys:       []string{"foo", "missing"},
+		Values:     mapValues,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar"}, mapValues)
+}
+
+func TestStore_BatchDelete(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	_ = mr.Set(bucketKey("testing", "foo"), `"bar"`)
+	_ = mr.Set(bucketKey("testing", "faz"), `"baz"`)
+
+	out, err := s.BatchDelete(types.BatchDeleteItemInput{BucketName: "testing", Keys: []string{"foo", "missing", "faz"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing"}, out.Missing)
+	assert.False(t, mr.Exists(bucketKey("testing", "foo")))
+	assert.False(t, mr.Exists(bucketKey("testing", "faz")))
+}
+
+func TestStore_Buckets(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "key", Value: "foo"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "key", Value: "bar"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "other", Value: "bar"}))
+
+	t.Run("happy path, same key in different buckets", func(t *testing.T) {
+		var v string
+		found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "key", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "foo", v)
+
+		found, err = s.Get(types.GetItemInput{BucketName: "bar", Key: "key", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "bar", v)
+	})
+
+	t.Run("happy path, scan lists only the bucket", func(t *testing.T) {
+		out, err := s.Scan(types.ScanInput{BucketName: "bar"})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"key", "other"}, out.Keys)
+	})
+
+	t.Run("happy path, delete bucket", func(t *testing.T) {
+		for i := 0; i < 2500; i++ {
+			mr.Set(bucketKey("big", fmt.Sprintf("key%d", i)), `"val"`)
+		}
+
+		assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "big"}))
+		assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "bar"}))
+
+		out, err := s.Scan(types.ScanInput{BucketName: "big"})
+		assert.NoError(t, err)
+		assert.Empty(t, out.Keys)
+
+		var v string
+		found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "key", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("sad path, delete missing bucket", func(t *testing.T) {
+		assert.Equal(t, gokv.ErrBucketNotFound, s.DeleteBucket(types.DeleteBucketInput{BucketName: "missing"}))
+	})
+
+	t.Run("sad path, empty bucket name", func(t *testing.T) {
+		assert.Equal(t, util.ErrEmptyBucketName, s.DeleteBucket(types.DeleteBucketInput{}))
+	})
+}
+
+func TestStore_Buckets_Separator(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "a", Key: "b:c", Value: "a"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "a:b", Key: "c", Value: "a:b"}))
+
+	t.Run("happy path, keys do not collide", func(t *testing.T) {
+		var v string
+		found, err := s.Get(types.GetItemInput{BucketName: "a", Key: "b:c", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "a", v)
+
+		found, err = s.Get(types.GetItemInput{BucketName: "a:b", Key: "c", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "a:b", v)
+	})
+
+	t.Run("happy path, scan and count read only the bucket", func(t *testing.T) {
+		out, err := s.Scan(types.ScanInput{BucketName: "a"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b:c"}, out.Keys)
+
+		n, err := s.Count(types.CountInput{BucketName: "a"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("happy path, list buckets", func(t *testing.T) {
+		// keys written outside of gokv belong to no bucket
+		for _, k := range []string{"a:b", "0::x", "x:y", "9:short:x", "01:a:x"} {
+			_ = mr.Set(k, `"val"`)
+		}
+
+		buckets, err := s.ListBuckets()
+		assert.NoError(t, err)
+		assert.Equal(t, []types.BucketInfo{
+			{Name: "a", Items: 1},
+			{Name: "a:b", Items: 1},
+		}, buckets)
+	})
+
+	t.Run("happy path, delete bucket", func(t *testing.T) {
+		assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "a"}))
+
+		var v string
+		found, err := s.Get(types.GetItemInput{BucketName: "a:b", Key: "c", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("sad path, empty bucket name", func(t *testing.T) {
+		assert.Equal(t, util.ErrEmptyBucketName, s.Set(types.SetItemInput{Key: "foo", Value: "bar"}))
+
+		var v string
+		_, err := s.Get(types.GetItemInput{Key: "foo", Value: &v})
+		assert.Equal(t, util.ErrEmptyBucketName, err)
+
+		assert.Equal(t, util.ErrEmptyBucketName, s.Delete(types.DeleteItemInput{Key: "foo"}))
+
+		err = s.Txn(types.TxnInput{Ops: []types.TxnOp{{Type: types.TxnSet, Key: "foo", Value: "bar"}}})
+		assert.Equal(t, util.ErrEmptyBucketName, err)
+	})
+}
+
+func TestStore_Increment(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	t.Run("happy path", func(t *testing.T) {
+		_ = mr.Set(bucketKey("foo", "counter"), "5")
+		mr.SetTTL(bucketKey("foo", "counter"), time.Hour)
+
+		n, err := s.Increment(types.IncrementInput{BucketName: "foo", Key: "counter", Delta: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), n)
+
+		v, _ := mr.Get(bucketKey("foo", "counter"))
+		assert.Equal(t, "7", v)
+		assert.Equal(t, time.Hour, mr.TTL(bucketKey("foo", "counter")))
+	})
+
+	t.Run("sad path, not a counter", func(t *testing.T) {
+		_ = mr.Set(bucketKey("foo", "val"), `"val"`)
+		_, err := s.Increment(types.IncrementInput{BucketName: "foo", Key: "val", Delta: 1})
+		assert.Equal(t, util.ErrNotCounter, err)
+	})
+
+	t.Run("sad path, overflow", func(t *testing.T) {
+		// miniredis does not check for overflows, which redis reports as
+		assert.Equal(t, util.ErrCounterOverflow, counterErr(redis.Error("ERR increment or decrement would overflow")))
+	})
+
+	t.Run("sad path, empty bucket name", func(t *testing.T) {
+		_, err := s.Increment(types.IncrementInput{Key: "counter", Delta: 1})
+		assert.Equal(t, util.ErrEmptyBucketName, err)
+	})
+}
+
+func TestStore_ExistsAndCount(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "expired", Value: "val", TTL: time.Second}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "live", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "forever", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foobar", Key: "other", Value: "val"}))
+	mr.FastForward(2 * time.Second)
+
+	exists, err := s.Exists(types.ExistsInput{BucketName: "foo", Key: "expired"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = s.Exists(types.ExistsInput{BucketName: "foo", Key: "live"})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// the keys of other buckets sharing the prefix are not counted
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	exists, err = s.Exists(types.ExistsInput{BucketName: "missing", Key: "live"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	n, err = s.Count(types.CountInput{BucketName: "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	_, err = s.Exists(types.ExistsInput{BucketName: "foo"})
+	assert.Equal(t, util.ErrEmptyKey, err)
+
+	_, err = s.Count(types.CountInput{})
+	assert.Equal(t, util.ErrEmptyBucketName, err)
+}
+
+func TestStore_Info(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: []string{"a", "b"}, Values: []string{"val", "val"}}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "a", Value: "val"}))
+	// keys written outside of gokv are counted, but belong to no bucket
+	_ = mr.Set("nobucket", `"val"`)
+
+	// miniredis does not implement INFO, so only the key counts are known
+	info, err := s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, mr.Addr(), info.Name)
+	assert.Equal(t, int64(4), info.Items)
+	assert.Equal(t, []types.BucketInfo{
+		{Name: "bar", Items: 1},
+		{Name: "foo", Items: 2},
+	}, info.Buckets)
+}
+
+func TestParseInfo(t *testing.T) {
+	raw := "# Server\r\nredis_version:5.0.7\r\nredis_mode:standalone\r\n\r\n# Memory\r\nused_memory:1024\r\nmaxmemory:0\r\n"
+	assert.Equal(t, map[string]string{
+		"redis_version": "5.0.7",
+		"redis_mode":    "standalone",
+		"used_memory":   "1024",
+		"maxmemory":     "0",
+	}, parseInfo(raw))
+}
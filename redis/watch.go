@@ -0,0 +1,120 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+)
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext subscribes to the keyspace notifications of the bucket,
+// which the server only sends once they are enabled, for example with
+// "CONFIG SET notify-keyspace-events Kgx$". Notifications are not stored,
+// so changes made while no watch is subscribed are lost and StartToken is
+// not supported.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return nil, nil, err
+	}
+
+	if input.StartToken != "" {
+		return nil, nil, gokv.ErrNotSupported
+	}
+
+	// a subscribed connection cannot serve other commands, so it is dialed
+	// rather than taken from the pool
+	c, err := s.p.DialContext(ctx)
+	if err != nil {
+		return nil, nil, wrapErr(err)
+	}
+
+	psc := redis.PubSubConn{Conn: c}
+	channelPrefix := s.keyspaceChannelPrefix()
+	bucketPrefix := bucketKey(input.BucketName, "")
+	pattern := channelPrefix + escapePattern(bucketPrefix+input.Prefix) + "*"
+	if err := psc.PSubscribe(pattern); err != nil {
+		_ = psc.Close()
+		return nil, nil, wrapErr(err)
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			// the reply to PUNSUBSCRIBE ends the receive loop
+			_ = psc.PUnsubscribe()
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	events := make(chan types.Event)
+	go func() {
+		defer close(events)
+		defer psc.Close()
+
+		for {
+			switch msg := psc.Receive().(type) {
+			case error:
+				return
+			case redis.Subscription:
+				if msg.Kind == "punsubscribe" && msg.Count == 0 {
+					return
+				}
+			case redis.Message:
+				typ, ok := keyspaceEventType(string(msg.Data))
+				if !ok {
+					continue
+				}
+				ev := types.Event{
+					Type:       typ,
+					BucketName: input.BucketName,
+					Key:        strings.TrimPrefix(strings.TrimPrefix(msg.Channel, channelPrefix), bucketPrefix),
+				}
+				select {
+				case events <- ev:
+				case <-done:
+					// keep receiving until the unsubscribe is confirmed
+				}
+			}
+		}
+	}()
+
+	return events, cancel, nil
+}
+
+// keyspaceChannelPrefix returns the prefix of the channels redis publishes
+// the keyspace notifications of the database of the store on.
+func (s Store) keyspaceChannelPrefix() string {
+	return "__keyspace@" + strconv.Itoa(s.db) + "__:"
+}
+
+// keyspaceEventType maps the name of a keyspace notification onto the
+// event it reports. Notifications that do not change the value of a key,
+// such as "expire" setting a TTL, are skipped.
+func keyspaceEventType(name string) (types.EventType, bool) {
+	switch name {
+	case "set", "incrby", "incrbyfloat", "append", "setrange", "rename_to", "restore":
+		return types.EventPut, true
+	case "del", "rename_from", "evicted":
+		return types.EventDelete, true
+	case "expired":
+		return types.EventExpire, true
+	}
+	return 0, false
+}
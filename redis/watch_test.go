@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Watch(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+		DB:      2,
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: "foo", Prefix: "a"})
+	assert.NoError(t, err)
+	for mr.PubSubNumPat() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// miniredis sends no keyspace notifications, so publish them by hand
+	mr.Publish("__keyspace@2__:"+bucketKey("foo", "a1"), "set")
+	mr.Publish("__keyspace@2__:"+bucketKey("foo", "a1"), "expire")
+	mr.Publish("__keyspace@2__:"+bucketKey("foo", "a1"), "expired")
+	// the keys of a bucket whose name starts with that of the watched one are not reported
+	mr.Publish("__keyspace@2__:"+bucketKey("foo:a", "1"), "set")
+	// nor are the keys of other databases
+	mr.Publish("__keyspace@0__:"+bucketKey("foo", "a1"), "del")
+	mr.Publish("__keyspace@2__:"+bucketKey("foo", "a2"), "del")
+
+	for _, expected := range []types.Event{
+		{Type: types.EventPut, BucketName: "foo", Key: "a1"},
+		{Type: types.EventExpire, BucketName: "foo", Key: "a1"},
+		{Type: types.EventDelete, BucketName: "foo", Key: "a2"},
+	} {
+		select {
+		case ev := <-events:
+			assert.Equal(t, expected, ev)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+
+	_, _, err = s.Watch(types.WatchInput{BucketName: "foo", StartToken: "1"})
+	assert.Equal(t, gokv.ErrNotSupported, err)
+}
+
+func TestStore_Watch_Context(t *testing.T) {
+	mr, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer mr.Close()
+
+	s, err := NewStore(Options{
+		Address: mr.Addr(),
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _, err := s.WatchWithContext(ctx, types.WatchInput{BucketName: "foo"})
+	assert.NoError(t, err)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("events not closed")
+	}
+}
@@ -0,0 +1,71 @@
+package gokv
+
+import "github.com/simar7/gokv/types"
+
+// ScanIterator walks every page of a scan, fetching
+// the next page from the store only when it is needed.
+//
+//	it := gokv.NewScanIterator(store, types.ScanInput{BucketName: "foo", Limit: 100})
+//	for it.Next() {
+//		fmt.Println(it.Key(), it.Value())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ScanIterator struct {
+	store Store
+	input types.ScanInput
+	page  types.ScanOutput
+	i     int
+	done  bool
+	err   error
+}
+
+func NewScanIterator(store Store, input types.ScanInput) *ScanIterator {
+	return &ScanIterator{
+		store: store,
+		input: input,
+		i:     -1,
+	}
+}
+
+// Next advances the iterator and reports whether an item is available.
+func (it *ScanIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.i++
+	for it.i >= len(it.page.Keys) {
+		if it.done {
+			return false
+		}
+
+		page, err := it.store.Scan(it.input)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.page = page
+		it.i = 0
+		it.input.StartToken = page.NextToken
+		it.done = page.NextToken == ""
+	}
+	return true
+}
+
+// Key returns the key of the current item.
+func (it *ScanIterator) Key() string {
+	return it.page.Keys[it.i]
+}
+
+// Value returns the raw value of the current item.
+func (it *ScanIterator) Value() []byte {
+	return it.page.Values[it.i]
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,67 @@
+package gokv
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/simar7/gokv/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// pagedStore serves its keys in pages of at most one item per
+// call, with an empty page in between to mimic redis SCAN.
+type pagedStore struct {
+	Store
+	keys  []string
+	calls int
+	err   error
+}
+
+func (ps *pagedStore) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	ps.calls++
+	if ps.err != nil {
+		return types.ScanOutput{}, ps.err
+	}
+
+	pos := 0
+	if input.StartToken != "" {
+		pos, _ = strconv.Atoi(input.StartToken)
+	}
+
+	var out types.ScanOutput
+	if pos%2 == 0 {
+		i := pos / 2
+		out.Keys = []string{ps.keys[i]}
+		out.Values = [][]byte{[]byte("val" + ps.keys[i])}
+	}
+	if pos+1 < 2*len(ps.keys)-1 {
+		out.NextToken = strconv.Itoa(pos + 1)
+	}
+	return out, nil
+}
+
+func TestScanIterator(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		ps := &pagedStore{keys: []string{"foo", "bar", "baz"}}
+		it := NewScanIterator(ps, types.ScanInput{BucketName: "scanbucket", Limit: 1})
+
+		var keys []string
+		for it.Next() {
+			keys = append(keys, it.Key())
+			assert.Equal(t, "val"+it.Key(), string(it.Value()))
+		}
+		assert.NoError(t, it.Err())
+		assert.Equal(t, []string{"foo", "bar", "baz"}, keys)
+		assert.Equal(t, 5, ps.calls)
+		assert.False(t, it.Next())
+	})
+
+	t.Run("sad path, scan fails", func(t *testing.T) {
+		ps := &pagedStore{err: errors.New("scan failed")}
+		it := NewScanIterator(ps, types.ScanInput{BucketName: "scanbucket"})
+
+		assert.False(t, it.Next())
+		assert.Equal(t, ps.err, it.Err())
+	})
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "SQLite_TestConformance-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var n int
+	newStore := func(t *testing.T) gokv.Store {
+		n++
+		s, err := NewStore(Options{Path: filepath.Join(dir, strconv.Itoa(n)+".sqlite")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	storetest.Run(t, newStore)
+	storetest.RunWatch(t, newStore)
+}
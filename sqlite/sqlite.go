@@ -0,0 +1,1393 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	modernc "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// liveCond restricts a query to the items that have not expired by the
+// time bound to the parameter named by its verb.
+const liveCond = "(expires_at IS NULL OR expires_at > ?%d)"
+
+type Options struct {
+	Path string
+	// TablePrefix is prepended to the name of a bucket to name its table.
+	TablePrefix string
+	Codec       encoding.Codec
+	// BusyTimeout is how long a connection opened for Path waits for
+	// another process to release a lock on the database.
+	BusyTimeout time.Duration
+}
+
+var DefaultOptions = Options{
+	Path:        "gokv.sqlite",
+	TablePrefix: "gokv_",
+	Codec:       encoding.JSON,
+	BusyTimeout: 5 * time.Second,
+}
+
+// Store keeps every bucket in a table named by TablePrefix and the bucket
+// name, which can be queried with SQL:
+//
+//	CREATE TABLE "gokv_<bucket>" (
+//		key        TEXT PRIMARY KEY,
+//		value      BLOB NOT NULL,
+//		expires_at INTEGER -- Unix time in nanoseconds, NULL if the item never expires
+//	) WITHOUT ROWID
+//
+// Values are stored as encoded by the codec. Expired items are left in
+// their table until Reap removes them. The statements on a table are
+// prepared once and kept until DeleteBucket drops it, so a table dropped
+// by other means, such as another process, is not noticed: its bucket
+// fails with a "no such table" error until the store is reopened.
+type Store struct {
+	db     *sql.DB
+	path   string
+	prefix string
+	codec  encoding.Codec
+	// writeMu serializes the write transactions of this process, so that
+	// they never fail to upgrade their read lock on each other.
+	writeMu *sync.Mutex
+	tables  *tables
+	feed    *util.Feed
+	// tx is the read transaction shared by the reads of a View.
+	tx *sql.Tx
+}
+
+var _ gokv.StoreWithContext = (*Store)(nil)
+
+func NewStore(options Options) (*Store, error) {
+	if options.Path == "" {
+		options.Path = DefaultOptions.Path
+	}
+	if options.TablePrefix == "" {
+		options.TablePrefix = DefaultOptions.TablePrefix
+	}
+	if options.Codec == nil {
+		options.Codec = DefaultOptions.Codec
+	}
+	if options.BusyTimeout == 0 {
+		options.BusyTimeout = DefaultOptions.BusyTimeout
+	}
+
+	db := sql.OpenDB(connector{dsn: options.Path, busyTimeout: options.BusyTimeout})
+
+	// WAL lets readers proceed while a write is in progress. The mode is
+	// kept in the database file, so it is set once for every connection.
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode = WAL").Scan(&mode); err != nil {
+		_ = db.Close()
+		return nil, wrapErr(err)
+	}
+
+	return &Store{
+		db:      db,
+		path:    options.Path,
+		prefix:  options.TablePrefix,
+		codec:   options.Codec,
+		writeMu: &sync.Mutex{},
+		tables:  &tables{stmts: make(map[string]*bucketStmts)},
+		feed:    &util.Feed{},
+	}, nil
+}
+
+// connector opens connections to the database at dsn and sets their
+// busy timeout, which SQLite does not keep in the database file.
+//
+// The driver begins every transaction as deferred, which takes the write
+// lock at the first write. A write transaction that read first then fails
+// right away if another connection wrote in between, whatever the busy
+// timeout, so the connections begin write transactions as immediate.
+type connector struct {
+	dsn         string
+	busyTimeout time.Duration
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pragma := fmt.Sprintf("PRAGMA busy_timeout = %d", c.busyTimeout.Milliseconds())
+	if _, err := conn.(driver.ExecerContext).ExecContext(ctx, pragma, nil); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return immediateConn{conn.(sqliteConn)}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return &modernc.Driver{}
+}
+
+// sqliteConn lists the interfaces implemented by the connections of the
+// driver.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+// immediateConn begins write transactions as immediate.
+type immediateConn struct {
+	sqliteConn
+}
+
+func (c immediateConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	begin := "BEGIN IMMEDIATE"
+	if opts.ReadOnly {
+		begin = "BEGIN"
+	}
+	if _, err := c.ExecContext(ctx, begin, nil); err != nil {
+		return nil, err
+	}
+	return connTx{c}, nil
+}
+
+// connTx is a transaction begun by immediateConn.
+type connTx struct {
+	c immediateConn
+}
+
+func (t connTx) Commit() error {
+	_, err := t.c.ExecContext(context.Background(), "COMMIT", nil)
+	return err
+}
+
+func (t connTx) Rollback() error {
+	_, err := t.c.ExecContext(context.Background(), "ROLLBACK", nil)
+	return err
+}
+
+func (s Store) Set(input types.SetItemInput) error {
+	return s.SetWithContext(context.Background(), input)
+}
+
+func (s Store) SetWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, []string{input.BucketName}, func(w *writer) error {
+		return w.put(input.BucketName, input.Key, data, input.TTL)
+	})
+}
+
+// BatchSet writes all pairs atomically in a single transaction.
+func (s Store) BatchSet(input types.BatchSetItemInput) error {
+	return s.BatchSetWithContext(context.Background(), input)
+}
+
+func (s Store) BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error {
+	if err := util.CheckKeysAndValues(input.Keys, input.Values); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := reflect.ValueOf(input.Values)
+	datas := make([][]byte, len(input.Keys))
+	for i := range input.Keys {
+		data, err := s.codec.Marshal(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		datas[i] = data
+	}
+
+	return s.update(ctx, []string{input.BucketName}, func(w *writer) error {
+		for i, key := range input.Keys {
+			if err := w.put(input.BucketName, key, datas[i], input.TTL); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s Store) Get(input types.GetItemInput) (found bool, err error) {
+	return s.GetWithContext(context.Background(), input)
+}
+
+func (s Store) GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error) {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	data, found, err := s.get(ctx, s.tx, input.BucketName, input.Key)
+	if err != nil || !found {
+		return false, wrapErr(err)
+	}
+
+	return true, s.codec.Unmarshal(data, input.Value)
+}
+
+func (s Store) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return s.BatchGetWithContext(context.Background(), input)
+}
+
+// BatchGetWithContext reads every key within a single read transaction.
+func (s Store) BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBatchValues(input.Values); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchGetItemOutput{}, err
+	}
+
+	data := make([][]byte, len(input.Keys))
+	found := make([]bool, len(input.Keys))
+	err := s.view(ctx, func(tx *sql.Tx) error {
+		for i, key := range input.Keys {
+			var err error
+			if data[i], found[i], err = s.get(ctx, tx, input.BucketName, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.BatchGetItemOutput{}, wrapErr(err)
+	}
+
+	return types.BatchGetItemOutput{Found: found}, util.DecodeBatch(s.codec, input.Keys, data, input.Values)
+}
+
+func (s Store) Delete(input types.DeleteItemInput) error {
+	return s.DeleteWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error {
+	if err := util.CheckKey(input.Key); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.update(ctx, nil, func(w *writer) error {
+		deleted, err := w.delete(input.BucketName, input.Key)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return gokv.ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s Store) BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	return s.BatchDeleteWithContext(context.Background(), input)
+}
+
+// BatchDeleteWithContext deletes every key within a single transaction.
+func (s Store) BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error) {
+	if err := util.CheckKeys(input.Keys); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	var missing []string
+	err := s.update(ctx, nil, func(w *writer) error {
+		missing = nil
+		for _, key := range input.Keys {
+			deleted, err := w.delete(input.BucketName, key)
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				missing = append(missing, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return types.BatchDeleteItemOutput{}, err
+	}
+
+	return types.BatchDeleteItemOutput{Missing: missing}, nil
+}
+
+func (s Store) SetIfNotExists(input types.SetItemInput) error {
+	return s.SetIfNotExistsWithContext(context.Background(), input)
+}
+
+// SetIfNotExistsWithContext inserts the item, or replaces it only if it
+// has expired, in a single statement.
+func (s Store) SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, []string{input.BucketName}, func(w *writer) error {
+		st, err := w.bucket(input.BucketName)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		res, err := w.stmt(st.setIfNotExists).ExecContext(w.ctx, input.Key, data, expiresAt(now, input.TTL), now.UnixNano())
+		if err := checkAffected(res, err); err != nil {
+			return err
+		}
+		w.record(types.EventPut, input.BucketName, input.Key)
+		return nil
+	})
+}
+
+func (s Store) CompareAndSwap(input types.CompareAndSwapInput) error {
+	return s.CompareAndSwapWithContext(context.Background(), input)
+}
+
+func (s Store) CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.NewValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckVal(input.OldValue); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	oldData, err := s.codec.Marshal(input.OldValue)
+	if err != nil {
+		return err
+	}
+
+	newData, err := s.codec.Marshal(input.NewValue)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, nil, func(w *writer) error {
+		st, err := w.bucket(input.BucketName)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return gokv.ErrConflict
+		}
+		now := time.Now()
+		res, err := w.stmt(st.compareAndSwap).ExecContext(w.ctx, input.Key, newData, expiresAt(now, input.TTL), oldData, now.UnixNano())
+		if err := checkAffected(res, err); err != nil {
+			return err
+		}
+		w.record(types.EventPut, input.BucketName, input.Key)
+		return nil
+	})
+}
+
+func (s Store) DeleteIf(input types.DeleteIfInput) error {
+	return s.DeleteIfWithContext(context.Background(), input)
+}
+
+func (s Store) DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error {
+	if err := util.CheckKeyAndValue(input.Key, input.Value); err != nil {
+		return err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(input.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, nil, func(w *writer) error {
+		st, err := w.bucket(input.BucketName)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return gokv.ErrConflict
+		}
+		res, err := w.stmt(st.deleteIf).ExecContext(w.ctx, input.Key, data, time.Now().UnixNano())
+		if err := checkAffected(res, err); err != nil {
+			return err
+		}
+		w.record(types.EventDelete, input.BucketName, input.Key)
+		return nil
+	})
+}
+
+func (s Store) Txn(input types.TxnInput) error {
+	return s.TxnWithContext(context.Background(), input)
+}
+
+// TxnWithContext evaluates the conditions and applies the ops in order
+// within a single write transaction.
+func (s Store) TxnWithContext(ctx context.Context, input types.TxnInput) error {
+	if err := util.CheckTxnOps(input.Ops); err != nil {
+		return err
+	}
+
+	for _, op := range input.Ops {
+		if err := util.CheckBucketName(op.BucketName); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	values := make([][]byte, len(input.Ops))
+	matches := make([][]byte, len(input.Ops))
+	for i, op := range input.Ops {
+		var err error
+		if op.Type == types.TxnSet {
+			if values[i], err = s.codec.Marshal(op.Value); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if matches[i], err = s.codec.Marshal(op.Match); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.update(ctx, nil, func(w *writer) error {
+		for i, op := range input.Ops {
+			if op.Condition == types.TxnAlways {
+				continue
+			}
+			current, found, err := w.s.get(w.ctx, w.tx, op.BucketName, op.Key)
+			if err != nil {
+				return err
+			}
+			if !txnConditionHolds(op, current, found, matches[i]) {
+				return &gokv.TxnConflictError{Index: i, BucketName: op.BucketName, Key: op.Key}
+			}
+		}
+
+		// the tables are created within the transaction, so a Txn whose
+		// conditions do not hold leaves no empty bucket behind
+		for _, op := range input.Ops {
+			if op.Type == types.TxnSet {
+				if err := w.create(op.BucketName); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i, op := range input.Ops {
+			var err error
+			switch op.Type {
+			case types.TxnSet:
+				err = w.put(op.BucketName, op.Key, values[i], op.TTL)
+			case types.TxnDelete:
+				_, err = w.delete(op.BucketName, op.Key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// txnConditionHolds evaluates the condition of op against the live value
+// of its item, matching it against match for TxnMatches.
+func txnConditionHolds(op types.TxnOp, current []byte, found bool, match []byte) bool {
+	switch op.Condition {
+	case types.TxnAlways:
+		return true
+	case types.TxnExists:
+		return found
+	case types.TxnNotExists:
+		return !found
+	case types.TxnMatches:
+		return found && bytes.Equal(current, match)
+	}
+	return false
+}
+
+func (s Store) View(fn func(tx gokv.ReadTx) error) error {
+	return s.ViewWithContext(context.Background(), fn)
+}
+
+// ViewWithContext runs fn within a single read transaction, so every read
+// of tx sees the same snapshot of the database, taken at its first read.
+func (s Store) ViewWithContext(ctx context.Context, fn func(tx gokv.ReadTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.view(ctx, func(tx *sql.Tx) error {
+		s.tx = tx
+		return fn(readTx{ctx: ctx, s: s})
+	})
+}
+
+// view runs fn within the transaction of a View, or a new read transaction.
+func (s Store) view(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	return fn(tx)
+}
+
+// readTx is the gokv.ReadTx passed to the fn of View.
+type readTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (r readTx) Get(input types.GetItemInput) (bool, error) {
+	return r.s.GetWithContext(r.ctx, input)
+}
+
+func (r readTx) BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error) {
+	return r.s.BatchGetWithContext(r.ctx, input)
+}
+
+func (r readTx) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return r.s.ScanWithContext(r.ctx, input)
+}
+
+func (s Store) DeleteBucket(input types.DeleteBucketInput) error {
+	return s.DeleteBucketWithContext(context.Background(), input)
+}
+
+// DeleteBucketWithContext drops the table of the bucket.
+func (s Store) DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.update(ctx, nil, func(w *writer) error {
+		st, err := w.bucket(input.BucketName)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return gokv.ErrBucketNotFound
+		}
+
+		if s.feed.Active() {
+			if err := w.recordAll(input.BucketName, st.keys); err != nil {
+				return err
+			}
+		}
+
+		// forgotten under the write lock, so no writer can use the
+		// statements on the table once it is dropped
+		s.tables.forget(input.BucketName)
+		table := s.prefix + input.BucketName
+		_, err = w.tx.ExecContext(w.ctx, "DROP TABLE "+quoteIdent(table))
+		return err
+	})
+}
+
+func (s Store) Scan(input types.ScanInput) (types.ScanOutput, error) {
+	return s.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext walks the primary key index of the table of the bucket
+// from the first candidate key, stopping at EndKey or at the end of the
+// keys starting with Prefix.
+func (s Store) ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	var start string
+	if input.StartToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(input.StartToken)
+		if err != nil || len(b) == 0 {
+			return types.ScanOutput{}, util.ErrInvalidToken
+		}
+		start = string(b)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.ScanOutput{}, err
+	}
+
+	st, err := s.bucket(ctx, input.BucketName, false)
+	if err != nil || st == nil {
+		return types.ScanOutput{}, wrapErr(err)
+	}
+
+	// seek straight to the first candidate
+	seek := start
+	for _, bound := range []string{input.Prefix, input.StartKey} {
+		if bound > seek {
+			seek = bound
+		}
+	}
+	end := input.EndKey
+	if pe := prefixEnd(input.Prefix); pe != "" && (end == "" || pe < end) {
+		end = pe
+	}
+
+	// read one more item than asked for, to find the start of the next page
+	limit := -1
+	if input.Limit > 0 {
+		limit = input.Limit + 1
+	}
+
+	var out types.ScanOutput
+	now := time.Now().UnixNano()
+	var rows *sql.Rows
+	if end == "" {
+		rows, err = s.stmt(ctx, s.tx, st.scan).QueryContext(ctx, seek, now, limit)
+	} else {
+		rows, err = s.stmt(ctx, s.tx, st.scanTo).QueryContext(ctx, seek, end, now, limit)
+	}
+	if err != nil {
+		return types.ScanOutput{}, wrapErr(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return types.ScanOutput{}, wrapErr(err)
+		}
+
+		if input.Limit > 0 && len(out.Keys) == input.Limit {
+			out.NextToken = base64.RawURLEncoding.EncodeToString([]byte(key))
+			break
+		}
+
+		out.Keys = append(out.Keys, key)
+		out.Values = append(out.Values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return types.ScanOutput{}, wrapErr(err)
+	}
+	return out, nil
+}
+
+func (s Store) Watch(input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.WatchWithContext(context.Background(), input)
+}
+
+// WatchWithContext reports the changes committed through this Store and
+// its copies. Other connections to the database, such as ad-hoc SQL, go
+// unseen, and expired rows are reported once Reap deletes them.
+// StartToken is not supported.
+func (s Store) WatchWithContext(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	return s.feed.Subscribe(ctx, input)
+}
+
+// Close closes the prepared statements and the database.
+func (s Store) Close() error {
+	s.tables.close()
+	return s.db.Close()
+}
+
+func (s Store) Info() (types.StoreInfo, error) {
+	return s.InfoWithContext(context.Background())
+}
+
+// InfoWithContext reports the size of the database file as Size, and the
+// size of the pages on its free list as FreeBytes. The size of a bucket is
+// that of its keys and values.
+func (s Store) InfoWithContext(ctx context.Context) (types.StoreInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return types.StoreInfo{}, err
+	}
+
+	info := types.StoreInfo{Name: s.path}
+	var pageSize, pageCount, freeCount int64
+	for q, dest := range map[string]interface{}{
+		"SELECT sqlite_version()": &info.Version,
+		"PRAGMA page_size":        &pageSize,
+		"PRAGMA page_count":       &pageCount,
+		"PRAGMA freelist_count":   &freeCount,
+	} {
+		if err := s.db.QueryRowContext(ctx, q).Scan(dest); err != nil {
+			return types.StoreInfo{}, wrapErr(err)
+		}
+	}
+	info.Size = pageSize * pageCount
+	info.FreeBytes = pageSize * freeCount
+	info.UsedBytes = info.Size - info.FreeBytes
+
+	var err error
+	if info.Buckets, err = s.ListBucketsWithContext(ctx); err != nil {
+		return types.StoreInfo{}, err
+	}
+	for _, bi := range info.Buckets {
+		info.Items += bi.Items
+	}
+	return info, nil
+}
+
+func (s Store) ListBuckets() ([]types.BucketInfo, error) {
+	return s.ListBucketsWithContext(context.Background())
+}
+
+// ListBucketsWithContext describes the buckets of every table named with
+// TablePrefix, sorted by name.
+func (s Store) ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT substr(name, ?1) FROM sqlite_master WHERE type = 'table' AND substr(name, 1, ?2) = ?3 ORDER BY name",
+		len(s.prefix)+1, len(s.prefix), s.prefix)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, wrapErr(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	var buckets []types.BucketInfo
+	for _, name := range names {
+		info, err := s.BucketInfoWithContext(ctx, types.BucketInfoInput{BucketName: name})
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, info)
+	}
+	return buckets, nil
+}
+
+func (s Store) BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error) {
+	return s.BucketInfoWithContext(context.Background(), input)
+}
+
+// BucketInfoWithContext counts the items of the bucket and sums up the
+// size of their keys and values. Items that expired but have not been
+// reaped yet are still counted.
+func (s Store) BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return types.BucketInfo{}, err
+	}
+
+	st, err := s.bucket(ctx, input.BucketName, false)
+	if err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+	if st == nil {
+		return types.BucketInfo{}, gokv.ErrBucketNotFound
+	}
+
+	info := types.BucketInfo{Name: input.BucketName}
+	if err := st.stats.QueryRowContext(ctx).Scan(&info.Items, &info.Size); err != nil {
+		return types.BucketInfo{}, wrapErr(err)
+	}
+	return info, nil
+}
+
+func (s Store) Exists(input types.ExistsInput) (bool, error) {
+	return s.ExistsWithContext(context.Background(), input)
+}
+
+func (s Store) ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return false, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	st, err := s.bucket(ctx, input.BucketName, false)
+	if err != nil || st == nil {
+		return false, wrapErr(err)
+	}
+
+	var n int
+	if err := st.exists.QueryRowContext(ctx, input.Key, time.Now().UnixNano()).Scan(&n); err != nil {
+		return false, wrapErr(err)
+	}
+	return n > 0, nil
+}
+
+func (s Store) Count(input types.CountInput) (int64, error) {
+	return s.CountWithContext(context.Background(), input)
+}
+
+func (s Store) CountWithContext(ctx context.Context, input types.CountInput) (int64, error) {
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	st, err := s.bucket(ctx, input.BucketName, false)
+	if err != nil || st == nil {
+		return 0, wrapErr(err)
+	}
+
+	var n int64
+	if err := st.count.QueryRowContext(ctx, time.Now().UnixNano()).Scan(&n); err != nil {
+		return 0, wrapErr(err)
+	}
+	return n, nil
+}
+
+func (s Store) Increment(input types.IncrementInput) (int64, error) {
+	return s.IncrementWithContext(context.Background(), input)
+}
+
+// IncrementWithContext reads, updates and writes back the counter
+// within a single write transaction, keeping its expiration time.
+func (s Store) IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	if err := util.CheckKey(input.Key); err != nil {
+		return 0, err
+	}
+
+	if err := util.CheckBucketName(input.BucketName); err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err := s.update(ctx, []string{input.BucketName}, func(w *writer) error {
+		data, found, err := w.s.get(w.ctx, w.tx, input.BucketName, input.Key)
+		if err != nil {
+			return err
+		}
+		if n, data, err = util.Increment(data, input.Delta); err != nil {
+			return err
+		}
+		if !found {
+			return w.put(input.BucketName, input.Key, data, 0)
+		}
+
+		st, err := w.bucket(input.BucketName)
+		if err != nil {
+			return err
+		}
+		if _, err := w.stmt(st.setValue).ExecContext(w.ctx, input.Key, data); err != nil {
+			return err
+		}
+		w.record(types.EventPut, input.BucketName, input.Key)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s Store) Decrement(input types.IncrementInput) (int64, error) {
+	return s.DecrementWithContext(context.Background(), input)
+}
+
+func (s Store) DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error) {
+	delta, err := util.Negate(input.Delta)
+	if err != nil {
+		return 0, err
+	}
+	input.Delta = delta
+	return s.IncrementWithContext(ctx, input)
+}
+
+// Reap deletes the expired items of bucketName, using the index
+// on expires_at.
+func (s Store) Reap(bucketName string) error {
+	if err := util.CheckBucketName(bucketName); err != nil {
+		return err
+	}
+
+	return s.update(context.Background(), nil, func(w *writer) error {
+		st, err := w.bucket(bucketName)
+		if err != nil || st == nil {
+			return err
+		}
+
+		now := time.Now().UnixNano()
+		if s.feed.Active() {
+			if err := w.recordAll(bucketName, st.expired, now); err != nil {
+				return err
+			}
+		}
+		_, err = w.stmt(st.reap).ExecContext(w.ctx, now)
+		return err
+	})
+}
+
+// get reads the live value of key within tx, if not nil, reporting
+// whether it was found.
+func (s Store) get(ctx context.Context, tx *sql.Tx, bucketName, key string) ([]byte, bool, error) {
+	st, err := s.bucket(ctx, bucketName, false)
+	if err != nil || st == nil {
+		return nil, false, err
+	}
+
+	var data []byte
+	err = s.stmt(ctx, tx, st.get).QueryRowContext(ctx, key, time.Now().UnixNano()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// stmt returns st bound to tx, if not nil.
+func (s Store) stmt(ctx context.Context, tx *sql.Tx, st *sql.Stmt) *sql.Stmt {
+	if tx != nil {
+		return tx.StmtContext(ctx, st)
+	}
+	return st
+}
+
+// update runs fn within a write transaction, once the tables of the
+// buckets in create exist. The events recorded by fn are published once
+// the transaction commits.
+func (s Store) update(ctx context.Context, create []string, fn func(w *writer) error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	for _, bucketName := range create {
+		if _, err := s.bucket(ctx, bucketName, true); err != nil {
+			return wrapErr(err)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr(err)
+	}
+	w := &writer{ctx: ctx, tx: tx, s: s}
+	if err := fn(w); err != nil {
+		_ = tx.Rollback()
+		return wrapErr(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapErr(err)
+	}
+
+	for _, ev := range w.events {
+		s.feed.Publish(ev)
+	}
+	return nil
+}
+
+// writer is the state of a write transaction run by update.
+type writer struct {
+	ctx    context.Context
+	tx     *sql.Tx
+	s      Store
+	events []types.Event
+	// created holds the statements on the tables created by the
+	// transaction, which other connections cannot see before it commits.
+	created map[string]*bucketStmts
+}
+
+func (w *writer) bucket(bucketName string) (*bucketStmts, error) {
+	if st := w.created[bucketName]; st != nil {
+		return st, nil
+	}
+	return w.s.bucket(w.ctx, bucketName, false)
+}
+
+// create creates the table of bucketName within the transaction, unless
+// it exists.
+func (w *writer) create(bucketName string) error {
+	st, err := w.bucket(bucketName)
+	if err != nil || st != nil {
+		return err
+	}
+
+	table := w.s.prefix + bucketName
+	if err := createTable(w.ctx, w.tx, table); err != nil {
+		return err
+	}
+	if st, err = prepareStmts(w.ctx, w.tx, quoteIdent(table)); err != nil {
+		return err
+	}
+	if w.created == nil {
+		w.created = make(map[string]*bucketStmts)
+	}
+	w.created[bucketName] = st
+	return nil
+}
+
+func (w *writer) stmt(st *sql.Stmt) *sql.Stmt {
+	return w.tx.StmtContext(w.ctx, st)
+}
+
+func (w *writer) record(typ types.EventType, bucketName, key string) {
+	w.events = append(w.events, types.Event{Type: typ, BucketName: bucketName, Key: key})
+}
+
+// recordAll records the removal of the items returned by st, which
+// selects their keys and expiration times.
+func (w *writer) recordAll(bucketName string, st *sql.Stmt, args ...interface{}) error {
+	rows, err := w.stmt(st).QueryContext(w.ctx, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now().UnixNano()
+	for rows.Next() {
+		var key string
+		var expiresAt sql.NullInt64
+		if err := rows.Scan(&key, &expiresAt); err != nil {
+			return err
+		}
+		typ := types.EventDelete
+		if expiresAt.Valid && expiresAt.Int64 <= now {
+			typ = types.EventExpire
+		}
+		w.record(typ, bucketName, key)
+	}
+	return rows.Err()
+}
+
+// put writes the item, whose table must exist.
+func (w *writer) put(bucketName, key string, data []byte, ttl time.Duration) error {
+	st, err := w.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.stmt(st.set).ExecContext(w.ctx, key, data, expiresAt(time.Now(), ttl)); err != nil {
+		return err
+	}
+	w.record(types.EventPut, bucketName, key)
+	return nil
+}
+
+// delete deletes the item, reporting whether it was live. Expired
+// items are left for Reap.
+func (w *writer) delete(bucketName, key string) (bool, error) {
+	st, err := w.bucket(bucketName)
+	if err != nil || st == nil {
+		return false, err
+	}
+	res, err := w.stmt(st.delete).ExecContext(w.ctx, key, time.Now().UnixNano())
+	if err := checkAffected(res, err); err == gokv.ErrConflict {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	w.record(types.EventDelete, bucketName, key)
+	return true, nil
+}
+
+// tables caches the prepared statements on the tables of the buckets
+// known to exist.
+type tables struct {
+	mu    sync.Mutex
+	stmts map[string]*bucketStmts
+}
+
+// bucketStmts holds the prepared statements on the table of a bucket.
+type bucketStmts struct {
+	get, set, setIfNotExists, setValue, compareAndSwap *sql.Stmt
+	deleteIf, delete, exists, count, stats, scan       *sql.Stmt
+	scanTo, keys, expired, reap                        *sql.Stmt
+}
+
+// bucket returns the statements on the table of bucketName, creating the
+// table if create is set. It returns nil if the table does not exist.
+func (s Store) bucket(ctx context.Context, bucketName string, create bool) (*bucketStmts, error) {
+	s.tables.mu.Lock()
+	defer s.tables.mu.Unlock()
+
+	if st := s.tables.stmts[bucketName]; st != nil {
+		return st, nil
+	}
+
+	table := s.prefix + bucketName
+	if create {
+		if err := createTable(ctx, s.db, table); err != nil {
+			return nil, err
+		}
+	} else {
+		var n int
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+	}
+
+	st, err := prepareStmts(ctx, s.db, quoteIdent(table))
+	if err != nil {
+		return nil, err
+	}
+	s.tables.stmts[bucketName] = st
+	return st, nil
+}
+
+// conn is a database or a transaction to run statements on.
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// createTable creates the table, and its index, unless they exist.
+func createTable(ctx context.Context, db conn, table string) error {
+	for _, q := range []string{
+		"CREATE TABLE IF NOT EXISTS %[1]s (key TEXT PRIMARY KEY, value BLOB NOT NULL, expires_at INTEGER) WITHOUT ROWID",
+		// the reaper finds expired items without a full scan
+		"CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (expires_at) WHERE expires_at IS NOT NULL",
+	} {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(q, quoteIdent(table), quoteIdent("idx_"+table))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prepareStmts(ctx context.Context, db conn, table string) (*bucketStmts, error) {
+	live := func(param int) string {
+		return fmt.Sprintf(liveCond, param)
+	}
+
+	st := &bucketStmts{}
+	queries := map[**sql.Stmt]string{
+		&st.get: "SELECT value FROM " + table + " WHERE key = ?1 AND " + live(2),
+		&st.set: "INSERT INTO " + table + " (key, value, expires_at) VALUES (?1, ?2, ?3)" +
+			" ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at",
+		// an expired item is replaced, a live one is left alone
+		&st.setIfNotExists: "INSERT INTO " + table + " (key, value, expires_at) VALUES (?1, ?2, ?3)" +
+			" ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at" +
+			" WHERE expires_at IS NOT NULL AND expires_at <= ?4",
+		// the expiration time of the item is kept
+		&st.setValue:       "UPDATE " + table + " SET value = ?2 WHERE key = ?1",
+		&st.compareAndSwap: "UPDATE " + table + " SET value = ?2, expires_at = ?3 WHERE key = ?1 AND value = ?4 AND " + live(5),
+		&st.deleteIf:       "DELETE FROM " + table + " WHERE key = ?1 AND value = ?2 AND " + live(3),
+		&st.delete:         "DELETE FROM " + table + " WHERE key = ?1 AND " + live(2),
+		&st.exists:         "SELECT COUNT(*) FROM " + table + " WHERE key = ?1 AND " + live(2),
+		&st.count:          "SELECT COUNT(*) FROM " + table + " WHERE " + live(1),
+		&st.stats:          "SELECT COUNT(*), COALESCE(SUM(length(CAST(key AS BLOB)) + length(value)), 0) FROM " + table,
+		&st.scan:           "SELECT key, value FROM " + table + " WHERE key >= ?1 AND " + live(2) + " ORDER BY key LIMIT ?3",
+		&st.scanTo:         "SELECT key, value FROM " + table + " WHERE key >= ?1 AND key < ?2 AND " + live(3) + " ORDER BY key LIMIT ?4",
+		&st.keys:           "SELECT key, expires_at FROM " + table,
+		&st.expired:        "SELECT key, expires_at FROM " + table + " WHERE expires_at <= ?1",
+		&st.reap:           "DELETE FROM " + table + " WHERE expires_at <= ?1",
+	}
+	for dest, q := range queries {
+		var err error
+		if *dest, err = db.PrepareContext(ctx, q); err != nil {
+			st.close()
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// forget drops the statements on the table of a deleted bucket.
+func (t *tables) forget(bucketName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st := t.stmts[bucketName]; st != nil {
+		st.close()
+		delete(t.stmts, bucketName)
+	}
+}
+
+func (t *tables) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for bucketName, st := range t.stmts {
+		st.close()
+		delete(t.stmts, bucketName)
+	}
+}
+
+func (st *bucketStmts) close() {
+	for _, stmt := range []*sql.Stmt{
+		st.get, st.set, st.setIfNotExists, st.setValue, st.compareAndSwap,
+		st.deleteIf, st.delete, st.exists, st.count, st.stats, st.scan,
+		st.scanTo, st.keys, st.expired, st.reap,
+	} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
+}
+
+// expiresAt returns the value of the expires_at column of an item written
+// at now with ttl, which is NULL for a ttl <= 0.
+func expiresAt(now time.Time, ttl time.Duration) interface{} {
+	if ttl <= 0 {
+		return nil
+	}
+	return now.Add(ttl).UnixNano()
+}
+
+// checkAffected returns ErrConflict if the statement that returned res
+// matched no row.
+func checkAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return gokv.ErrConflict
+	}
+	return nil
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// quoteIdent quotes name for use as an SQL identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// wrapErr maps errors returned by SQLite onto their gokv equivalents.
+func wrapErr(err error) error {
+	var serr *modernc.Error
+	if !errors.As(err, &serr) {
+		return err
+	}
+
+	// extended result codes keep the primary one in the low byte
+	switch serr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_READONLY:
+		return gokv.Wrap(gokv.ErrUnavailable, err)
+	case sqlite3.SQLITE_TOOBIG, sqlite3.SQLITE_FULL:
+		return gokv.Wrap(gokv.ErrTooLarge, err)
+	}
+	return err
+}
@@ -0,0 +1,268 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "SQLite_TestStore-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStore(Options{Path: filepath.Join(dir, "gokv.sqlite")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() {
+		_ = s.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	var mode string
+	assert.NoError(t, s.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	var timeout int
+	assert.NoError(t, s.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout))
+	assert.Equal(t, 5000, timeout)
+}
+
+func TestStore_Schema(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: `fo"o`, Key: "a", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: `fo"o`, Key: "b", Value: "val"}))
+
+	// the table can be queried with plain SQL
+	rows, err := s.db.Query(`SELECT key, value, expires_at FROM "gokv_fo""o" ORDER BY key`)
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	var keys []string
+	var expires []sql.NullInt64
+	for rows.Next() {
+		var key string
+		var value []byte
+		var expiresAt sql.NullInt64
+		assert.NoError(t, rows.Scan(&key, &value, &expiresAt))
+		assert.Equal(t, `"val"`, string(value))
+		keys = append(keys, key)
+		expires = append(expires, expiresAt)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []string{"a", "b"}, keys)
+	assert.True(t, expires[0].Valid)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), time.Unix(0, expires[0].Int64), time.Minute)
+	assert.False(t, expires[1].Valid)
+
+	var n int
+	assert.NoError(t, s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_gokv_fo"o'`).Scan(&n))
+	assert.Equal(t, 1, n)
+}
+
+func TestStore_Scan(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	keys := []string{"d", "a", "c", "b", "e", "b\xff", "c\x00"}
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: "foo", Keys: keys, Values: []string{"1", "2", "3", "4", "5", "6", "7"}}))
+
+	out, err := s.Scan(types.ScanInput{BucketName: "foo", Limit: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "b\xff"}, out.Keys)
+	assert.Equal(t, [][]byte{[]byte(`"2"`), []byte(`"4"`), []byte(`"6"`)}, out.Values)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: out.NextToken})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "c\x00", "d", "e"}, out.Keys)
+	assert.Empty(t, out.NextToken)
+
+	// keys are compared byte by byte
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", Prefix: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "b\xff"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "foo", StartKey: "b\x00", EndKey: "d"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b\xff", "c", "c\x00"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: "missing"})
+	assert.NoError(t, err)
+	assert.Empty(t, out.Keys)
+
+	_, err = s.Scan(types.ScanInput{BucketName: "foo", StartToken: "!"})
+	assert.Equal(t, util.ErrInvalidToken, err)
+}
+
+func TestPrefixEnd(t *testing.T) {
+	assert.Equal(t, "b", prefixEnd("a"))
+	assert.Equal(t, "b", prefixEnd("a\xff"))
+	assert.Equal(t, "", prefixEnd("\xff\xff"))
+	assert.Equal(t, "", prefixEnd(""))
+}
+
+func TestStore_TTL(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val", TTL: time.Nanosecond}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "c", Value: "val"}))
+	time.Sleep(time.Millisecond)
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "foo", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	n, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// expired items stay in the table until reaped
+	info, err := s.BucketInfo(types.BucketInfoInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), info.Items)
+
+	assert.NoError(t, s.Reap("foo"))
+	info, err = s.BucketInfo(types.BucketInfoInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), info.Items)
+
+	// an expired item does not block SetIfNotExists
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "d", Value: "old", TTL: time.Nanosecond}))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, s.SetIfNotExists(types.SetItemInput{BucketName: "foo", Key: "d", Value: "new"}))
+	found, err = s.Get(types.GetItemInput{BucketName: "foo", Key: "d", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "new", v)
+
+	// reaping a missing bucket is a no-op
+	assert.NoError(t, s.Reap("missing"))
+}
+
+func TestStore_Info(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val", TTL: time.Hour}))
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "bar", Key: "a", Value: "value"}))
+
+	// tables of other applications are not buckets
+	_, err := s.db.Exec("CREATE TABLE other (id INTEGER)")
+	assert.NoError(t, err)
+
+	info, err := s.Info()
+	assert.NoError(t, err)
+	assert.Equal(t, s.path, info.Name)
+	assert.NotEmpty(t, info.Version)
+	assert.Equal(t, int64(3), info.Items)
+	assert.Equal(t, []types.BucketInfo{
+		{Name: "bar", Items: 1, Size: 8},
+		{Name: "foo", Items: 2, Size: 12},
+	}, info.Buckets)
+	assert.True(t, info.Size > 0)
+	assert.Equal(t, info.Size, info.UsedBytes+info.FreeBytes)
+
+	_, err = s.BucketInfo(types.BucketInfoInput{BucketName: "missing"})
+	assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+}
+
+func TestStore_DeleteBucket(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "a", Value: "val"}))
+	assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"}))
+
+	var n int
+	assert.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'gokv_foo'").Scan(&n))
+	assert.Equal(t, 0, n)
+
+	err := s.DeleteBucket(types.DeleteBucketInput{BucketName: "foo"})
+	assert.Equal(t, gokv.ErrBucketNotFound, err)
+
+	// the bucket is created again on the next write
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: "foo", Key: "b", Value: "val"}))
+	n64, err := s.Count(types.CountInput{BucketName: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n64)
+}
+
+func TestStore_Txn_CreatesBuckets(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	// a Txn whose condition fails leaves no empty bucket behind
+	err := s.Txn(types.TxnInput{Ops: []types.TxnOp{
+		{Type: types.TxnCheck, BucketName: "foo", Key: "a", Condition: types.TxnExists},
+		{Type: types.TxnSet, BucketName: "bar", Key: "b", Value: "val"},
+	}})
+	assert.True(t, errors.Is(err, gokv.ErrConflict))
+	buckets, err := s.ListBuckets()
+	assert.NoError(t, err)
+	assert.Empty(t, buckets)
+
+	// the ops of a Txn see the bucket it creates
+	assert.NoError(t, s.Txn(types.TxnInput{Ops: []types.TxnOp{
+		{Type: types.TxnSet, BucketName: "bar", Key: "a", Value: "val"},
+		{Type: types.TxnSet, BucketName: "bar", Key: "b", Value: "val"},
+	}}))
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: "bar", Key: "b", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	n, err := s.Count(types.CountInput{BucketName: "bar"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestStore_SharedDatabase(t *testing.T) {
+	s, cleanup := setupStore(t)
+	defer cleanup()
+
+	// a second store on the same file waits for the write lock instead of failing
+	other, err := NewStore(Options{Path: s.path, TablePrefix: "other_"})
+	assert.NoError(t, err)
+	defer other.Close()
+
+	var wg sync.WaitGroup
+	for _, store := range []*Store{s, other} {
+		wg.Add(1)
+		go func(store *Store) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				_, err := store.Increment(types.IncrementInput{BucketName: "foo", Key: "n", Delta: 1})
+				assert.NoError(t, err)
+			}
+		}(store)
+	}
+	wg.Wait()
+
+	for _, store := range []*Store{s, other} {
+		n, err := store.Increment(types.IncrementInput{BucketName: "foo", Key: "n"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(20), n)
+	}
+}
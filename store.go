@@ -1,14 +1,101 @@
 package gokv
 
-import "github.com/simar7/gokv/types"
+import (
+	"context"
 
+	"github.com/simar7/gokv/types"
+)
+
+// Store is implemented by every backend. A missing key is reported by Get
+// as found == false with a nil error, while operations that require the
+// key to exist, such as Delete, return ErrNotFound. Stores that keep
+// buckets explicitly may report a missing bucket with ErrBucketNotFound,
+// while others treat it as empty. The storetest package checks a Store
+// against these semantics.
 type Store interface {
 	Set(input types.SetItemInput) error
 	BatchSet(input types.BatchSetItemInput) error
 	Get(input types.GetItemInput) (found bool, err error)
+	BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error)
 	Delete(input types.DeleteItemInput) error
+	BatchDelete(input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error)
 	DeleteBucket(input types.DeleteBucketInput) error
 	Close() error
 	Scan(input types.ScanInput) (types.ScanOutput, error)
 	Info() (types.StoreInfo, error)
+
+	// ListBuckets describes every bucket of the store, while BucketInfo
+	// describes a single one and returns ErrBucketNotFound if it is missing.
+	ListBuckets() ([]types.BucketInfo, error)
+	BucketInfo(input types.BucketInfoInput) (types.BucketInfo, error)
+
+	// Exists and Count look at keys only, without fetching
+	// or decoding values. Expired items are not counted. A missing
+	// bucket holds no items, so it is not reported as ErrBucketNotFound.
+	Exists(input types.ExistsInput) (bool, error)
+	Count(input types.CountInput) (int64, error)
+
+	// Increment and Decrement atomically change a counter by Delta and
+	// return its new value. Counters are stored as decimal text whatever
+	// the codec, which Get decodes with the JSON codec, and keep the
+	// expiration time of the item they change. A value that is not a
+	// decimal integer returns util.ErrNotCounter, and a new value that
+	// does not fit in an int64 util.ErrCounterOverflow.
+	Increment(input types.IncrementInput) (int64, error)
+	Decrement(input types.IncrementInput) (int64, error)
+
+	// Txn applies all of its ops atomically or none of them. When a
+	// condition does not hold it returns a *TxnConflictError.
+	Txn(input types.TxnInput) error
+
+	// View calls fn with a ReadTx whose reads all see the store at the
+	// same point in time, as far as the backend supports it. The ReadTx
+	// must not be used after fn returns.
+	View(fn func(tx ReadTx) error) error
+
+	// Watch reports the changes to the items of a bucket whose keys start
+	// with Prefix. The channel is closed once cancel is called or the
+	// store can no longer follow changes.
+	Watch(input types.WatchInput) (events <-chan types.Event, cancel func(), err error)
+
+	// Conditional writes return ErrConflict when the condition does not hold.
+	SetIfNotExists(input types.SetItemInput) error
+	CompareAndSwap(input types.CompareAndSwapInput) error
+	DeleteIf(input types.DeleteIfInput) error
+}
+
+// StoreWithContext is implemented by stores that can propagate
+// deadlines and cancellation down to the underlying datastore.
+// The plain Store methods behave as if called with context.Background().
+type StoreWithContext interface {
+	Store
+	SetWithContext(ctx context.Context, input types.SetItemInput) error
+	BatchSetWithContext(ctx context.Context, input types.BatchSetItemInput) error
+	GetWithContext(ctx context.Context, input types.GetItemInput) (found bool, err error)
+	BatchGetWithContext(ctx context.Context, input types.BatchGetItemInput) (types.BatchGetItemOutput, error)
+	DeleteWithContext(ctx context.Context, input types.DeleteItemInput) error
+	BatchDeleteWithContext(ctx context.Context, input types.BatchDeleteItemInput) (types.BatchDeleteItemOutput, error)
+	DeleteBucketWithContext(ctx context.Context, input types.DeleteBucketInput) error
+	ScanWithContext(ctx context.Context, input types.ScanInput) (types.ScanOutput, error)
+	InfoWithContext(ctx context.Context) (types.StoreInfo, error)
+	ListBucketsWithContext(ctx context.Context) ([]types.BucketInfo, error)
+	BucketInfoWithContext(ctx context.Context, input types.BucketInfoInput) (types.BucketInfo, error)
+	ExistsWithContext(ctx context.Context, input types.ExistsInput) (bool, error)
+	CountWithContext(ctx context.Context, input types.CountInput) (int64, error)
+	IncrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error)
+	DecrementWithContext(ctx context.Context, input types.IncrementInput) (int64, error)
+	TxnWithContext(ctx context.Context, input types.TxnInput) error
+	ViewWithContext(ctx context.Context, fn func(tx ReadTx) error) error
+	// WatchWithContext also closes the channel when ctx is done.
+	WatchWithContext(ctx context.Context, input types.WatchInput) (events <-chan types.Event, cancel func(), err error)
+	SetIfNotExistsWithContext(ctx context.Context, input types.SetItemInput) error
+	CompareAndSwapWithContext(ctx context.Context, input types.CompareAndSwapInput) error
+	DeleteIfWithContext(ctx context.Context, input types.DeleteIfInput) error
+}
+
+// ReadTx reads from the view of a store passed to the fn of View.
+type ReadTx interface {
+	Get(input types.GetItemInput) (found bool, err error)
+	BatchGet(input types.BatchGetItemInput) (types.BatchGetItemOutput, error)
+	Scan(input types.ScanInput) (types.ScanOutput, error)
 }
@@ -0,0 +1,394 @@
+// Package storetest provides a conformance suite for gokv.Store
+// implementations. Backends, including those living outside of this
+// module, call Run from one of their tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) gokv.Store {
+//			s, err := NewStore(...)
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return s
+//		})
+//	}
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/simar7/gokv/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// BucketName is the bucket the suite writes its items to.
+const BucketName = "storetest"
+
+// Options adapts the conformance suite to a store.
+type Options struct {
+	// Sleep lets d pass for the items of the store, so that their TTLs
+	// elapse. It defaults to time.Sleep, while stores running on a fake
+	// clock advance it instead.
+	Sleep func(d time.Duration)
+}
+
+// Run runs the conformance suite. newStore is called once per test and
+// must return an empty store, which the suite closes when the test ends.
+func Run(t *testing.T, newStore func(t *testing.T) gokv.Store) {
+	RunWithOptions(t, newStore, Options{})
+}
+
+// RunWithOptions runs the conformance suite like Run, adapted by opts.
+func RunWithOptions(t *testing.T, newStore func(t *testing.T) gokv.Store, opts Options) {
+	if opts.Sleep == nil {
+		opts.Sleep = time.Sleep
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s gokv.Store)
+	}{
+		{name: "miss", fn: testMiss},
+		{name: "overwrite", fn: testOverwrite},
+		{name: "empty key", fn: testEmptyKey},
+		{name: "delete", fn: testDelete},
+		{name: "delete bucket", fn: testDeleteBucket},
+		{name: "scan", fn: testScan},
+		{name: "scan pages", fn: testScanPages},
+		{name: "scan range", fn: testScanRange},
+		{name: "list buckets", fn: testListBuckets},
+		{name: "exists and count", fn: testExistsAndCount},
+		{name: "increment", fn: testIncrement},
+		{name: "increment ttl", fn: func(t *testing.T, s gokv.Store) {
+			testIncrementTTL(t, s, opts.Sleep)
+		}},
+		{name: "txn", fn: testTxn},
+		{name: "view", fn: testView},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStore(t)
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+			tc.fn(t, s)
+		})
+	}
+}
+
+func set(t *testing.T, s gokv.Store, key, value string) {
+	t.Helper()
+	if err := s.Set(types.SetItemInput{BucketName: BucketName, Key: key, Value: value}); err != nil {
+		t.Fatalf("set %q: %v", key, err)
+	}
+}
+
+// missing reports whether a Get result means the item does not exist.
+// Stores with explicit buckets may report a missing bucket as an error.
+func missing(found bool, err error) bool {
+	return !found && (err == nil || errors.Is(err, gokv.ErrBucketNotFound))
+}
+
+func testMiss(t *testing.T, s gokv.Store) {
+	set(t, s, "foo", "bar")
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: BucketName, Key: "missing", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, v)
+}
+
+func testOverwrite(t *testing.T, s gokv.Store) {
+	set(t, s, "foo", "bar")
+	set(t, s, "foo", "baz")
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: BucketName, Key: "foo", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "baz", v)
+}
+
+func testEmptyKey(t *testing.T, s gokv.Store) {
+	var v string
+	assert.Equal(t, util.ErrEmptyKey, s.Set(types.SetItemInput{BucketName: BucketName, Value: "bar"}))
+	_, err := s.Get(types.GetItemInput{BucketName: BucketName, Value: &v})
+	assert.Equal(t, util.ErrEmptyKey, err)
+	assert.Equal(t, util.ErrEmptyKey, s.Delete(types.DeleteItemInput{BucketName: BucketName}))
+}
+
+func testDelete(t *testing.T, s gokv.Store) {
+	set(t, s, "foo", "bar")
+
+	assert.NoError(t, s.Delete(types.DeleteItemInput{BucketName: BucketName, Key: "foo"}))
+	assert.True(t, errors.Is(s.Delete(types.DeleteItemInput{BucketName: BucketName, Key: "foo"}), gokv.ErrNotFound))
+
+	var v string
+	found, err := s.Get(types.GetItemInput{BucketName: BucketName, Key: "foo", Value: &v})
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func testDeleteBucket(t *testing.T, s gokv.Store) {
+	set(t, s, "foo", "bar")
+	if err := s.Set(types.SetItemInput{BucketName: BucketName + "other", Key: "foo", Value: "bar"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: BucketName}))
+	assert.True(t, errors.Is(s.DeleteBucket(types.DeleteBucketInput{BucketName: BucketName}), gokv.ErrBucketNotFound))
+	assert.Equal(t, util.ErrEmptyBucketName, s.DeleteBucket(types.DeleteBucketInput{}))
+
+	var v string
+	assert.True(t, missing(s.Get(types.GetItemInput{BucketName: BucketName, Key: "foo", Value: &v})))
+
+	// other buckets are left alone
+	found, err := s.Get(types.GetItemInput{BucketName: BucketName + "other", Key: "foo", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "bar", v)
+}
+
+func testScan(t *testing.T, s gokv.Store) {
+	for _, k := range []string{"a", "b", "c"} {
+		set(t, s, k, "val"+k)
+	}
+
+	out, err := s.Scan(types.ScanInput{BucketName: BucketName})
+	assert.NoError(t, err)
+	assert.Empty(t, out.NextToken)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, out.Keys)
+	assert.Equal(t, len(out.Keys), len(out.Values))
+	for i, k := range out.Keys {
+		assert.Equal(t, fmt.Sprintf("%q", "val"+k), string(out.Values[i]))
+	}
+}
+
+func testScanPages(t *testing.T, s gokv.Store) {
+	var expected []string
+	for i := 0; i < 25; i++ {
+		k := fmt.Sprintf("key%02d", i)
+		set(t, s, k, "val")
+		expected = append(expected, k)
+	}
+
+	var keys []string
+	it := gokv.NewScanIterator(s, types.ScanInput{BucketName: BucketName, Limit: 10})
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.NoError(t, it.Err())
+	assert.ElementsMatch(t, expected, keys)
+}
+
+func testScanRange(t *testing.T, s gokv.Store) {
+	for _, k := range []string{"a1", "a2", "a3", "b1", "c1"} {
+		set(t, s, k, "val")
+	}
+
+	out, err := s.Scan(types.ScanInput{BucketName: BucketName, Prefix: "a"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a1", "a2", "a3"}, out.Keys)
+
+	out, err = s.Scan(types.ScanInput{BucketName: BucketName, StartKey: "a2", EndKey: "b2"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a2", "a3", "b1"}, out.Keys)
+}
+
+func testListBuckets(t *testing.T, s gokv.Store) {
+	set(t, s, "a", "val")
+	set(t, s, "b", "val")
+	if err := s.Set(types.SetItemInput{BucketName: BucketName + "other", Key: "a", Value: "val"}); err != nil {
+		t.Fatal(err)
+	}
+
+	buckets, err := s.ListBuckets()
+	assert.NoError(t, err)
+	items := make(map[string]int64)
+	for _, bi := range buckets {
+		items[bi.Name] = bi.Items
+	}
+	assert.Equal(t, map[string]int64{BucketName: 2, BucketName + "other": 1}, items)
+
+	info, err := s.BucketInfo(types.BucketInfoInput{BucketName: BucketName})
+	assert.NoError(t, err)
+	assert.Equal(t, BucketName, info.Name)
+	assert.Equal(t, int64(2), info.Items)
+
+	_, err = s.BucketInfo(types.BucketInfoInput{BucketName: BucketName + "missing"})
+	assert.True(t, errors.Is(err, gokv.ErrBucketNotFound))
+	_, err = s.BucketInfo(types.BucketInfoInput{})
+	assert.Equal(t, util.ErrEmptyBucketName, err)
+}
+
+func testExistsAndCount(t *testing.T, s gokv.Store) {
+	set(t, s, "a", "val")
+	set(t, s, "b", "val")
+
+	exists, err := s.Exists(types.ExistsInput{BucketName: BucketName, Key: "a"})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = s.Exists(types.ExistsInput{BucketName: BucketName, Key: "missing"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = s.Exists(types.ExistsInput{BucketName: BucketName})
+	assert.Equal(t, util.ErrEmptyKey, err)
+
+	n, err := s.Count(types.CountInput{BucketName: BucketName})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	assert.NoError(t, s.Delete(types.DeleteItemInput{BucketName: BucketName, Key: "a"}))
+	n, err = s.Count(types.CountInput{BucketName: BucketName})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = s.Count(types.CountInput{})
+	assert.Equal(t, util.ErrEmptyBucketName, err)
+
+	// a missing bucket holds no items
+	exists, err = s.Exists(types.ExistsInput{BucketName: BucketName + "missing", Key: "a"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	n, err = s.Count(types.CountInput{BucketName: BucketName + "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func testIncrement(t *testing.T, s gokv.Store) {
+	n, err := s.Increment(types.IncrementInput{BucketName: BucketName, Key: "counter", Delta: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	n, err = s.Decrement(types.IncrementInput{BucketName: BucketName, Key: "counter", Delta: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-2), n)
+
+	// the negation of the smallest delta does not fit an int64
+	_, err = s.Decrement(types.IncrementInput{BucketName: BucketName, Key: "counter", Delta: math.MinInt64})
+	assert.Equal(t, util.ErrCounterOverflow, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := s.Increment(types.IncrementInput{BucketName: BucketName, Key: "counter", Delta: 1}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var v int64
+	found, err := s.Get(types.GetItemInput{BucketName: BucketName, Key: "counter", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(98), v)
+
+	// a counter is decimal text, as the JSON codec writes an integer
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: BucketName, Key: "set", Value: 5}))
+	n, err = s.Increment(types.IncrementInput{BucketName: BucketName, Key: "set", Delta: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+
+	set(t, s, "a", "val")
+	_, err = s.Increment(types.IncrementInput{BucketName: BucketName, Key: "a", Delta: 1})
+	assert.Equal(t, util.ErrNotCounter, err)
+
+	_, err = s.Increment(types.IncrementInput{BucketName: BucketName, Delta: 1})
+	assert.Equal(t, util.ErrEmptyKey, err)
+}
+
+func testIncrementTTL(t *testing.T, s gokv.Store, sleep func(d time.Duration)) {
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: BucketName, Key: "counter", Value: 5, TTL: time.Second}))
+	n, err := s.Increment(types.IncrementInput{BucketName: BucketName, Key: "counter", Delta: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+
+	// the counter expires with the item it changed, and starts over
+	sleep(2 * time.Second)
+	exists, err := s.Exists(types.ExistsInput{BucketName: BucketName, Key: "counter"})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	n, err = s.Increment(types.IncrementInput{BucketName: BucketName, Key: "counter", Delta: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func testTxn(t *testing.T, s gokv.Store) {
+	set(t, s, "a", "val")
+
+	// move a to the other bucket
+	err := s.Txn(types.TxnInput{Ops: []types.TxnOp{
+		{Type: types.TxnDelete, BucketName: BucketName, Key: "a", Condition: types.TxnMatches, Match: "val"},
+		{Type: types.TxnSet, BucketName: BucketName + "other", Key: "a", Value: "val", Condition: types.TxnNotExists},
+	}})
+	assert.NoError(t, err)
+
+	var v string
+	assert.True(t, missing(s.Get(types.GetItemInput{BucketName: BucketName, Key: "a", Value: &v})))
+	found, err := s.Get(types.GetItemInput{BucketName: BucketName + "other", Key: "a", Value: &v})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "val", v)
+
+	// a failed condition aborts every op
+	err = s.Txn(types.TxnInput{Ops: []types.TxnOp{
+		{Type: types.TxnSet, BucketName: BucketName, Key: "b", Value: "val"},
+		{Type: types.TxnCheck, BucketName: BucketName, Key: "missing", Condition: types.TxnExists},
+	}})
+	assert.True(t, errors.Is(err, gokv.ErrConflict))
+	var conflict *gokv.TxnConflictError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, 1, conflict.Index)
+		assert.Equal(t, "missing", conflict.Key)
+	}
+	assert.True(t, missing(s.Get(types.GetItemInput{BucketName: BucketName, Key: "b", Value: &v})))
+
+	assert.Equal(t, util.ErrEmptyTxn, s.Txn(types.TxnInput{}))
+	assert.Equal(t, util.ErrDuplicateTxnKey, s.Txn(types.TxnInput{Ops: []types.TxnOp{
+		{Type: types.TxnSet, BucketName: BucketName, Key: "a", Value: "val"},
+		{Type: types.TxnDelete, BucketName: BucketName, Key: "a"},
+	}}))
+}
+
+func testView(t *testing.T, s gokv.Store) {
+	set(t, s, "a", "val")
+	set(t, s, "b", "val")
+
+	errStop := errors.New("stop")
+	err := s.View(func(tx gokv.ReadTx) error {
+		var v string
+		found, err := tx.Get(types.GetItemInput{BucketName: BucketName, Key: "a", Value: &v})
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "val", v)
+
+		values := make(map[string]string)
+		out, err := tx.BatchGet(types.BatchGetItemInput{BucketName: BucketName, Keys: []string{"a", "b", "missing"}, Values: values})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, true, false}, out.Found)
+		assert.Equal(t, map[string]string{"a": "val", "b": "val"}, values)
+
+		scan, err := tx.Scan(types.ScanInput{BucketName: BucketName})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"a", "b"}, scan.Keys)
+		return errStop
+	})
+	assert.Equal(t, errStop, err)
+}
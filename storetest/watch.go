@@ -0,0 +1,153 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// RunWatch runs the Watch tests, for stores that report the writes made
+// through them right away. Like Run, it calls newStore once per test.
+func RunWatch(t *testing.T, newStore func(t *testing.T) gokv.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s gokv.Store)
+	}{
+		{name: "events", fn: testWatchEvents},
+		{name: "cancel", fn: testWatchCancel},
+		{name: "context", fn: testWatchContext},
+		{name: "reap", fn: testWatchReap},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newStore(t)
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+			tc.fn(t, s)
+		})
+	}
+}
+
+// Reaper is implemented by stores that keep expired items until Reap
+// removes them.
+type Reaper interface {
+	Reap(bucketName string) error
+}
+
+// Receive returns the next event, failing the test if none comes
+// within a second or events is closed.
+func Receive(t *testing.T, events <-chan types.Event) types.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return types.Event{}
+}
+
+func testWatchEvents(t *testing.T, s gokv.Store) {
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: BucketName, Prefix: "a"})
+	assert.NoError(t, err)
+	defer cancel()
+
+	set(t, s, "a1", "val")
+	// other keys and buckets are not reported
+	set(t, s, "b1", "val")
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: BucketName + "other", Key: "a1", Value: "val"}))
+	assert.NoError(t, s.Delete(types.DeleteItemInput{BucketName: BucketName, Key: "a1"}))
+	assert.NoError(t, s.BatchSet(types.BatchSetItemInput{BucketName: BucketName, Keys: []string{"a2", "a3"}, Values: []string{"val", "val"}}))
+	_, err = s.Increment(types.IncrementInput{BucketName: BucketName, Key: "a4", Delta: 1})
+	assert.NoError(t, err)
+	// a failed write reports nothing
+	assert.Error(t, s.SetIfNotExists(types.SetItemInput{BucketName: BucketName, Key: "a2", Value: "val"}))
+	assert.NoError(t, s.DeleteIf(types.DeleteIfInput{BucketName: BucketName, Key: "a3", Value: "val"}))
+
+	for _, expected := range []types.Event{
+		{Type: types.EventPut, BucketName: BucketName, Key: "a1"},
+		{Type: types.EventDelete, BucketName: BucketName, Key: "a1"},
+		{Type: types.EventPut, BucketName: BucketName, Key: "a2"},
+		{Type: types.EventPut, BucketName: BucketName, Key: "a3"},
+		{Type: types.EventPut, BucketName: BucketName, Key: "a4"},
+		{Type: types.EventDelete, BucketName: BucketName, Key: "a3"},
+	} {
+		ev := Receive(t, events)
+		ev.Token = ""
+		assert.Equal(t, expected, ev)
+	}
+
+	// deleting the bucket reports each of its items, in any order
+	assert.NoError(t, s.DeleteBucket(types.DeleteBucketInput{BucketName: BucketName}))
+	var deleted []string
+	for i := 0; i < 2; i++ {
+		ev := Receive(t, events)
+		assert.Equal(t, types.EventDelete, ev.Type)
+		deleted = append(deleted, ev.Key)
+	}
+	assert.ElementsMatch(t, []string{"a2", "a4"}, deleted)
+}
+
+func testWatchCancel(t *testing.T, s gokv.Store) {
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: BucketName})
+	assert.NoError(t, err)
+
+	cancel()
+	for range events {
+	}
+	// cancel may be called again, and writes go on without the watcher
+	cancel()
+	set(t, s, "a", "val")
+}
+
+func testWatchContext(t *testing.T, s gokv.Store) {
+	sc, ok := s.(gokv.StoreWithContext)
+	if !ok {
+		t.Skip("store does not implement gokv.StoreWithContext")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, _, err := sc.WatchWithContext(ctx, types.WatchInput{BucketName: BucketName})
+	assert.NoError(t, err)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("events not closed")
+	}
+}
+
+func testWatchReap(t *testing.T, s gokv.Store) {
+	r, ok := s.(Reaper)
+	if !ok {
+		t.Skip("store does not implement storetest.Reaper")
+	}
+
+	events, cancel, err := s.Watch(types.WatchInput{BucketName: BucketName})
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.NoError(t, s.Set(types.SetItemInput{BucketName: BucketName, Key: "a", Value: "val", TTL: time.Nanosecond}))
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, r.Reap(BucketName))
+
+	for _, expected := range []types.Event{
+		{Type: types.EventPut, BucketName: BucketName, Key: "a"},
+		{Type: types.EventExpire, BucketName: BucketName, Key: "a"},
+	} {
+		ev := Receive(t, events)
+		ev.Token = ""
+		assert.Equal(t, expected, ev)
+	}
+}
@@ -1,15 +1,22 @@
 package types
 
+import "time"
+
 type SetItemInput struct {
 	BucketName string
 	Key        string
 	Value      interface{}
+	// TTL is the duration after which the item expires.
+	// Zero means the item never expires.
+	TTL time.Duration
 }
 
 type BatchSetItemInput struct {
 	BucketName string
 	Keys       []string
 	Values     interface{}
+	// TTL is applied to every item in the batch.
+	TTL time.Duration
 }
 
 type GetItemInput struct {
@@ -18,25 +25,203 @@ type GetItemInput struct {
 	Value      interface{}
 }
 
+type BatchGetItemInput struct {
+	BucketName string
+	Keys       []string
+	// Values is either a pointer to a slice, filled in the order of Keys,
+	// or a map keyed by item key which receives the items found.
+	Values interface{}
+}
+
+type BatchGetItemOutput struct {
+	// Found reports for every key in Keys whether it was found.
+	Found []bool
+}
+
+type CompareAndSwapInput struct {
+	BucketName string
+	Key        string
+	// OldValue must match the stored value for the swap to happen.
+	OldValue interface{}
+	NewValue interface{}
+	TTL      time.Duration
+}
+
+type DeleteIfInput struct {
+	BucketName string
+	Key        string
+	// Value must match the stored value for the delete to happen.
+	Value interface{}
+}
+
 type DeleteItemInput struct {
 	BucketName string
 	Key        string
 }
 
+type BatchDeleteItemInput struct {
+	BucketName string
+	Keys       []string
+}
+
+type BatchDeleteItemOutput struct {
+	// Missing lists the keys that did not exist.
+	Missing []string
+}
+
 type DeleteBucketInput struct {
 	BucketName string
 }
 
+type BucketInfoInput struct {
+	BucketName string
+}
+
+type ExistsInput struct {
+	BucketName string
+	Key        string
+}
+
+type CountInput struct {
+	BucketName string
+}
+
+// IncrementInput adds Delta to the counter stored at Key.
+// A missing or expired counter starts at zero.
+type IncrementInput struct {
+	BucketName string
+	Key        string
+	Delta      int64
+}
+
+// TxnOpType selects what a TxnOp does.
+type TxnOpType int
+
+const (
+	// TxnSet writes Value, expiring after TTL if it is set.
+	TxnSet TxnOpType = iota
+	// TxnDelete removes the item. Deleting a missing item is not an error.
+	TxnDelete
+	// TxnCheck only evaluates the condition of the op.
+	TxnCheck
+)
+
+// TxnCondition guards a TxnOp. The transaction aborts when the
+// condition of any of its ops does not hold.
+type TxnCondition int
+
+const (
+	TxnAlways TxnCondition = iota
+	TxnExists
+	TxnNotExists
+	// TxnMatches holds when the item stores Match.
+	TxnMatches
+)
+
+type TxnOp struct {
+	Type       TxnOpType
+	BucketName string
+	Key        string
+	Value      interface{}
+	TTL        time.Duration
+	Condition  TxnCondition
+	Match      interface{}
+}
+
+// TxnInput lists the ops committed together. Every op must
+// refer to a different item.
+type TxnInput struct {
+	Ops []TxnOp
+}
+
+// WatchInput selects the items whose changes Watch reports.
+type WatchInput struct {
+	BucketName string
+	Prefix     string
+	// StartToken resumes watching after the event carrying it as Token,
+	// first replaying the changes made since.
+	StartToken string
+}
+
+// EventType tells what happened to the item of an Event.
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+	// EventExpire reports an item removed because its TTL elapsed.
+	EventExpire
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	}
+	return "unknown"
+}
+
+// Event describes a change to a single item.
+type Event struct {
+	Type       EventType
+	BucketName string
+	Key        string
+	// Token can be passed as WatchInput.StartToken to resume after this
+	// event. It is empty if the store cannot resume watching.
+	Token string
+}
+
 type ScanInput struct {
 	BucketName string
+	// Limit is the maximum number of items returned in one page.
+	// Zero returns every item in the bucket.
+	Limit int
+	// StartToken resumes a scan from the NextToken of a previous page.
+	StartToken string
+	// Prefix restricts the scan to keys starting with it.
+	Prefix string
+	// StartKey and EndKey restrict the scan to keys in [StartKey, EndKey).
+	// Either one may be left empty for an open ended range.
+	StartKey string
+	EndKey   string
 }
 
 type ScanOutput struct {
 	Keys   []string `dynamodbav:"k"`
 	Values [][]byte `dynamodbav:"v"`
+	// NextToken is set when more items are available.
+	NextToken string `dynamodbav:"-"`
 }
 
+// StoreInfo describes a store. Fields a backend cannot
+// determine are left at their zero value.
 type StoreInfo struct {
 	Name string
+	// Size is the number of bytes taken up by the store.
 	Size int64
+	// Version of the backing datastore.
+	Version string
+	// Items is the number of items across all buckets.
+	Items int64
+	// UsedBytes and FreeBytes split the storage into the part holding
+	// data and the part still available, such as free pages of a file
+	// or the memory left below a configured limit.
+	UsedBytes int64
+	FreeBytes int64
+	// ReadCapacityUnits and WriteCapacityUnits hold the provisioned
+	// throughput of stores that have one.
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+	Buckets            []BucketInfo
+}
+
+// BucketInfo describes a single bucket of a store.
+type BucketInfo struct {
+	Name  string
+	Items int64
+	Size  int64
 }
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrNotCounter      = errors.New("value is not a decimal counter")
+	ErrCounterOverflow = errors.New("counter would overflow")
+)
+
+// Increment adds delta to the counter stored as data, which is nil for a
+// missing counter, and returns the new value along with the data to store.
+// Counters are kept as decimal text whatever the codec of the store, the
+// way redis and DynamoDB keep them.
+func Increment(data []byte, delta int64) (int64, []byte, error) {
+	var n int64
+	if data != nil {
+		var err error
+		if n, err = strconv.ParseInt(string(data), 10, 64); err != nil {
+			return 0, nil, ErrNotCounter
+		}
+	}
+
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return 0, nil, ErrCounterOverflow
+	}
+	n += delta
+	return n, []byte(strconv.FormatInt(n, 10)), nil
+}
+
+// Negate returns the delta that decrements a counter by delta. The
+// negation of math.MinInt64 does not fit an int64, so it is reported as
+// ErrCounterOverflow rather than wrapping around to an increment.
+func Negate(delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrCounterOverflow
+	}
+	return -delta, nil
+}
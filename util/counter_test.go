@@ -0,0 +1,86 @@
+package util
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrement(t *testing.T) {
+	testCases := []struct {
+		name          string
+		data          []byte
+		delta         int64
+		expected      int64
+		expectedData  string
+		expectedError error
+	}{
+		{
+			name:         "missing counter",
+			delta:        5,
+			expected:     5,
+			expectedData: "5",
+		},
+		{
+			name:         "decrement",
+			data:         []byte("5"),
+			delta:        -7,
+			expected:     -2,
+			expectedData: "-2",
+		},
+		{
+			name:          "not a number",
+			data:          []byte(`"val"`),
+			delta:         1,
+			expectedError: ErrNotCounter,
+		},
+		{
+			name:          "not an integer",
+			data:          []byte("1.5"),
+			delta:         1,
+			expectedError: ErrNotCounter,
+		},
+		{
+			name:          "overflow",
+			data:          []byte("9223372036854775807"),
+			delta:         1,
+			expectedError: ErrCounterOverflow,
+		},
+		{
+			name:          "underflow",
+			data:          []byte("-2"),
+			delta:         math.MinInt64,
+			expectedError: ErrCounterOverflow,
+		},
+		{
+			name:         "up to the maximum",
+			data:         []byte("-1"),
+			delta:        math.MaxInt64,
+			expected:     math.MaxInt64 - 1,
+			expectedData: "9223372036854775806",
+		},
+	}
+
+	for _, tc := range testCases {
+		n, data, err := Increment(tc.data, tc.delta)
+		assert.Equal(t, tc.expectedError, err, tc.name)
+		assert.Equal(t, tc.expected, n, tc.name)
+		if tc.expectedError == nil {
+			assert.Equal(t, tc.expectedData, string(data), tc.name)
+		}
+	}
+}
+
+func TestNegate(t *testing.T) {
+	delta, err := Negate(7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-7), delta)
+
+	delta, err = Negate(math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-math.MaxInt64), delta)
+
+	_, err = Negate(math.MinInt64)
+	assert.Equal(t, ErrCounterOverflow, err)
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+)
+
+// Feed fans the changes a store makes out to the watchers registered
+// with it, for stores that see every write themselves. The zero value
+// is ready to use.
+type Feed struct {
+	mu       sync.Mutex
+	watchers map[*Watcher]struct{}
+}
+
+// Watch registers a watcher for the changes matching input. Events are
+// queued from then on, and delivered once Start is called.
+func (f *Feed) Watch(input types.WatchInput) *Watcher {
+	w := &Watcher{
+		feed:   f,
+		input:  input,
+		ch:     make(chan types.Event),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.watchers == nil {
+		f.watchers = make(map[*Watcher]struct{})
+	}
+	f.watchers[w] = struct{}{}
+	return w
+}
+
+// Subscribe checks input and starts a watcher for it, for stores that
+// keep no change log to resume from, so StartToken is not supported.
+func (f *Feed) Subscribe(ctx context.Context, input types.WatchInput) (<-chan types.Event, func(), error) {
+	if err := CheckBucketName(input.BucketName); err != nil {
+		return nil, nil, err
+	}
+
+	if input.StartToken != "" {
+		return nil, nil, gokv.ErrNotSupported
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	events, cancel := f.Watch(input).Start(ctx)
+	return events, cancel, nil
+}
+
+// Active reports whether any watcher is registered, so that stores can
+// skip building events nobody receives.
+func (f *Feed) Active() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.watchers) > 0
+}
+
+// Publish queues ev for every watcher it matches.
+func (f *Feed) Publish(ev types.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for w := range f.watchers {
+		if w.Matches(ev) {
+			w.enqueue(ev)
+		}
+	}
+}
+
+func (f *Feed) remove(w *Watcher) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.watchers, w)
+}
+
+// Watcher queues the events of a single watch, so that a slow reader
+// never holds up the writers of the store.
+type Watcher struct {
+	feed   *Feed
+	input  types.WatchInput
+	ch     chan types.Event
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	queue []types.Event
+}
+
+// Matches reports whether ev concerns the items the watcher follows.
+func (w *Watcher) Matches(ev types.Event) bool {
+	return ev.BucketName == w.input.BucketName && strings.HasPrefix(ev.Key, w.input.Prefix)
+}
+
+func (w *Watcher) enqueue(ev types.Event) {
+	w.mu.Lock()
+	w.queue = append(w.queue, ev)
+	w.mu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Replay puts events read back from a change log ahead of the queued
+// ones, dropping queued events the replay already covers. Tokens must
+// be decimal sequence numbers.
+func (w *Watcher) Replay(events []types.Event) {
+	if len(events) == 0 {
+		return
+	}
+	last, _ := strconv.ParseUint(events[len(events)-1].Token, 10, 64)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ev := range w.queue {
+		if seq, _ := strconv.ParseUint(ev.Token, 10, 64); seq > last {
+			events = append(events, ev)
+		}
+	}
+	w.queue = events
+}
+
+// Start delivers the queued events until cancel is called or ctx is done,
+// and then closes the channel.
+func (w *Watcher) Start(ctx context.Context) (<-chan types.Event, func()) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Cancel()
+		case <-w.done:
+		}
+	}()
+	go w.pump()
+	return w.ch, w.Cancel
+}
+
+// Cancel unregisters the watcher. It may be called more than once.
+func (w *Watcher) Cancel() {
+	w.once.Do(func() {
+		w.feed.remove(w)
+		close(w.done)
+	})
+}
+
+func (w *Watcher) pump() {
+	defer close(w.ch)
+	for {
+		w.mu.Lock()
+		events := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, ev := range events {
+			select {
+			case w.ch <- ev:
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.notify:
+		case <-w.done:
+			return
+		}
+	}
+}
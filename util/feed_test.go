@@ -0,0 +1,58 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/simar7/gokv"
+	"github.com/simar7/gokv/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeed(t *testing.T) {
+	var f Feed
+	assert.False(t, f.Active())
+
+	w := f.Watch(types.WatchInput{BucketName: "foo", Prefix: "a"})
+	assert.True(t, f.Active())
+
+	f.Publish(types.Event{Type: types.EventPut, BucketName: "foo", Key: "a1", Token: "2"})
+	f.Publish(types.Event{Type: types.EventPut, BucketName: "foo", Key: "b1", Token: "3"})
+	f.Publish(types.Event{Type: types.EventPut, BucketName: "bar", Key: "a1", Token: "4"})
+	f.Publish(types.Event{Type: types.EventDelete, BucketName: "foo", Key: "a1", Token: "5"})
+
+	// the replay covers the first queued event
+	w.Replay([]types.Event{
+		{Type: types.EventPut, BucketName: "foo", Key: "a0", Token: "1"},
+		{Type: types.EventPut, BucketName: "foo", Key: "a1", Token: "2"},
+	})
+
+	events, cancel := w.Start(context.Background())
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, (<-events).Token)
+	}
+	assert.Equal(t, []string{"1", "2", "5"}, got)
+
+	cancel()
+	for range events {
+	}
+	assert.False(t, f.Active())
+}
+
+func TestFeed_Subscribe(t *testing.T) {
+	var f Feed
+
+	_, _, err := f.Subscribe(context.Background(), types.WatchInput{})
+	assert.Equal(t, ErrEmptyBucketName, err)
+
+	// there is no change log to resume from
+	_, _, err = f.Subscribe(context.Background(), types.WatchInput{BucketName: "foo", StartToken: "1"})
+	assert.Equal(t, gokv.ErrNotSupported, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = f.Subscribe(ctx, types.WatchInput{BucketName: "foo"})
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, f.Active())
+}
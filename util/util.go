@@ -1,11 +1,23 @@
 package util
 
-import "errors"
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
+)
 
 var (
 	ErrEmptyKey        = errors.New("passed key is empty")
 	ErrEmptyValue      = errors.New("passed value is empty")
 	ErrEmptyBucketName = errors.New("bucket name is empty")
+	ErrInvalidToken    = errors.New("invalid scan start token")
+	ErrInvalidValues   = errors.New("values must be a pointer to a slice or a map")
+	ErrLengthMismatch  = errors.New("number of keys and values differ")
+	ErrEmptyTxn        = errors.New("transaction has no ops")
+	ErrDuplicateTxnKey = errors.New("transaction refers to the same item twice")
 )
 
 // CheckKeyAndValue returns an error if k == "" or if v == nil
@@ -32,9 +44,140 @@ func CheckVal(v interface{}) error {
 	return nil
 }
 
+// CheckKeys returns an error if keys is empty or any of its keys == ""
+func CheckKeys(keys []string) error {
+	if len(keys) == 0 {
+		return ErrEmptyKey
+	}
+	for _, k := range keys {
+		if err := CheckKey(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckKeysAndValues returns an error if any of keys == "", if values
+// is not a slice or if it does not hold one value per key
+func CheckKeysAndValues(keys []string, values interface{}) error {
+	if err := CheckKeys(keys); err != nil {
+		return err
+	}
+	if err := CheckVal(values); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return ErrLengthMismatch
+	}
+	if rv.Len() != len(keys) {
+		return ErrLengthMismatch
+	}
+	return nil
+}
+
+// CheckBatchValues returns an error if v is neither a non-nil
+// pointer to a slice nor a non-nil map with string keys
+func CheckBatchValues(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Map && !rv.IsNil() && rv.Type().Key().Kind() == reflect.String:
+		return nil
+	case rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Slice:
+		return nil
+	}
+	return ErrInvalidValues
+}
+
+// DecodeBatch unmarshals data[i], the raw value of keys[i], into values
+// as described by types.BatchGetItemInput. Nil entries of data are skipped.
+func DecodeBatch(codec encoding.Codec, keys []string, data [][]byte, values interface{}) error {
+	if err := CheckBatchValues(values); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(values)
+	if rv.Kind() == reflect.Map {
+		for i, d := range data {
+			if d == nil {
+				continue
+			}
+			elem := reflect.New(rv.Type().Elem())
+			if err := codec.Unmarshal(d, elem.Interface()); err != nil {
+				return err
+			}
+			rv.SetMapIndex(reflect.ValueOf(keys[i]).Convert(rv.Type().Key()), elem.Elem())
+		}
+		return nil
+	}
+
+	slice := rv.Elem()
+	if slice.Len() < len(keys) {
+		grown := reflect.MakeSlice(slice.Type(), len(keys), len(keys))
+		reflect.Copy(grown, slice)
+		slice.Set(grown)
+	}
+	for i, d := range data {
+		if d == nil {
+			continue
+		}
+		if err := codec.Unmarshal(d, slice.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckTxnOps returns an error if ops is empty, if an op lacks its key,
+// its value or the value its condition matches, or if two ops refer to
+// the same item
+func CheckTxnOps(ops []types.TxnOp) error {
+	if len(ops) == 0 {
+		return ErrEmptyTxn
+	}
+	seen := make(map[[2]string]bool, len(ops))
+	for _, op := range ops {
+		if err := CheckKey(op.Key); err != nil {
+			return err
+		}
+		if op.Type == types.TxnSet {
+			if err := CheckVal(op.Value); err != nil {
+				return err
+			}
+		}
+		if op.Condition == types.TxnMatches {
+			if err := CheckVal(op.Match); err != nil {
+				return err
+			}
+		}
+		item := [2]string{op.BucketName, op.Key}
+		if seen[item] {
+			return ErrDuplicateTxnKey
+		}
+		seen[item] = true
+	}
+	return nil
+}
+
 func CheckBucketName(b string) error {
 	if b == "" {
 		return ErrEmptyBucketName
 	}
 	return nil
 }
+
+// InScanRange returns true if k starts with prefix and lies in
+// [startKey, endKey). Empty bounds are ignored.
+func InScanRange(k, prefix, startKey, endKey string) bool {
+	if !strings.HasPrefix(k, prefix) {
+		return false
+	}
+	if startKey != "" && k < startKey {
+		return false
+	}
+	if endKey != "" && k >= endKey {
+		return false
+	}
+	return true
+}
@@ -3,6 +3,8 @@ package util
 import (
 	"testing"
 
+	"github.com/simar7/gokv/encoding"
+	"github.com/simar7/gokv/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +45,178 @@ func TestCheckKeyAndValue(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckKeysAndValues(t *testing.T) {
+	testCases := []struct {
+		name          string
+		inputKeys     []string
+		inputValues   interface{}
+		expectedError error
+	}{
+		{
+			name:        "happy path",
+			inputKeys:   []string{"foo", "bar"},
+			inputValues: []string{"val1", "val2"},
+		},
+		{
+			name:          "missing keys",
+			inputValues:   []string{"val1"},
+			expectedError: ErrEmptyKey,
+		},
+		{
+			name:          "empty key",
+			inputKeys:     []string{"foo", ""},
+			inputValues:   []string{"val1", "val2"},
+			expectedError: ErrEmptyKey,
+		},
+		{
+			name:          "missing values",
+			inputKeys:     []string{"foo"},
+			expectedError: ErrEmptyValue,
+		},
+		{
+			name:          "values not a slice",
+			inputKeys:     []string{"foo"},
+			inputValues:   "val1",
+			expectedError: ErrLengthMismatch,
+		},
+		{
+			name:          "more keys than values",
+			inputKeys:     []string{"foo", "bar"},
+			inputValues:   []string{"val1"},
+			expectedError: ErrLengthMismatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expectedError, CheckKeysAndValues(tc.inputKeys, tc.inputValues), tc.name)
+	}
+}
+
+func TestInScanRange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		key      string
+		prefix   string
+		startKey string
+		endKey   string
+		expected bool
+	}{
+		{
+			name:     "happy path, no bounds",
+			key:      "foo",
+			expected: true,
+		},
+		{
+			name:     "happy path, prefix matches",
+			key:      "tenant/1/obj",
+			prefix:   "tenant/1/",
+			expected: true,
+		},
+		{
+			name:   "prefix does not match",
+			key:    "tenant/2/obj",
+			prefix: "tenant/1/",
+		},
+		{
+			name:     "happy path, start key is inclusive",
+			key:      "b",
+			startKey: "b",
+			endKey:   "c",
+			expected: true,
+		},
+		{
+			name:     "end key is exclusive",
+			key:      "c",
+			startKey: "b",
+			endKey:   "c",
+		},
+		{
+			name:     "before start key",
+			key:      "a",
+			startKey: "b",
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, InScanRange(tc.key, tc.prefix, tc.startKey, tc.endKey), tc.name)
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	data := [][]byte{[]byte(`"val1"`), nil, []byte(`"val3"`)}
+
+	t.Run("happy path, slice", func(t *testing.T) {
+		var values []string
+		assert.NoError(t, DecodeBatch(encoding.JSON, keys, data, &values))
+		assert.Equal(t, []string{"val1", "", "val3"}, values)
+	})
+
+	t.Run("happy path, map", func(t *testing.T) {
+		values := map[string]string{}
+		assert.NoError(t, DecodeBatch(encoding.JSON, keys, data, values))
+		assert.Equal(t, map[string]string{"foo": "val1", "baz": "val3"}, values)
+	})
+
+	t.Run("sad path, invalid values", func(t *testing.T) {
+		var values []string
+		assert.Equal(t, ErrInvalidValues, DecodeBatch(encoding.JSON, keys, data, values))
+		assert.Equal(t, ErrInvalidValues, DecodeBatch(encoding.JSON, keys, data, map[int]string{}))
+		assert.Equal(t, ErrInvalidValues, DecodeBatch(encoding.JSON, keys, data, nil))
+	})
+}
+
+func TestCheckTxnOps(t *testing.T) {
+	testCases := []struct {
+		name          string
+		inputOps      []types.TxnOp
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			inputOps: []types.TxnOp{
+				{Type: types.TxnSet, BucketName: "foo", Key: "foo", Value: "val"},
+				{Type: types.TxnDelete, BucketName: "bar", Key: "foo"},
+				{Type: types.TxnCheck, BucketName: "foo", Key: "bar", Condition: types.TxnMatches, Match: "val"},
+			},
+		},
+		{
+			name:          "no ops",
+			expectedError: ErrEmptyTxn,
+		},
+		{
+			name:          "missing key",
+			inputOps:      []types.TxnOp{{Type: types.TxnDelete, BucketName: "foo"}},
+			expectedError: ErrEmptyKey,
+		},
+		{
+			name:          "missing value",
+			inputOps:      []types.TxnOp{{Type: types.TxnSet, BucketName: "foo", Key: "foo"}},
+			expectedError: ErrEmptyValue,
+		},
+		{
+			name:          "missing match",
+			inputOps:      []types.TxnOp{{Type: types.TxnCheck, BucketName: "foo", Key: "foo", Condition: types.TxnMatches}},
+			expectedError: ErrEmptyValue,
+		},
+		{
+			name: "same item twice",
+			inputOps: []types.TxnOp{
+				{Type: types.TxnSet, BucketName: "foo", Key: "foo", Value: "val"},
+				{Type: types.TxnCheck, BucketName: "foo", Key: "foo", Condition: types.TxnExists},
+			},
+			expectedError: ErrDuplicateTxnKey,
+		},
+	}
+
+	for _, tc := range testCases {
+		err := CheckTxnOps(tc.inputOps)
+		switch {
+		case tc.expectedError != nil:
+			assert.Equal(t, tc.expectedError, err, tc.name)
+		default:
+			assert.NoError(t, err, tc.name)
+		}
+	}
+}